@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Comandos administrativos executados pela linha de comando, sem iniciar os servidores
+// Ex: ./quepasa sessions-reencrypt
+func runCommand(args []string) error {
+	switch args[0] {
+	case "sessions-keygen":
+		// Gera uma nova chave para uso em SESSIONKEYS ou SESSIONKEYFILE
+		key, err := models.GenerateSessionKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+	case "sessions-reencrypt":
+		// Regrava todas as sessões com a chave ativa (SESSIONKEYID)
+		models.QPWhatsAppPrepare()
+		count, err := models.ReEncryptSessions()
+		if err != nil {
+			return err
+		}
+		models.Log.WithComponent("command").Infof("sessions re-encrypted: %d", count)
+	case "bot-export":
+		// bot-export <botID> <arquivo>
+		if len(args) < 3 {
+			return fmt.Errorf("usage: bot-export <botID> <file>")
+		}
+
+		models.QPWhatsAppPrepare()
+		bundle, err := models.ExportBotBundle(args[1], readPassphrase())
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(args[2], bundle, 0600)
+	case "bot-import":
+		// bot-import <arquivo> <email do usuário>
+		// O servidor do bot é iniciado na próxima inicialização do QuePasa
+		if len(args) < 3 {
+			return fmt.Errorf("usage: bot-import <file> <user email>")
+		}
+
+		models.QPWhatsAppPrepare()
+		user, err := models.WhatsAppService.DB.User.FindByEmail(args[2])
+		if err != nil {
+			return fmt.Errorf("user not found: %s", args[2])
+		}
+
+		bundle, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+
+		bot, err := models.ImportBotBundle(bundle, readPassphrase(), user.ID)
+		if err != nil {
+			return err
+		}
+		bot.GetLogger().WithComponent("command").Infof("bot imported")
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	return nil
+}
+
+// Frase secreta dos pacotes de exportação, apartir de BUNDLEPASSPHRASE ou da entrada padrão
+func readPassphrase() string {
+	if passphrase := os.Getenv("BUNDLEPASSPHRASE"); len(passphrase) > 0 {
+		return passphrase
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
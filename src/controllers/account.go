@@ -2,9 +2,10 @@ package controllers
 
 import (
 	"errors"
-	"html/template"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -18,10 +19,19 @@ import (
 //
 
 type accountFormData struct {
-	PageTitle    string
-	ErrorMessage string
-	Bots         []models.QPBot
-	User         models.QPUser
+	PageTitle      string
+	ErrorMessage   string
+	SuccessMessage string
+	Bots           []models.QPBotAccess
+	Teams          []models.QPTeamMembership
+	User           models.QPUser
+	NewAPIKey      string
+	Sessions       []models.QPUserSession
+	CurrentSession string
+
+	// Token recém gerado de um bot, exibido uma única vez
+	NewBotToken       string
+	NewBotTokenNumber string
 }
 
 // AccountFormHandler renders route GET "/account"
@@ -29,24 +39,82 @@ func AccountFormHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := models.GetUser(r)
 	if err != nil {
 		redirectToLogin(w, r)
+		return
+	}
+
+	renderAccountForm(w, r, accountFormData{PageTitle: "Account", User: user})
+}
+
+// APIKeyHandler renders route POST "/account/apikey"
+// Gera uma nova chave de acesso, exibida uma única vez
+func APIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
 	}
 
-	data := accountFormData{
-		PageTitle: "Account",
-		User:      user,
+	data := accountFormData{PageTitle: "Account", User: user}
+	data.NewAPIKey, err = models.GenerateUserAPIKey(user.ID)
+	if err != nil {
+		getLogger(r).WithError(err).Errorf("error generating api key")
+		data.ErrorMessage = err.Error()
 	}
 
-	bots, err := models.WhatsAppService.DB.Bot.FindAllForUser(user.ID)
+	renderAccountForm(w, r, data)
+}
+
+func renderAccountForm(w http.ResponseWriter, r *http.Request, data accountFormData) {
+	bots, err := models.FindAllBotsForUser(data.User.ID)
 	if err != nil {
 		data.ErrorMessage = err.Error()
 	} else {
 		data.Bots = bots
 	}
 
-	templates := template.Must(template.ParseFiles("views/layouts/main.tmpl", "views/account.tmpl"))
+	teams, err := models.WhatsAppService.DB.Team.FindAllForUser(data.User.ID)
+	if err != nil {
+		data.ErrorMessage = err.Error()
+	} else {
+		data.Teams = teams
+	}
+
+	sessions, err := models.FindUserSessions(data.User.ID)
+	if err != nil {
+		data.ErrorMessage = err.Error()
+	} else {
+		data.Sessions = sessions
+	}
+	data.CurrentSession = getSessionID(r)
+
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/account.tmpl")
 	templates.ExecuteTemplate(w, "main", data)
 }
 
+// LifecycleWebHookHandler renders route POST "/account/webhook"
+func LifecycleWebHookHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	err = models.SetUserLifecycleWebHook(user, strings.TrimSpace(r.Form.Get("url")))
+	if err == models.ErrInvalidWebHook {
+		renderAccountForm(w, r, accountFormData{PageTitle: "Account", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	if err != nil {
+		getLogger(r).WithError(err).Errorf("error updating lifecycle webhook")
+		renderAccountForm(w, r, accountFormData{PageTitle: "Account", User: user, ErrorMessage: "error updating lifecycle webhook"})
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusFound)
+}
+
 //
 // Login
 //
@@ -61,7 +129,7 @@ func LoginFormHandler(w http.ResponseWriter, r *http.Request) {
 		PageTitle: "Login",
 	}
 
-	templates := template.Must(template.ParseFiles("views/layouts/main.tmpl", "views/login.tmpl"))
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/login.tmpl")
 	templates.ExecuteTemplate(w, "main", data)
 }
 
@@ -76,42 +144,97 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.WhatsAppService.DB.User.Check(email, password)
+	// Bloqueio verificado antes da senha, nem mesmo a senha correta entra
+	address := getRemoteAddress(r)
+	if wait := models.CheckLoginLockout(email, address); wait > 0 {
+		respondLoginLocked(w, r, email, wait)
+		return
+	}
+
+	user, err := models.AuthenticateUser(email, password)
 	if err != nil {
+		// Usuário desativado recebe o mesmo erro, sem revelar que a senha está correta
+		if err == models.ErrUserDisabled {
+			getLogger(r).WithField("remote", r.RemoteAddr).Warnf("login refused for disabled user %s", email)
+		}
+
+		models.LoginFailed(email, address, "password")
 		respondUnauthorized(w, errors.New("Incorrect username or password"))
 		return
 	}
 
+	// Com o segundo fator a sessão só é emitida após o código
+	if user.TOTPEnabled {
+		setPendingLoginCookie(w, user)
+		http.Redirect(w, r, "/login/2fa", http.StatusFound)
+		return
+	}
+
+	completeLogin(w, r, user)
+}
+
+// Responde 429 com o tempo restante do bloqueio no header Retry-After
+func respondLoginLocked(w http.ResponseWriter, r *http.Request, email string, wait time.Duration) {
+	getLogger(r).WithField("remote", r.RemoteAddr).Warnf("login locked for %s", email)
+	w.Header().Set("Retry-After", strconv.Itoa(models.RetryAfterSeconds(wait)))
+	respondError(w, models.LoginLockedError(wait), http.StatusTooManyRequests)
+}
+
+// Emite o cookie da sessão web, somente após todos os fatores de autenticação
+// A sessão é registrada no banco e o seu id vai no jti, para que possa ser revogada
+func completeLogin(w http.ResponseWriter, r *http.Request, user models.QPUser) {
+	session, err := models.CreateUserSession(user, getRemoteAddress(r), r.UserAgent())
+	if err != nil {
+		getLogger(r).WithError(err).Errorf("error creating session")
+		respondError(w, errors.New("error creating session"), http.StatusInternalServerError)
+		return
+	}
+
+	models.LoginSucceeded(user.Email)
+
+	expiry := models.GetSessionExpiry()
 	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SIGNING_SECRET")), nil)
-	claims := jwt.MapClaims{"user_id": user.ID}
+	claims := jwt.MapClaims{"user_id": user.ID, "jti": session.ID}
 	jwtauth.SetIssuedNow(claims)
-	jwtauth.SetExpiryIn(claims, 24*time.Hour)
+	jwtauth.SetExpiryIn(claims, expiry)
 	_, tokenString, _ := tokenAuth.Encode(claims)
 	cookie := &http.Cookie{
 		Name:     "jwt",
 		Value:    tokenString,
-		MaxAge:   60 * 60 * 24,
+		MaxAge:   int(expiry.Seconds()),
 		Path:     "/",
 		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	}
 
 	http.SetCookie(w, cookie)
 
+	// Exigido por alguma equipe e ainda não cadastrado
+	if models.RequiresTOTPEnrollment(user) {
+		http.Redirect(w, r, "/account/2fa", http.StatusFound)
+		return
+	}
+
 	http.Redirect(w, r, "/account", http.StatusFound)
 }
 
 // LogoutHandler renders route GET "/logoout"
+// Revoga a sessão no banco, o JWT deixa de valer mesmo que tenha sido copiado
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	cookie := &http.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		MaxAge:   0,
-		Path:     "/",
-		HttpOnly: true,
+	if cookie, err := r.Cookie("jwt"); err == nil {
+		tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SIGNING_SECRET")), nil)
+		if token, err := tokenAuth.Decode(cookie.Value); err == nil && token.Valid {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				userID, _ := claims["user_id"].(string)
+				sessionID, _ := claims["jti"].(string)
+				if err := models.RevokeUserSession(userID, sessionID); err != nil {
+					getLogger(r).WithError(err).Warnf("error revoking session on logout")
+				}
+			}
+		}
 	}
 
-	http.SetCookie(w, cookie)
-
+	clearSessionCookie(w)
 	redirectToLogin(w, r)
 }
 
@@ -131,8 +254,8 @@ type setupFormData struct {
 	PasswordCrackTime     string
 }
 
-func renderSetupForm(w http.ResponseWriter, data setupFormData) {
-	templates := template.Must(template.ParseFiles("views/layouts/main.tmpl", "views/setup.tmpl"))
+func renderSetupForm(w http.ResponseWriter, r *http.Request, data setupFormData) {
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/setup.tmpl")
 	templates.ExecuteTemplate(w, "main", data)
 }
 
@@ -148,7 +271,7 @@ func SetupFormHandler(w http.ResponseWriter, r *http.Request) {
 		PageTitle: "Setup",
 	}
 
-	renderSetupForm(w, data)
+	renderSetupForm(w, r, data)
 }
 
 // SetupHandler renders route POST "/setup"
@@ -171,7 +294,7 @@ func SetupHandler(w http.ResponseWriter, r *http.Request) {
 	if email == "" || password == "" {
 		data.ErrorMessage = "Email and password are required"
 		data.EmailError = true
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
 		return
 	}
 
@@ -180,14 +303,14 @@ func SetupHandler(w http.ResponseWriter, r *http.Request) {
 	if !validateEmail(email) {
 		data.ErrorMessage = "Email is invalid"
 		data.EmailInvalidError = true
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
 		return
 	}
 
 	if password != passwordConfirm {
 		data.ErrorMessage = "Passwords don't match"
 		data.PasswordMatchError = true
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
 		return
 	}
 
@@ -196,27 +319,35 @@ func SetupHandler(w http.ResponseWriter, r *http.Request) {
 		data.ErrorMessage = "Password is too weak"
 		data.PasswordStrengthError = true
 		data.PasswordCrackTime = res.CrackTimeDisplay
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
 		return
 	}
 
 	exists, err := models.WhatsAppService.DB.User.Exists(email)
 	if err != nil {
 		data.ErrorMessage = err.Error()
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
 		return
 	}
 
 	if exists {
 		data.UserExistsError = true
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
+		return
+	}
+
+	user, err := models.WhatsAppService.DB.User.Create(email, password)
+	if err != nil {
+		data.ErrorMessage = err.Error()
+		renderSetupForm(w, r, data)
 		return
 	}
 
-	_, err = models.WhatsAppService.DB.User.Create(email, password)
+	// O primeiro usuário administra os demais
+	err = models.WhatsAppService.DB.User.SetAdmin(user.ID, true)
 	if err != nil {
 		data.ErrorMessage = err.Error()
-		renderSetupForm(w, data)
+		renderSetupForm(w, r, data)
 		return
 	}
 
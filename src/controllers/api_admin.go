@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+//
+// Bots
+//
+
+// BotsAdminHandler renders route GET "/v2/admin/bots"
+// Lista os bots que o usuário atual alcança, próprios ou compartilhados, com o seu papel e o estado de cada conexão
+func BotsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	bots, err := models.FindAllBotsForUser(user.ID)
+	if err != nil {
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	out := []models.QPBotAdminV2{}
+	for _, bot := range bots {
+		out = append(out, bot.ToAdminV2())
+	}
+
+	respondSuccess(w, out)
+}
+
+// BotAdminHandler renders route GET "/v2/admin/bot/{botID}"
+func BotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := findAdminBotAccess(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	respondSuccess(w, access.ToAdminV2())
+}
+
+// StartBotAdminHandler renders route POST "/v2/admin/bot/{botID}/start"
+func StartBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if err := bot.Start(); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	respondSuccess(w, bot.ToAdminV2())
+}
+
+// StopBotAdminHandler renders route POST "/v2/admin/bot/{botID}/stop"
+func StopBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if err := bot.Stop(); err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	respondSuccess(w, bot.ToAdminV2())
+}
+
+// RestartBotAdminHandler renders route POST "/v2/admin/bot/{botID}/restart"
+// A reconexão acontece em segundo plano, acompanhe pelo estado do bot
+func RestartBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if err := bot.Restart(); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	respondSuccess(w, bot.ToAdminV2())
+}
+
+// CycleTokenBotAdminHandler renders route POST "/v2/admin/bot/{botID}/token"
+// Gera um novo token, o anterior continua aceito durante o período de carência
+// Única resposta com o token, somente o seu hash é gravado
+func CycleTokenBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	token, err := bot.CycleToken()
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	bot, err = models.WhatsAppService.DB.Bot.FindByID(bot.ID)
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	admin := bot.ToAdminV2()
+	admin.Token = token
+	respondSuccess(w, admin)
+}
+
+// DevelBotAdminHandler renders route POST "/v2/admin/bot/{botID}/devel"
+// Habilita/Desabilita o modo de depuração do bot
+func DevelBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if err := bot.ToggleDevel(); err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	respondSuccess(w, bot.ToAdminV2())
+}
+
+// RateLimitsBotAdminHandler renders route POST "/v2/admin/bot/{botID}/ratelimit"
+// Limites de requisições por minuto do bot, zero utiliza o padrão global e negativo desabilita
+func RateLimitsBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var request models.QPRateLimitsV2
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	if err := bot.SetRateLimits(request.Send, request.Receive, request.Attachment); err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	respondSuccess(w, bot.ToAdminV2())
+}
+
+// DeleteBotAdminHandler renders route DELETE "/v2/admin/bot/{botID}"
+// Desliga o servidor, apaga a sessão e o bot
+func DeleteBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := bot.Remove(); err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	respondSuccess(w, bot.ToAdminV2())
+}
+
+// BotAPIKeysAdminHandler renders route GET "/v2/admin/bot/{botID}/apikeys"
+// Lista as chaves de acesso do bot, sem as chaves em si
+func BotAPIKeysAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	keys, err := models.WhatsAppService.DB.APIKey.FindAllForBot(bot.ID)
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	out := []models.QPBotAPIKeyV2{}
+	for _, key := range keys {
+		out = append(out, key.ToV2())
+	}
+
+	respondSuccess(w, out)
+}
+
+// CreateBotAPIKeyAdminHandler renders route POST "/v2/admin/bot/{botID}/apikeys"
+// A chave é retornada somente nesta resposta, apenas o hash é gravado
+func CreateBotAPIKeyAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var request models.QPBotAPIKeyRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	key, apikey, err := models.CreateBotAPIKey(bot.ID, request)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	bot.GetLogger().WithField("apikey", apikey.ID).Infof("api key %s created with scopes %s", apikey.Name, apikey.Scopes)
+	response := apikey.ToV2()
+	response.Key = key
+	respondSuccess(w, response)
+}
+
+// DeleteBotAPIKeyAdminHandler renders route DELETE "/v2/admin/bot/{botID}/apikeys/{keyID}"
+func DeleteBotAPIKeyAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	keyID := chi.URLParam(r, "keyID")
+	if err := models.WhatsAppService.DB.APIKey.Delete(bot.ID, keyID); err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	bot.GetLogger().WithField("apikey", keyID).Infof("api key revoked")
+	respondSuccess(w, keyID)
+}
+
+//
+// API Key
+//
+
+// APIKeyAdminHandler renders route POST "/v2/admin/apikey"
+// Gera uma nova chave de acesso para o usuário atual, a anterior deixa de ser aceita
+func APIKeyAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	key, err := models.GenerateUserAPIKey(user.ID)
+	if err != nil {
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondSuccess(w, models.QPAPIKeyResponseV2{Header: models.APIKeyHeader, Key: key})
+}
+
+//
+// Backup
+//
+
+// Header com a frase secreta usada para criptografar/descriptografar os pacotes de exportação
+const passphraseHeader = "X-QUEPASA-PASSPHRASE"
+
+// Tamanho máximo aceito na importação, os pacotes têm poucos KB
+const maxBundleSize = 1 << 20
+
+// ExportBotAdminHandler renders route POST "/v2/admin/bot/{botID}/export"
+// Retorna o pacote criptografado com o bot, seu webhook e sua sessão, somente para o dono do bot
+func ExportBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	bot, ok := findAdminBot(w, r, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	passphrase := r.Header.Get(passphraseHeader)
+	if err := models.CheckBundlePassphrase(passphrase); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	bundle, err := models.ExportBotBundle(bot.ID, passphrase)
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	phone, _ := models.GetPhoneByID(bot.ID)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.qpbundle\"", phone))
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle)
+}
+
+// ImportBotAdminHandler renders route POST "/v2/admin/bot/import"
+// Recebe o pacote no corpo da requisição, cria o bot para o usuário atual e inicia seu servidor
+func ImportBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	bot, err := models.ImportBotBundle(data, r.Header.Get(passphraseHeader), user.ID)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	models.StartImportedBot(bot)
+	respondSuccess(w, bot)
+}
+
+//
+// Simulator
+//
+
+// SimulateBotAdminHandler renders route POST "/v2/admin/bot/simulate"
+// Cria um bot simulado para o usuário atual, sem celular, e inicia seu servidor
+func SimulateBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	bot, token, err := models.CreateSimulatedBot(user.ID)
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	admin := bot.ToAdminV2()
+	admin.Token = token
+	respondSuccess(w, admin)
+}
+
+//
+// Helpers
+//
+
+// Bot acessível ao usuário atual com no mínimo o papel exigido, responde com o erro caso contrário
+func findAdminBot(w http.ResponseWriter, r *http.Request, required models.QPRole) (bot models.QPBot, ok bool) {
+	access, ok := findAdminBotAccess(w, r, required)
+	return access.QPBot, ok
+}
+
+// Bot da rota com o papel do usuário atual sobre ele
+func findAdminBotAccess(w http.ResponseWriter, r *http.Request, required models.QPRole) (access models.QPBotAccess, ok bool) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	access, err = models.FindBotForUser(user.ID, chi.URLParam(r, "botID"), required)
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+	return access, true
+}
+
+// Semelhante ao authenticator das rotas web, mas responde em json ao invés de redirecionar
+// Aceita a chave de acesso do usuário no header ou o JWT
+func apiAuthenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, found, err := models.AuthenticateAPIKey(r)
+		if found {
+			if err != nil {
+				respondUnauthorized(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := models.GetUser(r)
+		if err != nil {
+			respondUnauthorized(w, fmt.Errorf("authentication required"))
+			return
+		}
+
+		if err := validateRequestSession(r); err != nil {
+			respondUnauthorized(w, err)
+			return
+		}
+
+		// Sessão web de quem ainda deve cadastrar o segundo fator exigido pela equipe
+		if models.RequiresTOTPEnrollment(user) {
+			respondForbidden(w, fmt.Errorf("two-factor enrollment required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
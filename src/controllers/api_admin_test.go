@@ -0,0 +1,522 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Rhymen/go-whatsapp"
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Usuários em memória, substitui o banco de dados nos testes
+type testUserStore struct {
+	users map[string]models.QPUser
+	sync  *sync.Mutex
+}
+
+func (store *testUserStore) find(match func(models.QPUser) bool) (models.QPUser, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, user := range store.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return models.QPUser{}, errors.New("user not found")
+}
+
+func (store *testUserStore) Count() (int, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	return len(store.users), nil
+}
+
+func (store *testUserStore) FindByID(ID string) (models.QPUser, error) {
+	return store.find(func(user models.QPUser) bool { return user.ID == ID })
+}
+
+func (store *testUserStore) FindByEmail(email string) (models.QPUser, error) {
+	return store.find(func(user models.QPUser) bool { return user.Email == email })
+}
+
+func (store *testUserStore) Exists(email string) (bool, error) {
+	_, err := store.FindByEmail(email)
+	return err == nil, nil
+}
+
+func (store *testUserStore) Check(email string, password string) (models.QPUser, error) {
+	return store.find(func(user models.QPUser) bool { return user.Email == email && user.Password == password })
+}
+
+func (store *testUserStore) Create(email string, password string) (models.QPUser, error) {
+	user := models.QPUser{ID: email, Email: email, Password: password}
+	store.sync.Lock()
+	store.users[user.ID] = user
+	store.sync.Unlock()
+	return user, nil
+}
+
+func (store *testUserStore) SetLifecycleWebHook(ID string, url string) error {
+	return store.update(ID, func(user *models.QPUser) { user.LifecycleWebHook = url })
+}
+
+func (store *testUserStore) SetAPIKey(ID string, hash string) error {
+	return store.update(ID, func(user *models.QPUser) { user.APIKey = hash })
+}
+
+func (store *testUserStore) FindByAPIKey(hash string) (models.QPUser, error) {
+	return store.find(func(user models.QPUser) bool { return len(user.APIKey) > 0 && user.APIKey == hash })
+}
+
+func (store *testUserStore) FindAll() (users []models.QPUser, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, user := range store.users {
+		users = append(users, user)
+	}
+	return
+}
+
+func (store *testUserStore) SetPassword(ID string, password string) error {
+	return store.update(ID, func(user *models.QPUser) {
+		user.Password, user.ResetToken, user.ResetExpires = password, "", ""
+	})
+}
+
+func (store *testUserStore) SetDisabled(ID string, disabled bool) error {
+	return store.update(ID, func(user *models.QPUser) { user.Disabled = disabled })
+}
+
+func (store *testUserStore) SetAdmin(ID string, admin bool) error {
+	return store.update(ID, func(user *models.QPUser) { user.Admin = admin })
+}
+
+func (store *testUserStore) SetResetToken(ID string, hash string, expires string) error {
+	return store.update(ID, func(user *models.QPUser) { user.ResetToken, user.ResetExpires = hash, expires })
+}
+
+func (store *testUserStore) FindByResetToken(hash string) (models.QPUser, error) {
+	return store.find(func(user models.QPUser) bool { return len(user.ResetToken) > 0 && user.ResetToken == hash })
+}
+
+func (store *testUserStore) SetTOTP(ID string, secret string, enabled bool, recovery string) error {
+	return store.update(ID, func(user *models.QPUser) {
+		user.TOTPSecret, user.TOTPEnabled, user.TOTPRecovery, user.TOTPLastStep = secret, enabled, recovery, 0
+	})
+}
+
+func (store *testUserStore) MarkTOTPStep(ID string, step int64) (ok bool, err error) {
+	err = store.update(ID, func(user *models.QPUser) {
+		if ok = user.TOTPLastStep < step; ok {
+			user.TOTPLastStep = step
+		}
+	})
+	return
+}
+
+func (store *testUserStore) ReplaceTOTPRecovery(ID string, previous string, recovery string) (ok bool, err error) {
+	err = store.update(ID, func(user *models.QPUser) {
+		if ok = user.TOTPRecovery == previous; ok {
+			user.TOTPRecovery = recovery
+		}
+	})
+	return
+}
+
+func (store *testUserStore) update(ID string, change func(*models.QPUser)) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	user, ok := store.users[ID]
+	if !ok {
+		return errors.New("user not found")
+	}
+	change(&user)
+	store.users[ID] = user
+	return nil
+}
+
+// Sessões em memória, somente o necessário para remover, exportar e importar bots
+type testSessionStore struct {
+	deleted []string
+	data    map[string][]byte
+}
+
+func (store *testSessionStore) FindAll() ([]models.QPStore, error) { return nil, nil }
+func (store *testSessionStore) Create(wid string) (models.QPStore, error) {
+	return models.QPStore{BotID: wid}, nil
+}
+func (store *testSessionStore) Get(wid string) (models.QPStore, error) {
+	return models.QPStore{BotID: wid, Data: store.data[wid]}, nil
+}
+func (store *testSessionStore) GetOrCreate(wid string) (models.QPStore, error) {
+	return store.Get(wid)
+}
+func (store *testSessionStore) Update(wid string, data []byte) ([]byte, error) {
+	store.data[wid] = data
+	return data, nil
+}
+func (store *testSessionStore) Exists(wid string) (bool, error) { return true, nil }
+func (store *testSessionStore) Delete(wid string) error {
+	store.deleted = append(store.deleted, wid)
+	return nil
+}
+
+// Sessões web em memória
+type testUserSessionStore struct {
+	sessions map[string]models.QPUserSession
+	sync     *sync.Mutex
+}
+
+func (store *testUserSessionStore) Create(session models.QPUserSession) error {
+	store.sync.Lock()
+	store.sessions[session.ID] = session
+	store.sync.Unlock()
+	return nil
+}
+
+func (store *testUserSessionStore) FindByID(ID string) (models.QPUserSession, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	if session, ok := store.sessions[ID]; ok {
+		return session, nil
+	}
+	return models.QPUserSession{}, errors.New("session not found")
+}
+
+func (store *testUserSessionStore) FindAllForUser(userID string) (sessions []models.QPUserSession, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, session := range store.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return
+}
+
+func (store *testUserSessionStore) Delete(userID string, ID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	if session, ok := store.sessions[ID]; ok && session.UserID == userID {
+		delete(store.sessions, ID)
+	}
+	return nil
+}
+
+func (store *testUserSessionStore) DeleteForUser(userID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for id, session := range store.sessions {
+		if session.UserID == userID {
+			delete(store.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (store *testUserSessionStore) Touch(ID string, lastSeen string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	if session, ok := store.sessions[ID]; ok {
+		session.LastSeen = lastSeen
+		store.sessions[ID] = session
+	}
+	return nil
+}
+
+func (store *testUserSessionStore) DeleteExpired(now string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for id, session := range store.sessions {
+		if session.ExpiresAt <= now {
+			delete(store.sessions, id)
+		}
+	}
+	return nil
+}
+
+// Prepara o servidor de testes com o dono do bot e uma chave de acesso válida
+func newAdminTestServer(t *testing.T) (apikey string, bots *testBotStore, sessions *testSessionStore) {
+	_, _, bots = newAPITestServer(t)
+
+	users := &testUserStore{map[string]models.QPUser{"user": {ID: "user", Email: "user@example.com"}}, &sync.Mutex{}}
+	sessions = &testSessionStore{data: map[string][]byte{}}
+	models.WhatsAppService.DB.User = users
+	models.WhatsAppService.DB.Store = sessions
+	models.WhatsAppService.DB.UserSession = &testUserSessionStore{map[string]models.QPUserSession{}, &sync.Mutex{}}
+
+	apikey, err := models.GenerateUserAPIKey("user")
+	if err != nil {
+		t.Fatalf("error generating api key: %s", err)
+	}
+	return
+}
+
+// Executa a requisição pelas rotas de administração, autenticada pela chave informada
+func serveAdmin(apikey string, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+
+	r := chi.NewRouter()
+	addAdminRoutes(r)
+
+	request := httptest.NewRequest(method, path, &payload)
+	if len(apikey) > 0 {
+		request.Header.Set(models.APIKeyHeader, apikey)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func TestAdminAPIKeyAuthentication(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+
+	if w := serveAdmin("", "GET", "/v2/admin/bots", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized without credentials, got %d", w.Code)
+	}
+
+	if w := serveAdmin("qpk_invalid", "GET", "/v2/admin/bots", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized for an invalid key, got %d", w.Code)
+	}
+
+	w := serveAdmin(apikey, "POST", "/v2/admin/apikey", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	var response models.QPAPIKeyResponseV2
+	decodeResponse(t, w, &response)
+	if response.Header != models.APIKeyHeader || len(response.Key) == 0 || response.Key == apikey {
+		t.Errorf("unexpected api key response: %#v", response)
+	}
+
+	// A chave anterior é revogada ao gerar uma nova
+	if w := serveAdmin(apikey, "GET", "/v2/admin/bots", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized for a revoked key, got %d", w.Code)
+	}
+
+	if w := serveAdmin(response.Key, "GET", "/v2/admin/bots", nil); w.Code != http.StatusOK {
+		t.Errorf("expected the new key to be accepted, got %d", w.Code)
+	}
+}
+
+func TestAdminBotHandlers(t *testing.T) {
+	apikey, bots, _ := newAdminTestServer(t)
+	bots.Create("5521977776666@c.us", "other", "")
+
+	w := serveAdmin(apikey, "GET", "/v2/admin/bots", nil)
+	var list []models.QPBotAdminV2
+	decodeResponse(t, w, &list)
+	if len(list) != 1 || list[0].ID != testBotID || list[0].State != models.Ready {
+		t.Fatalf("unexpected bots: %#v", list)
+	}
+
+	// Somente o hash é gravado, o token não volta nas consultas
+	if list[0].Token != "" {
+		t.Errorf("token listed: %#v", list[0])
+	}
+
+	if w := serveAdmin(apikey, "GET", "/v2/admin/bot/5521977776666@c.us", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found for a bot of another user, got %d", w.Code)
+	}
+
+	w = serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/devel", nil)
+	var bot models.QPBotAdminV2
+	decodeResponse(t, w, &bot)
+	if !bot.Devel {
+		t.Errorf("devel not toggled: %#v", bot)
+	}
+
+	w = serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/token", nil)
+	decodeResponse(t, w, &bot)
+	if len(bot.Token) == 0 || bot.Token == testToken {
+		t.Errorf("token not cycled: %#v", bot)
+	}
+
+	if stored, _ := bots.FindByID(testBotID); stored.TokenHash != models.HashAPIKey(bot.Token) {
+		t.Errorf("expected only the token hash stored, got %s", stored.TokenHash)
+	}
+
+	if w := serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/start", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request starting a running bot, got %d", w.Code)
+	}
+
+	w = serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/stop", nil)
+	decodeResponse(t, w, &bot)
+	if bot.State != models.Stopped {
+		t.Errorf("bot not stopped: %#v", bot)
+	}
+}
+
+func TestDeleteBotAdminHandler(t *testing.T) {
+	apikey, bots, sessions := newAdminTestServer(t)
+
+	if w := serveAdmin(apikey, "DELETE", "/v2/admin/bot/"+testBotID, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	if _, err := bots.FindByID(testBotID); err == nil {
+		t.Errorf("bot not deleted")
+	}
+
+	if len(sessions.deleted) != 1 || sessions.deleted[0] != testBotID {
+		t.Errorf("session not deleted: %v", sessions.deleted)
+	}
+
+	if _, ok := models.WhatsAppService.Servers.Get(testBotID); ok {
+		t.Errorf("server still registered")
+	}
+}
+
+// Executa a exportação ou a importação com a frase secreta informada e o corpo sem codificação
+func serveBundle(apikey string, path string, passphrase string, body []byte) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	addAdminRoutes(r)
+
+	request := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	request.Header.Set(models.APIKeyHeader, apikey)
+	request.Header.Set(passphraseHeader, passphrase)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+// Frase secreta forte o bastante para os pacotes de exportação
+const testPassphrase = "correct horse battery staple"
+
+func TestBotBundleRoundTrip(t *testing.T) {
+	_, bots, sessions := newAdminTestServer(t)
+	bots.update(testBotID, func(bot *models.QPBot) {
+		bot.WebHook = "https://example.com/hook"
+		bot.BatteryThreshold = -1
+		bot.UnpluggedAlert = true
+		bot.RateLimitSend = 5
+		bot.RateLimitAttachment = -1
+	})
+	models.WriteSession(testBotID, whatsapp.Session{ClientId: "client", Wid: testBotID})
+	apikey, _, err := models.CreateBotAPIKey(testBotID, models.QPBotAPIKeyRequestV2{Name: "crm", Scopes: []string{models.ScopeSend}})
+	if err != nil {
+		t.Fatalf("error creating api key: %s", err)
+	}
+
+	bundle, err := models.ExportBotBundle(testBotID, testPassphrase)
+	if err != nil {
+		t.Fatalf("error exporting: %s", err)
+	}
+
+	// Na outra instância o bot não existe ainda
+	bots.Delete(testBotID)
+	delete(sessions.data, testBotID)
+	models.WhatsAppService.DB.APIKey.DeleteForBot(testBotID)
+
+	bot, err := models.ImportBotBundle(bundle, testPassphrase, "user")
+	if err != nil {
+		t.Fatalf("error importing: %s", err)
+	}
+
+	stored, _ := bots.FindByID(testBotID)
+	if stored.WebHook != "https://example.com/hook" || !stored.Verified || stored.BatteryThreshold != -1 || !stored.UnpluggedAlert ||
+		stored.RateLimitSend != 5 || stored.RateLimitReceive != 0 || stored.RateLimitAttachment != -1 {
+		t.Errorf("settings not restored: %#v", stored)
+	}
+
+	if stored.TokenHash != models.HashAPIKey(testToken) || bot.TokenHash != stored.TokenHash {
+		t.Errorf("token not restored: %#v", stored)
+	}
+
+	if session, err := models.ReadSession(testBotID); err != nil || session.ClientId != "client" {
+		t.Errorf("session not restored: %#v, %v", session, err)
+	}
+
+	// As integrações continuam com o mesmo token e as mesmas chaves
+	if w := serveAPI("GET", "/v2/bot/"+testToken, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the exported token to be accepted, got %d", w.Code)
+	}
+
+	if _, err := models.AuthenticateBot(apikey, models.ScopeSend); err != nil {
+		t.Errorf("expected the exported api key to be accepted: %s", err)
+	}
+
+	// Reimportar sobre um bot com outro token volta ao token exportado
+	token, _ := bot.CycleToken()
+	if _, err := models.ImportBotBundle(bundle, testPassphrase, "user"); err != nil {
+		t.Fatalf("error importing again: %s", err)
+	}
+
+	if w := serveAPI("GET", "/v2/bot/"+token, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the local token to be replaced, got %d", w.Code)
+	}
+}
+
+func TestBotBundleSimulated(t *testing.T) {
+	_, bots, _ := newAdminTestServer(t)
+	bots.Simulate(testBotID, true)
+
+	// Bots simulados não têm sessão
+	bundle, err := models.ExportBotBundle(testBotID, testPassphrase)
+	if err != nil {
+		t.Fatalf("error exporting: %s", err)
+	}
+
+	bots.Delete(testBotID)
+	if _, err := models.ImportBotBundle(bundle, testPassphrase, "user"); err != nil {
+		t.Fatalf("error importing: %s", err)
+	}
+
+	if stored, _ := bots.FindByID(testBotID); !stored.Simulated || !stored.Verified {
+		t.Errorf("expected a verified simulated bot, got %#v", stored)
+	}
+}
+
+func TestBotBundleWeakPassphrase(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+	models.WriteSession(testBotID, whatsapp.Session{ClientId: "client", Wid: testBotID})
+
+	for _, passphrase := range []string{"", "secret"} {
+		w := serveBundle(apikey, "/v2/admin/bot/"+testBotID+"/export", passphrase, nil)
+		if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid passphrase")) {
+			t.Errorf("expected the passphrase %q to be rejected, got %d, %s", passphrase, w.Code, w.Body.String())
+		}
+	}
+
+	if w := serveBundle(apikey, "/v2/admin/bot/"+testBotID+"/export", testPassphrase, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the export to succeed, got %d, %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBotBundleImportRejected(t *testing.T) {
+	apikey, bots, _ := newAdminTestServer(t)
+	models.WriteSession(testBotID, whatsapp.Session{ClientId: "client", Wid: testBotID})
+
+	bundle, err := models.ExportBotBundle(testBotID, testPassphrase)
+	if err != nil {
+		t.Fatalf("error exporting: %s", err)
+	}
+	before, _ := bots.FindByID(testBotID)
+
+	w := serveBundle(apikey, "/v2/admin/bot/import", "wrong", bundle)
+	if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid passphrase")) {
+		t.Errorf("expected the wrong passphrase to be rejected, got %d, %s", w.Code, w.Body.String())
+	}
+
+	if after, _ := bots.FindByID(testBotID); after != before {
+		t.Errorf("bot changed by a rejected import: %#v", after)
+	}
+
+	// Pacotes têm poucos KB, corpos maiores são recusados antes de qualquer processamento
+	oversized := append(append([]byte{}, bundle...), make([]byte, maxBundleSize)...)
+	if w := serveBundle(apikey, "/v2/admin/bot/import", testPassphrase, oversized); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an oversized body to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+type contextKey string
+
+// Bot já autenticado pelo botAuthenticator
+const botContextKey contextKey = "quepasa_bot"
+
+// Credencial do bot na requisição, pelo caminho da url (legado) ou pelos headers
+func getRequestToken(r *http.Request) string {
+	if token := chi.URLParam(r, "token"); len(token) > 0 {
+		return token
+	}
+
+	if token := r.Header.Get(models.TokenHeader); len(token) > 0 {
+		return token
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// Autentica o bot pelo token ou por uma chave de acesso com o escopo informado
+// Escopo vazio aceita qualquer chave válida do bot
+func botAuthenticator(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := getRequestToken(r)
+			if len(token) == 0 {
+				respondUnauthorized(w, fmt.Errorf("token not informed, use the %s or Authorization: Bearer header", models.TokenHeader))
+				return
+			}
+
+			bot, err := models.AuthenticateBot(token, scope)
+			switch err {
+			case nil:
+			case models.ErrAPIKeyExpired:
+				respondUnauthorized(w, err)
+				return
+			case models.ErrAPIKeyScope:
+				respondError(w, fmt.Errorf("%s: %s", err, scope), http.StatusForbidden)
+				return
+			default:
+				respondNotFound(w, fmt.Errorf("Token not found"))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), botContextKey, bot)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Bot autenticado para esta requisição
+func getRequestBot(r *http.Request) models.QPBot {
+	bot, _ := r.Context().Value(botContextKey).(models.QPBot)
+	return bot
+}
+
+// Registra a rota com o token no caminho (legado) e somente com o token nos headers
+func botRoute(r chi.Router, method string, version string, pattern string, handler http.HandlerFunc) {
+	r.MethodFunc(method, "/"+version+"/bot/{token}"+pattern, handler)
+	r.MethodFunc(method, "/"+version+"/bot"+pattern, handler)
+}
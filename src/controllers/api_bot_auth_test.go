@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Executa a requisição pelas rotas da API com os headers informados
+func serveAPIWithHeaders(method string, path string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+
+	r := chi.NewRouter()
+	addAPIRoutes(r)
+
+	request := httptest.NewRequest(method, path, &payload)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func TestBotTokenFromHeaders(t *testing.T) {
+	newAPITestServer(t)
+
+	if w := serveAPIWithHeaders("GET", "/v2/bot", map[string]string{models.TokenHeader: testToken}, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the token header to be accepted, got %d", w.Code)
+	}
+
+	if w := serveAPIWithHeaders("GET", "/v2/bot/status", map[string]string{"Authorization": "Bearer " + testToken}, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the bearer token to be accepted, got %d", w.Code)
+	}
+
+	if w := serveAPIWithHeaders("GET", "/v1/bot", map[string]string{models.TokenHeader: testToken}, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the token header on v1, got %d", w.Code)
+	}
+
+	if w := serveAPIWithHeaders("GET", "/v2/bot/receive", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized without token, got %d", w.Code)
+	}
+
+	if w := serveAPIWithHeaders("GET", "/v2/bot/receive", map[string]string{models.TokenHeader: "unknown"}, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found for an unknown token, got %d", w.Code)
+	}
+}
+
+func TestScopedBotAPIKeys(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+
+	invalid := models.QPBotAPIKeyRequestV2{Name: "reader", Scopes: []string{"everything"}}
+	if w := serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/apikeys", invalid); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for an invalid scope, got %d", w.Code)
+	}
+
+	request := models.QPBotAPIKeyRequestV2{Name: "reader", Scopes: []string{models.ScopeReceive}}
+	w := serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/apikeys", request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	var created models.QPBotAPIKeyV2
+	decodeResponse(t, w, &created)
+	if len(created.Key) == 0 || created.Name != "reader" {
+		t.Fatalf("unexpected api key: %#v", created)
+	}
+
+	headers := map[string]string{models.TokenHeader: created.Key}
+	if w := serveAPIWithHeaders("GET", "/v2/bot/receive", headers, nil); w.Code != http.StatusOK {
+		t.Errorf("expected receive to be allowed, got %d", w.Code)
+	}
+
+	if w := serveAPIWithHeaders("GET", "/v2/bot", headers, nil); w.Code != http.StatusOK {
+		t.Errorf("expected info to be allowed for any scope, got %d", w.Code)
+	}
+
+	send := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	if w := serveAPIWithHeaders("POST", "/v2/bot/sendtext", headers, send); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden without the send scope, got %d", w.Code)
+	}
+
+	// A chave nunca é listada, somente o uso
+	w = serveAdmin(apikey, "GET", "/v2/admin/bot/"+testBotID+"/apikeys", nil)
+	var keys []models.QPBotAPIKeyV2
+	decodeResponse(t, w, &keys)
+	if len(keys) != 1 || len(keys[0].Key) > 0 || len(keys[0].LastUsed) == 0 {
+		t.Errorf("unexpected api keys: %#v", keys)
+	}
+
+	if w := serveAdmin(apikey, "DELETE", "/v2/admin/bot/"+testBotID+"/apikeys/"+created.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	if w := serveAPIWithHeaders("GET", "/v2/bot/receive", headers, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected a revoked key to be rejected, got %d", w.Code)
+	}
+}
+
+func TestExpiredBotAPIKey(t *testing.T) {
+	newAPITestServer(t)
+
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	key, apikey, err := models.CreateBotAPIKey(testBotID, models.QPBotAPIKeyRequestV2{Name: "temp", Scopes: []string{models.ScopeSend}, ExpiresAt: expires})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	send := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	headers := map[string]string{"Authorization": "Bearer " + key}
+	if w := serveAPIWithHeaders("POST", "/v2/bot/sendtext", headers, send); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	apikey.ExpiresAt = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	models.WhatsAppService.DB.APIKey.Create(apikey)
+	if w := serveAPIWithHeaders("POST", "/v2/bot/sendtext", headers, send); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized for an expired key, got %d", w.Code)
+	}
+
+	past := models.QPBotAPIKeyRequestV2{Name: "past", Scopes: []string{models.ScopeSend}, ExpiresAt: apikey.ExpiresAt}
+	if _, _, err := models.CreateBotAPIKey(testBotID, past); err == nil {
+		t.Errorf("expected error creating an already expired key")
+	}
+}
+
+// Valor atual do contador de uso do token anterior para o bot de testes
+func previousTokenUses(t *testing.T) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("error gathering metrics: %s", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "quepasa_bot_previous_token_used_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestTokenRotationGracePeriod(t *testing.T) {
+	apikey, bots, _ := newAdminTestServer(t)
+
+	w := serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/token", nil)
+	var bot models.QPBotAdminV2
+	decodeResponse(t, w, &bot)
+	if len(bot.Token) == 0 || bot.Token == testToken || len(bot.PreviousTokenExpires) == 0 {
+		t.Fatalf("unexpected rotation: %#v", bot)
+	}
+
+	before := previousTokenUses(t)
+	if w := serveAPI("GET", "/v2/bot/"+testToken, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the previous token to be accepted, got %d", w.Code)
+	}
+
+	if w := serveAPI("GET", "/v2/bot/"+bot.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the new token to be accepted, got %d", w.Code)
+	}
+
+	if uses := previousTokenUses(t); uses != before+1 {
+		t.Errorf("expected the previous token use to be counted once, got %v", uses-before)
+	}
+
+	bots.update(testBotID, func(bot *models.QPBot) {
+		bot.PreviousTokenExpires = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	})
+	if w := serveAPI("GET", "/v2/bot/"+testToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the expired previous token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestTokenRotationWithoutGracePeriod(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+
+	os.Setenv("TOKENGRACEPERIOD", "0")
+	defer os.Unsetenv("TOKENGRACEPERIOD")
+
+	w := serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/token", nil)
+	var bot models.QPBotAdminV2
+	decodeResponse(t, w, &bot)
+	if len(bot.Token) == 0 || len(bot.PreviousTokenExpires) > 0 {
+		t.Errorf("unexpected previous token: %#v", bot)
+	}
+
+	if w := serveAPI("GET", "/v2/bot/"+testToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the previous token to be rejected at once, got %d", w.Code)
+	}
+}
+
+func TestLegacyBotTokensHashed(t *testing.T) {
+	_, _, bots := newAPITestServer(t)
+	bots.update(testBotID, func(bot *models.QPBot) {
+		bot.TokenHash = testToken
+		bot.PreviousTokenHash = "legacy-previous"
+		bot.PreviousTokenExpires = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	})
+
+	if err := models.HashLegacyBotTokens(); err != nil {
+		t.Fatalf("error hashing legacy tokens: %s", err)
+	}
+
+	bot, _ := bots.FindByID(testBotID)
+	if bot.TokenHash != models.HashAPIKey(testToken) || bot.PreviousTokenHash != models.HashAPIKey("legacy-previous") {
+		t.Fatalf("legacy tokens not hashed: %#v", bot)
+	}
+
+	// Converter novamente não altera os hashes, as integrações seguem com o mesmo token
+	models.HashLegacyBotTokens()
+	if w := serveAPI("GET", "/v2/bot/"+testToken, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the legacy token to be accepted, got %d", w.Code)
+	}
+
+	if w := serveAPI("GET", "/v2/bot/"+models.HashAPIKey(testToken), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the stored hash to be rejected as a token, got %d", w.Code)
+	}
+}
@@ -3,29 +3,22 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/Rhymen/go-whatsapp"
-	"github.com/go-chi/chi"
 	"github.com/sufficit/sufficit-quepasa-fork/models"
 )
 
 // SendAPIHandler renders route "/v1/bot/{token}/send"
 func SendAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Declare a new Person struct.
 	var request models.QPSendRequest
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&request)
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		respondServerError(bot, w, err)
 		return
@@ -53,15 +46,10 @@ func SendAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
 
 // ReceiveAPIHandler renders route GET "/v1/bot/{token}/receive"
 func ReceiveAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Evitando tentativa de download de anexos sem o bot estar devidamente sincronizado
-	if bot.GetStatus() != "ready" {
+	if !bot.IsReady() {
 		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
 		return
 	}
@@ -88,12 +76,7 @@ func ReceiveAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
 
 // InfoAPIHandler renders route GET "/v1/bot/{token}"
 func InfoAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	var ep models.QPEndPoint
 	ep.ID = bot.ID
@@ -108,32 +91,25 @@ func InfoAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
 }
 
 func WebHookAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found on WebHookHandler", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Declare a new Person struct.
 	var p models.QPReqWebHook
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&p)
+	err := json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
 		respondServerError(bot, w, err)
 	}
 
-	server, ok := models.WhatsAppService.Servers[bot.ID]
+	server, ok := models.GetServer(bot.ID)
 	if ok {
-		bot = server.Bot
+		bot = server.GetBot()
 	}
 
 	// Já tratei os parametros
-	if models.ENV.IsDevelopment() {
-		log.Printf("(%s) Updating Webhook: %s", server.Bot.GetNumber(), p.Url)
-	}
+	getBotLogger(r, bot).Debugf("updating webhook: %s", p.Url)
 
 	bot.WebHook = p.Url
 	// Atualizando banco de dados
@@ -146,15 +122,10 @@ func WebHookAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
 
 // AttachmentHandler renders route POST "/v1/bot/{token}/attachment"
 func AttachmentAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Evitando tentativa de download de anexos sem o bot estar devidamente sincronizado
-	if bot.GetStatus() != "ready" {
+	if !bot.IsReady() {
 		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
 		return
 	}
@@ -164,7 +135,7 @@ func AttachmentAPIHandlerV1(w http.ResponseWriter, r *http.Request) {
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&p)
+	err := json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
 		respondServerError(bot, w, err)
 	}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rhymen/go-whatsapp"
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+const (
+	testBotID     = "5521999990000@c.us"
+	testToken     = "test-token"
+	testRecipient = "5521988887777@s.whatsapp.net"
+)
+
+// Bots em memória, substitui o banco de dados nos testes
+type testBotStore struct {
+	bots map[string]models.QPBot
+	sync *sync.Mutex
+}
+
+func (store *testBotStore) find(match func(models.QPBot) bool) (models.QPBot, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, bot := range store.bots {
+		if match(bot) {
+			return bot, nil
+		}
+	}
+	return models.QPBot{}, errors.New("bot not found")
+}
+
+func (store *testBotStore) update(id string, change func(*models.QPBot)) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	bot, ok := store.bots[id]
+	if !ok {
+		return errors.New("bot not found")
+	}
+	change(&bot)
+	store.bots[id] = bot
+	return nil
+}
+
+func (store *testBotStore) FindAll() (bots []models.QPBot, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, bot := range store.bots {
+		bots = append(bots, bot)
+	}
+	return
+}
+
+func (store *testBotStore) FindAllForUser(userID string) (bots []models.QPBot, err error) {
+	all, _ := store.FindAll()
+	for _, bot := range all {
+		if bot.UserID == userID {
+			bots = append(bots, bot)
+		}
+	}
+	return
+}
+
+func (store *testBotStore) FindByTokenHash(hash string) (models.QPBot, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return store.find(func(bot models.QPBot) bool {
+		return bot.TokenHash == hash || (bot.PreviousTokenHash == hash && bot.PreviousTokenExpires > now)
+	})
+}
+
+func (store *testBotStore) FindForUser(userID string, ID string) (models.QPBot, error) {
+	return store.find(func(bot models.QPBot) bool { return bot.UserID == userID && bot.ID == ID })
+}
+
+func (store *testBotStore) FindByID(botID string) (models.QPBot, error) {
+	return store.find(func(bot models.QPBot) bool { return bot.ID == botID })
+}
+
+func (store *testBotStore) GetOrCreate(botID string, userID string, tokenHash string) (models.QPBot, error) {
+	if bot, err := store.FindByID(botID); err == nil {
+		return bot, nil
+	}
+	return store.Create(botID, userID, tokenHash)
+}
+
+func (store *testBotStore) Create(botID string, userID string, tokenHash string) (models.QPBot, error) {
+	bot := models.QPBot{ID: botID, UserID: userID, TokenHash: tokenHash}
+	store.sync.Lock()
+	store.bots[botID] = bot
+	store.sync.Unlock()
+	return bot, nil
+}
+
+func (store *testBotStore) MarkVerified(id string, ok bool) error {
+	return store.update(id, func(bot *models.QPBot) { bot.Verified = ok })
+}
+
+func (store *testBotStore) CycleToken(id string, tokenHash string, previousExpires string) error {
+	return store.update(id, func(bot *models.QPBot) {
+		bot.PreviousTokenHash, bot.PreviousTokenExpires = "", previousExpires
+		if len(previousExpires) > 0 {
+			bot.PreviousTokenHash = bot.TokenHash
+		}
+		bot.TokenHash = tokenHash
+	})
+}
+
+func (store *testBotStore) SetTokenHashes(id string, tokenHash string, previousTokenHash string) error {
+	return store.update(id, func(bot *models.QPBot) {
+		bot.TokenHash, bot.PreviousTokenHash = tokenHash, previousTokenHash
+	})
+}
+
+func (store *testBotStore) Delete(id string) error {
+	store.sync.Lock()
+	delete(store.bots, id)
+	store.sync.Unlock()
+	return nil
+}
+
+func (store *testBotStore) WebHookUpdate(webhook string, id string) error {
+	return store.update(id, func(bot *models.QPBot) { bot.WebHook = webhook })
+}
+
+func (store *testBotStore) WebHookSincronize(id string) (string, error) {
+	bot, err := store.FindByID(id)
+	return bot.WebHook, err
+}
+
+func (store *testBotStore) Devel(id string, status bool) error {
+	return store.update(id, func(bot *models.QPBot) { bot.Devel = status })
+}
+
+func (store *testBotStore) Archive(id string, status bool) error {
+	return store.update(id, func(bot *models.QPBot) { bot.Archive = status })
+}
+
+func (store *testBotStore) BatteryAlerts(id string, threshold int, unplugged bool) error {
+	return store.update(id, func(bot *models.QPBot) {
+		bot.BatteryThreshold = threshold
+		bot.UnpluggedAlert = unplugged
+	})
+}
+
+func (store *testBotStore) Simulate(id string, status bool) error {
+	return store.update(id, func(bot *models.QPBot) { bot.Simulated = status })
+}
+
+func (store *testBotStore) RateLimits(id string, send int, receive int, attachment int) error {
+	return store.update(id, func(bot *models.QPBot) {
+		bot.RateLimitSend = send
+		bot.RateLimitReceive = receive
+		bot.RateLimitAttachment = attachment
+	})
+}
+
+// Chaves de acesso dos bots em memória
+type testAPIKeyStore struct {
+	keys map[string]models.QPBotAPIKey
+	sync *sync.Mutex
+}
+
+func (store *testAPIKeyStore) FindAllForBot(botID string) (keys []models.QPBotAPIKey, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, key := range store.keys {
+		if key.BotID == botID {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+func (store *testAPIKeyStore) FindByHash(hash string) (models.QPBotAPIKey, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, key := range store.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return models.QPBotAPIKey{}, errors.New("api key not found")
+}
+
+func (store *testAPIKeyStore) Create(key models.QPBotAPIKey) error {
+	store.sync.Lock()
+	store.keys[key.ID] = key
+	store.sync.Unlock()
+	return nil
+}
+
+func (store *testAPIKeyStore) Delete(botID string, ID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	if key, ok := store.keys[ID]; ok && key.BotID == botID {
+		delete(store.keys, ID)
+	}
+	return nil
+}
+
+func (store *testAPIKeyStore) DeleteForBot(botID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for id, key := range store.keys {
+		if key.BotID == botID {
+			delete(store.keys, id)
+		}
+	}
+	return nil
+}
+
+func (store *testAPIKeyStore) MarkUsed(ID string, when string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	if key, ok := store.keys[ID]; ok {
+		key.LastUsed = when
+		store.keys[ID] = key
+	}
+	return nil
+}
+
+// Prepara o serviço com um bot verificado e pronto sobre a conexão falsa
+func newAPITestServer(t *testing.T) (*models.QPWhatsAppServer, *models.QPFakeConnection, *testBotStore) {
+	bot := models.QPBot{ID: testBotID, TokenHash: models.HashAPIKey(testToken), Verified: true, UserID: "user"}
+	bots := &testBotStore{map[string]models.QPBot{bot.ID: bot}, &sync.Mutex{}}
+
+	con := models.NewQPFakeConnection(testBotID)
+	con.AddContact(whatsapp.Contact{Jid: testRecipient, Name: "Fulano"})
+	server := models.AppendFakeServer(bot, con)
+	t.Cleanup(func() { models.WhatsAppService.Servers.Remove(testBotID) })
+
+	keys := &testAPIKeyStore{map[string]models.QPBotAPIKey{}, &sync.Mutex{}}
+	setTestDatabase(t, &models.QPDatabase{Bot: bots, APIKey: keys, Team: newTestTeamStore()})
+	resetTestLimiters(t, models.BotRateLimiter, models.IPRateLimiter)
+	return server, con, bots
+}
+
+// Substitui o banco de dados do serviço durante o teste, restaurando o anterior ao final
+func setTestDatabase(t *testing.T, db *models.QPDatabase) {
+	previous := models.WhatsAppService.DB
+	models.WhatsAppService.DB = db
+	t.Cleanup(func() { models.WhatsAppService.DB = previous })
+}
+
+// Zera os limitadores globais utilizados pelo teste, no início e ao final
+func resetTestLimiters(t *testing.T, limiters ...interface{ Reset() }) {
+	for _, limiter := range limiters {
+		limiter.Reset()
+	}
+
+	t.Cleanup(func() {
+		for _, limiter := range limiters {
+			limiter.Reset()
+		}
+	})
+}
+
+// Executa a requisição pelas mesmas rotas da API
+func serveAPI(method string, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+
+	r := chi.NewRouter()
+	addAPIRoutes(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, &payload))
+	return w
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, out interface{}) {
+	if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+		t.Fatalf("error decoding response: %s", err)
+	}
+}
+
+func TestInfoAPIHandlerV1(t *testing.T) {
+	newAPITestServer(t)
+
+	w := serveAPI("GET", "/v1/bot/"+testToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var ep models.QPEndPoint
+	decodeResponse(t, w, &ep)
+	if ep.ID != testBotID || ep.Phone != "+5521999990000" || ep.Status != "verified" {
+		t.Errorf("unexpected endpoint: %#v", ep)
+	}
+
+	if w := serveAPI("GET", "/v1/bot/unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found, got %d", w.Code)
+	}
+}
+
+func TestSendAPIHandlerV1(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+
+	request := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	w := serveAPI("POST", "/v1/bot/"+testToken+"/send", request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	var response models.QPSendResponse
+	decodeResponse(t, w, &response)
+	if response.Result == nil || len(response.Result.MessageId) == 0 || response.Result.Recipient != testRecipient {
+		t.Errorf("unexpected response: %#v", response.Result)
+	}
+
+	if sent := con.Sent(); len(sent) != 1 {
+		t.Errorf("expected 1 sent message, got %d", len(sent))
+	}
+}
+
+func TestSendAPIHandlerV1Errors(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+
+	con.ScriptSendError(errors.New("scripted failure"))
+	request := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	if w := serveAPI("POST", "/v1/bot/"+testToken+"/send", request); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected server error, got %d", w.Code)
+	}
+
+	request.Recipient = "5521988887777"
+	if w := serveAPI("POST", "/v1/bot/"+testToken+"/send", request); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected server error for incomplete recipient, got %d", w.Code)
+	}
+
+	if w := serveAPI("POST", "/v1/bot/unknown/send", request); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found, got %d", w.Code)
+	}
+}
+
+func TestReceiveAPIHandlerV1(t *testing.T) {
+	server, con, _ := newAPITestServer(t)
+
+	for i := 1; i <= 3; i++ {
+		con.Receive(whatsapp.TextMessage{
+			Info: whatsapp.MessageInfo{Id: fmt.Sprintf("MSG%d", i), RemoteJid: testRecipient, Timestamp: uint64(1600000000 + i)},
+			Text: "mensagem",
+		})
+	}
+
+	w := serveAPI("GET", "/v1/bot/"+testToken+"/receive?timestamp=1600000002", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	// Mais recentes primeiro
+	var response receiveResponse
+	decodeResponse(t, w, &response)
+	if len(response.Messages) != 2 || response.Messages[0].ID != "MSG3" || response.Messages[1].ID != "MSG2" {
+		t.Errorf("unexpected messages: %#v", response.Messages)
+	}
+
+	// Celular sem responder, não entrega mensagens
+	con.Fail(errors.New("keepAlive failed"))
+	if w := serveAPI("GET", "/v1/bot/"+testToken+"/receive", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready, got %d", w.Code)
+	}
+
+	if state := server.State.Get(); state != models.Unreachable {
+		t.Errorf("expected unreachable, got %s", state)
+	}
+}
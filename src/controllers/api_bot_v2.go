@@ -3,8 +3,8 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"strings"
 
 	"github.com/Rhymen/go-whatsapp"
 	"github.com/go-chi/chi"
@@ -14,19 +14,14 @@ import (
 
 // SendAPIHandler renders route "/v2/bot/{token}/send"
 func SendTextAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Declare a new Person struct.
 	var request models.QPSendRequest
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&request)
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		respondServerError(bot, w, err)
 		return
@@ -52,19 +47,14 @@ func SendTextAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 
 // Usado para envio de documentos, anexos, separados do texto, em caso de imagem, aceita um caption (titulo)
 func SendDocumentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Declare a new Person struct.
 	var request models.QPSendDocumentRequestV2
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&request)
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		respondServerError(bot, w, err)
 		return
@@ -90,17 +80,10 @@ func SendDocumentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 
 // ReceiveAPIHandler renders route GET "/v1/bot/{token}/receive"
 func ReceiveAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("ReceiveAPIHandlerV2: %+v\n", r)
-
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Evitando tentativa de download de anexos sem o bot estar devidamente sincronizado
-	if bot.GetStatus() != "ready" {
+	if !bot.IsReady() {
 		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
 		return
 	}
@@ -131,12 +114,7 @@ func ReceiveAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 
 // InfoAPIHandler renders route GET "/v1/bot/{token}"
 func InfoAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	var ep models.QPEndPoint
 	ep.ID = bot.ID
@@ -151,32 +129,25 @@ func InfoAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 }
 
 func WebHookAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found on WebHookHandler", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Declare a new Person struct.
 	var p models.QPReqWebHook
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&p)
+	err := json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
 		respondServerError(bot, w, err)
 	}
 
-	server, ok := models.WhatsAppService.Servers[bot.ID]
+	server, ok := models.GetServer(bot.ID)
 	if ok {
-		bot = server.Bot
+		bot = server.GetBot()
 	}
 
 	// Já tratei os parametros
-	if models.ENV.IsDevelopment() {
-		log.Printf("(%s) Updating Webhook: %s", server.Bot.GetNumber(), p.Url)
-	}
+	getBotLogger(r, bot).Debugf("updating webhook: %s", p.Url)
 
 	bot.WebHook = p.Url
 	// Atualizando banco de dados
@@ -189,15 +160,10 @@ func WebHookAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 
 // AttachmentHandler renders route POST "/v1/bot/{token}/attachment"
 func AttachmentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	bot, err := models.WhatsAppService.DB.Bot.FindByToken(token)
-	if err != nil {
-		respondNotFound(w, fmt.Errorf("Token '%s' not found", token))
-		return
-	}
+	bot := getRequestBot(r)
 
 	// Evitando tentativa de download de anexos sem o bot estar devidamente sincronizado
-	if bot.GetStatus() != "ready" {
+	if !bot.IsReady() {
 		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
 		return
 	}
@@ -207,7 +173,7 @@ func AttachmentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 
 	// Try to decode the request body into the struct. If there is an error,
 	// respond to the client with the error message and a 400 status code.
-	err = json.NewDecoder(r.Body).Decode(&p)
+	err := json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
 		respondServerError(bot, w, err)
 	}
@@ -230,3 +196,320 @@ func AttachmentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", p.MIME)
 	w.Write(data)
 }
+
+//
+// Presence
+//
+
+// PresenceSubscribeAPIHandlerV2 renders route POST "/v2/bot/{token}/presence"
+// Assina as atualizações de presença (online, visto por último, digitando) de um contato
+func PresenceSubscribeAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
+		return
+	}
+
+	var request models.QPPresenceRequestV2
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	err = library.SendValidate(bot.ID, request.Recipient)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	err = server.SubscribePresence(request.Recipient)
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	respondSuccess(w, request)
+}
+
+// PresenceAPIHandlerV2 renders route GET "/v2/bot/{token}/presence"
+// Retorna a última presença conhecida de cada contato assinado
+func PresenceAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
+		return
+	}
+
+	respondSuccess(w, server.GetPresences())
+}
+
+// EventsAPIHandlerV2 renders route GET "/v2/bot/{token}/events"
+// Stream (text/event-stream) com os eventos do bot, o cliente deve reconectar ao expirar o timeout da requisição
+func EventsAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondServerError(bot, w, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	events := server.Events.Subscribe()
+	defer server.Events.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-webStreamsClosing:
+			return
+		case event := <-events:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// MessageAttachmentAPIHandlerV2 renders route GET "/v2/bot/{token}/message/{id}/attachment"
+// Faz o download do anexo de uma mensagem recebida, usando o cache local quando possível
+func MessageAttachmentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
+		return
+	}
+
+	messageID := chi.URLParam(r, "id")
+	attachment, file, hash, err := server.DownloadAttachment(messageID)
+	switch {
+	case err == models.ErrMessageNotFound:
+		respondNotFound(w, fmt.Errorf("Message '%s' not found", messageID))
+		return
+	case err == models.ErrAttachmentNotFound:
+		respondNotFound(w, fmt.Errorf("Message '%s' has no attachment", messageID))
+		return
+	case err != nil:
+		respondServerError(bot, w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	// Somente o mime, sem informações adicionais (; wa-document)
+	mime := strings.TrimSpace(strings.Split(attachment.MIME, ";")[0])
+	if len(mime) > 0 {
+		w.Header().Set("Content-Type", mime)
+	}
+
+	if len(attachment.FileName) > 0 {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.FileName))
+	}
+
+	// Conteúdo endereçado pelo hash, nunca muda para a mesma mensagem
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", hash))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+
+	// Trata Range, If-None-Match, If-Modified-Since e afins
+	http.ServeContent(w, r, attachment.FileName, info.ModTime(), file)
+}
+
+//
+// Status
+//
+
+// StatusAPIHandlerV2 renders route GET "/v2/bot/{token}/status"
+// Estado da conexão, bateria e aparelho
+func StatusAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	respondSuccess(w, bot.GetBotStatus())
+}
+
+// BatteryAPIHandlerV2 renders route POST "/v2/bot/{token}/battery"
+// Configura os alertas de bateria fraca e carregador removido
+func BatteryAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	var request models.QPBatteryRequestV2
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	if request.Threshold > 100 {
+		respondBadRequest(w, fmt.Errorf("threshold must be at most 100"))
+		return
+	}
+
+	err = bot.SetBatteryAlerts(request.Threshold, request.Unplugged)
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	respondSuccess(w, bot.GetBotStatus())
+}
+
+//
+// Log
+//
+
+// LogLevelAPIHandlerV2 renders route GET "/v2/bot/{token}/loglevel"
+func LogLevelAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	respondSuccess(w, models.QPLogLevelRequestV2{Level: bot.GetLogger().Level().String()})
+}
+
+// SetLogLevelAPIHandlerV2 renders route POST "/v2/bot/{token}/loglevel"
+// Altera o nível de log somente enquanto o bot estiver em execução
+func SetLogLevelAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not running"))
+		return
+	}
+
+	var request models.QPLogLevelRequestV2
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	if len(request.Level) == 0 {
+		err = server.Log.SetLevel(nil)
+	} else {
+		var level models.QPLogLevel
+		level, err = models.ParseLogLevel(request.Level)
+		if err != nil {
+			respondBadRequest(w, err)
+			return
+		}
+		err = server.Log.SetLevel(&level)
+	}
+
+	if err != nil {
+		respondServerError(bot, w, err)
+		return
+	}
+
+	getBotLogger(r, bot).Infof("log level changed to %s", server.Log.Level())
+	respondSuccess(w, models.QPLogLevelRequestV2{Level: server.Log.Level().String()})
+}
+
+//
+// Simulator
+//
+
+// InjectAPIHandlerV2 renders route POST "/v2/bot/{token}/inject"
+// Entrega uma mensagem ao bot simulado como se tivesse chegado do whatsapp
+func InjectAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	if !bot.Simulated {
+		respondBadRequest(w, fmt.Errorf("bot is not simulated"))
+		return
+	}
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not running"))
+		return
+	}
+
+	var request models.QPInjectRequestV2
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	err = server.Inject(&request)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	respondSuccess(w, request)
+}
+
+// SentAPIHandlerV2 renders route GET "/v2/bot/{token}/sent"
+// Mensagens enviadas pelo bot simulado, na ordem de envio
+func SentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	if !bot.Simulated {
+		respondBadRequest(w, fmt.Errorf("bot is not simulated"))
+		return
+	}
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not running"))
+		return
+	}
+
+	messages, err := server.GetSimulatedSent()
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	respondSuccess(w, messages)
+}
+
+// ClearSentAPIHandlerV2 renders route DELETE "/v2/bot/{token}/sent"
+// Retorna e descarta as mensagens enviadas pelo bot simulado
+func ClearSentAPIHandlerV2(w http.ResponseWriter, r *http.Request) {
+	bot := getRequestBot(r)
+
+	if !bot.Simulated {
+		respondBadRequest(w, fmt.Errorf("bot is not simulated"))
+		return
+	}
+
+	server, ok := models.GetServer(bot.ID)
+	if !ok {
+		respondNotReady(w, fmt.Errorf("bot not running"))
+		return
+	}
+
+	messages, err := server.TakeSimulatedSent()
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	respondSuccess(w, messages)
+}
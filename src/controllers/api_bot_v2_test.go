@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rhymen/go-whatsapp"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+func TestInfoAPIHandlerV2(t *testing.T) {
+	newAPITestServer(t)
+
+	w := serveAPI("GET", "/v2/bot/"+testToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	if w := serveAPI("GET", "/v2/bot/unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found, got %d", w.Code)
+	}
+}
+
+func TestSendTextAPIHandlerV2(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+
+	request := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	w := serveAPI("POST", "/v2/bot/"+testToken+"/sendtext", request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	var response models.QPSendResponseV2
+	decodeResponse(t, w, &response)
+	if len(response.ID) == 0 || response.ID != response.PreviusV1.MessageId {
+		t.Errorf("unexpected message id: %#v", response)
+	}
+
+	if response.Chat.ID != testRecipient || response.Chat.Title != "Fulano" || response.From.ID != testBotID {
+		t.Errorf("unexpected endpoints: %#v", response)
+	}
+
+	sent := con.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 sent message, got %d", len(sent))
+	}
+
+	if msg, ok := sent[0].(whatsapp.TextMessage); !ok || msg.Text != "olá" {
+		t.Errorf("unexpected message sent: %#v", sent[0])
+	}
+}
+
+func TestSendTextAPIHandlerV2Errors(t *testing.T) {
+	server, con, _ := newAPITestServer(t)
+
+	con.ScriptSendError(errors.New("scripted failure"))
+	request := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/sendtext", request); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected server error, got %d", w.Code)
+	}
+
+	server.State.Transition(models.Unreachable, "test")
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/sendtext", request); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected server error when not ready, got %d", w.Code)
+	}
+
+	if sent := con.Sent(); len(sent) != 0 {
+		t.Errorf("expected nothing sent, got %d", len(sent))
+	}
+}
+
+func TestSendDocumentAPIHandlerV2(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+
+	request := models.QPSendDocumentRequestV2{
+		Recipient: testRecipient,
+		Attachment: models.QPAttachment{
+			MIME:     "application/pdf",
+			FileName: "documento.pdf",
+			Base64:   base64.StdEncoding.EncodeToString([]byte("%PDF")),
+			Length:   4,
+		},
+	}
+
+	w := serveAPI("POST", "/v2/bot/"+testToken+"/senddocument", request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	sent := con.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 sent message, got %d", len(sent))
+	}
+
+	if msg, ok := sent[0].(whatsapp.DocumentMessage); !ok || msg.FileName != "documento.pdf" {
+		t.Errorf("unexpected message sent: %#v", sent[0])
+	}
+}
+
+func TestReceiveAPIHandlerV2(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+
+	con.Receive(whatsapp.TextMessage{
+		Info: whatsapp.MessageInfo{Id: "MSG1", RemoteJid: testRecipient, Timestamp: 1600000001},
+		Text: "olá",
+	})
+
+	w := serveAPI("GET", "/v2/bot/"+testToken+"/receive", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var response receiveResponse
+	decodeResponse(t, w, &response)
+	if len(response.Messages) != 1 || response.Messages[0].Text != "olá" || response.Messages[0].ReplyTo.Title != "Fulano" {
+		t.Errorf("unexpected messages: %#v", response.Messages)
+	}
+}
+
+func TestPresenceAPIHandlersV2(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+
+	request := models.QPPresenceRequestV2{Recipient: testRecipient}
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/presence", request); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	if subscriptions := con.Subscriptions(); len(subscriptions) != 1 || subscriptions[0] != testRecipient {
+		t.Errorf("unexpected subscriptions: %v", subscriptions)
+	}
+
+	request.Recipient = "5521988887777"
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/presence", request); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %d", w.Code)
+	}
+
+	con.Receive(`["Presence", {"id": "5521988887777@c.us", "type": "composing"}]`)
+
+	w := serveAPI("GET", "/v2/bot/"+testToken+"/presence", nil)
+	var presences []models.QPPresence
+	decodeResponse(t, w, &presences)
+	if len(presences) != 1 || presences[0].Type != "composing" {
+		t.Errorf("unexpected presences: %#v", presences)
+	}
+}
+
+func TestStatusAPIHandlerV2(t *testing.T) {
+	_, con, _ := newAPITestServer(t)
+	con.Receive(whatsapp.BatteryMessage{Percentage: 80, Plugged: true})
+
+	w := serveAPI("GET", "/v2/bot/"+testToken+"/status", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var status models.QPBotStatus
+	decodeResponse(t, w, &status)
+	if status.State != models.Ready || status.Battery.Percentage != 80 || !status.Battery.Plugged {
+		t.Errorf("unexpected status: %#v", status)
+	}
+}
+
+func TestBatteryAPIHandlerV2(t *testing.T) {
+	_, _, bots := newAPITestServer(t)
+
+	request := models.QPBatteryRequestV2{Threshold: 150}
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/battery", request); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %d", w.Code)
+	}
+
+	request = models.QPBatteryRequestV2{Threshold: 30, Unplugged: true}
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/battery", request); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	bot, _ := bots.FindByID(testBotID)
+	if bot.BatteryThreshold != 30 || !bot.UnpluggedAlert {
+		t.Errorf("battery alerts not stored: %#v", bot)
+	}
+
+	// Negativo desativa o aviso de bateria fraca
+	request = models.QPBatteryRequestV2{Threshold: -1}
+	w := serveAPI("POST", "/v2/bot/"+testToken+"/battery", request)
+	var status models.QPBotStatus
+	decodeResponse(t, w, &status)
+	if w.Code != http.StatusOK || status.BatteryThreshold != -1 {
+		t.Errorf("unexpected disabled threshold: %d, %#v", w.Code, status)
+	}
+}
+
+func TestInjectAndSentAPIHandlersV2(t *testing.T) {
+	server, _, bots := newAPITestServer(t)
+
+	request := models.QPInjectRequestV2{From: testRecipient, Text: "olá"}
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/inject", request); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for a bot not simulated, got %d", w.Code)
+	}
+
+	bots.Simulate(testBotID, true)
+	server.UpdateBot(func(bot *models.QPBot) { bot.Simulated = true })
+
+	w := serveAPI("POST", "/v2/bot/"+testToken+"/inject", request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	var injected models.QPInjectRequestV2
+	decodeResponse(t, w, &injected)
+	if len(injected.ID) == 0 {
+		t.Fatalf("injected message without id")
+	}
+
+	// Percorre o mesmo caminho das mensagens reais até o receive
+	w = serveAPI("GET", "/v2/bot/"+testToken+"/receive", nil)
+	var received receiveResponse
+	decodeResponse(t, w, &received)
+	if len(received.Messages) != 1 || received.Messages[0].ID != injected.ID || received.Messages[0].Text != "olá" {
+		t.Errorf("unexpected messages: %#v", received.Messages)
+	}
+
+	send := models.QPSendRequest{Recipient: testRecipient, Message: "resposta"}
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/sendtext", send); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	w = serveAPI("GET", "/v2/bot/"+testToken+"/sent", nil)
+	var sent []models.QPSimulatedMessage
+	decodeResponse(t, w, &sent)
+	if len(sent) != 1 || sent[0].Text != "resposta" || sent[0].Recipient != testRecipient {
+		t.Errorf("unexpected sent messages: %#v", sent)
+	}
+
+	// Descartadas após a leitura, entre os casos de teste do cliente
+	w = serveAPI("DELETE", "/v2/bot/"+testToken+"/sent", nil)
+	decodeResponse(t, w, &sent)
+	if len(sent) != 1 || sent[0].Text != "resposta" {
+		t.Errorf("unexpected cleared messages: %#v", sent)
+	}
+
+	w = serveAPI("GET", "/v2/bot/"+testToken+"/sent", nil)
+	decodeResponse(t, w, &sent)
+	if len(sent) != 0 {
+		t.Errorf("expected no sent messages after clearing, got %#v", sent)
+	}
+
+	request.From = "invalid"
+	if w := serveAPI("POST", "/v2/bot/"+testToken+"/inject", request); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid sender, got %d", w.Code)
+	}
+}
+
+func TestMessageAttachmentAPIHandlerV2(t *testing.T) {
+	server, _, bots := newAPITestServer(t)
+	bots.Simulate(testBotID, true)
+	server.UpdateBot(func(bot *models.QPBot) { bot.Simulated = true })
+
+	attachment := models.QPAttachment{MIME: "text/plain", FileName: "nota.txt", Base64: base64.StdEncoding.EncodeToString([]byte("conteúdo"))}
+	request := models.QPInjectRequestV2{Type: "document", From: testRecipient, Attachment: attachment}
+	w := serveAPI("POST", "/v2/bot/"+testToken+"/inject", request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body.String())
+	}
+
+	var injected models.QPInjectRequestV2
+	decodeResponse(t, w, &injected)
+
+	path := "/v2/bot/" + testToken + "/message/" + injected.ID + "/attachment"
+	w = serveAPI("GET", path, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "conteúdo" {
+		t.Fatalf("unexpected attachment: %d, %q", w.Code, w.Body.String())
+	}
+
+	etag := w.Header().Get("ETag")
+	if len(etag) == 0 || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("unexpected headers: %v", w.Header())
+	}
+
+	w = serveAPIWithHeaders("GET", path, map[string]string{"Range": "bytes=0-1"}, nil)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "co" {
+		t.Errorf("unexpected range: %d, %q", w.Code, w.Body.String())
+	}
+
+	w = serveAPIWithHeaders("GET", path, map[string]string{"If-None-Match": etag}, nil)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected not modified, got %d", w.Code)
+	}
+
+	text := models.QPInjectRequestV2{From: testRecipient, Text: "olá"}
+	w = serveAPI("POST", "/v2/bot/"+testToken+"/inject", text)
+	decodeResponse(t, w, &injected)
+
+	if w := serveAPI("GET", "/v2/bot/"+testToken+"/message/"+injected.ID+"/attachment", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found for a message without attachment, got %d", w.Code)
+	}
+
+	if w := serveAPI("GET", "/v2/bot/"+testToken+"/message/UNKNOWN/attachment", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found for an unknown message, got %d", w.Code)
+	}
+}
+
+func TestEventsStreamClosedOnShutdown(t *testing.T) {
+	newAPITestServer(t)
+
+	closing := webStreamsClosing
+	webStreamsClosing = make(chan struct{})
+	defer func() { webStreamsClosing = closing }()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serveAPI("GET", "/v2/bot/"+testToken+"/events", nil) }()
+
+	// O Shutdown do servidor não interrompe os streams, o RegisterOnShutdown os encerra
+	close(webStreamsClosing)
+	select {
+	case w := <-done:
+		if w.Code != http.StatusOK {
+			t.Errorf("unexpected status: %d", w.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("events stream still open after shutdown")
+	}
+}
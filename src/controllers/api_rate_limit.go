@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Responde 429 com o tempo de espera no header Retry-After
+func respondTooManyRequests(w http.ResponseWriter, limit string, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(models.RetryAfterSeconds(wait)))
+	respondError(w, models.RateLimitError(limit, wait), http.StatusTooManyRequests)
+}
+
+// Endereço de origem, já ajustado pelo middleware.RealIP quando atrás de um proxy
+func getRemoteAddress(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Limita as requisições por endereço de origem, antes mesmo da autenticação
+func addressRateLimiter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowed, wait := models.AllowAddress(getRemoteAddress(r)); !allowed {
+			getLogger(r).WithField("remote", r.RemoteAddr).Warnf("address rate limit exceeded")
+			respondTooManyRequests(w, "ip", wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Limita as requisições do bot autenticado no grupo de rotas, deve seguir o botAuthenticator
+func botRateLimiter(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bot := getRequestBot(r)
+			if allowed, wait := bot.AllowRequest(group); !allowed {
+				getBotLogger(r, bot).Warnf("%s rate limit exceeded", group)
+				respondTooManyRequests(w, group, wait)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+func TestBotRateLimit(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+
+	limits := models.QPRateLimitsV2{Send: 2}
+	w := serveAdmin(apikey, "POST", "/v2/admin/bot/"+testBotID+"/ratelimit", limits)
+	var bot models.QPBotAdminV2
+	decodeResponse(t, w, &bot)
+	if bot.RateLimits.Send != 2 {
+		t.Fatalf("rate limits not stored: %#v", bot.RateLimits)
+	}
+
+	request := models.QPSendRequest{Recipient: testRecipient, Message: "olá"}
+	for i := 0; i < 2; i++ {
+		if w := serveAPI("POST", "/v2/bot/"+testToken+"/sendtext", request); w.Code != http.StatusOK {
+			t.Fatalf("request %d: unexpected status %d", i, w.Code)
+		}
+	}
+
+	w = serveAPI("POST", "/v2/bot/"+testToken+"/sendtext", request)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected too many requests, got %d", w.Code)
+	}
+
+	if retry := w.Header().Get("Retry-After"); retry != "30" {
+		t.Errorf("unexpected Retry-After: %s", retry)
+	}
+
+	// Os demais grupos de rotas têm seus próprios limites
+	if w := serveAPI("GET", "/v2/bot/"+testToken+"/receive", nil); w.Code != http.StatusOK {
+		t.Errorf("expected receive to be allowed, got %d", w.Code)
+	}
+}
+
+func TestAddressRateLimit(t *testing.T) {
+	newAPITestServer(t)
+
+	os.Setenv("RATELIMITIP", "1")
+	defer os.Unsetenv("RATELIMITIP")
+
+	if w := serveAPI("GET", "/v2/bot/"+testToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	// Limite por endereço vale antes da autenticação, inclusive para tokens inválidos
+	w := serveAPI("GET", "/v2/bot/unknown", nil)
+	if w.Code != http.StatusTooManyRequests || len(w.Header().Get("Retry-After")) == 0 {
+		t.Errorf("expected too many requests with Retry-After, got %d", w.Code)
+	}
+}
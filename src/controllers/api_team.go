@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+//
+// Teams
+//
+
+// TeamsAdminHandler renders route GET "/v2/admin/teams"
+// Lista as equipes do usuário atual com o seu papel em cada uma
+func TeamsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	teams, err := models.WhatsAppService.DB.Team.FindAllForUser(user.ID)
+	if err != nil {
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondSuccess(w, teams)
+}
+
+// CreateTeamAdminHandler renders route POST "/v2/admin/teams"
+// O usuário atual passa a ser o dono da nova equipe
+func CreateTeamAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	var request models.QPTeamRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	team, err := models.CreateTeam(user.ID, request.Name)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	respondTeam(w, user, team.ID)
+}
+
+// TeamAdminHandler renders route GET "/v2/admin/team/{teamID}"
+// Equipe com os seus membros e bots compartilhados
+func TeamAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	respondTeam(w, user, chi.URLParam(r, "teamID"))
+}
+
+// DeleteTeamAdminHandler renders route DELETE "/v2/admin/team/{teamID}"
+func DeleteTeamAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	if err := models.DeleteTeam(user.ID, teamID); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+
+	respondSuccess(w, teamID)
+}
+
+// TeamMemberAdminHandler renders route POST "/v2/admin/team/{teamID}/members"
+// Inclui um usuário já cadastrado pelo email ou altera o seu papel
+func TeamMemberAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	var request models.QPTeamMemberRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	role, err := models.ParseRole(request.Role)
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	if err := models.SetTeamMember(user.ID, teamID, request.Email, role); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+
+	respondTeam(w, user, teamID)
+}
+
+// RemoveTeamMemberAdminHandler renders route DELETE "/v2/admin/team/{teamID}/member/{userID}"
+// Qualquer membro pode remover a si mesmo
+func RemoveTeamMemberAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	memberID := chi.URLParam(r, "userID")
+	if err := models.RemoveTeamMember(user.ID, teamID, memberID); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+
+	respondSuccess(w, memberID)
+}
+
+// ShareBotAdminHandler renders route POST "/v2/admin/team/{teamID}/bots"
+// Somente o dono do bot compartilha, desde que administre a equipe
+func ShareBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	var request models.QPTeamBotRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	if err := models.ShareBotWithTeam(user.ID, teamID, request.BotID); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+
+	respondTeam(w, user, teamID)
+}
+
+// UnshareBotAdminHandler renders route DELETE "/v2/admin/team/{teamID}/bot/{botID}"
+func UnshareBotAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	if err := models.UnshareBotFromTeam(user.ID, teamID, chi.URLParam(r, "botID")); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+
+	respondTeam(w, user, teamID)
+}
+
+// Team2FAAdminHandler renders route POST "/v2/admin/team/{teamID}/2fa"
+// Somente os donos da equipe exigem ou dispensam o segundo fator dos membros
+func Team2FAAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	var request models.QPTeam2FARequestV2
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	if err := models.SetTeamRequire2FA(user.ID, teamID, request.Required); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+
+	respondTeam(w, user, teamID)
+}
+
+//
+// Helpers
+//
+
+func respondTeam(w http.ResponseWriter, user models.QPUser, teamID string) {
+	team, err := models.GetTeamDetails(user.ID, teamID)
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+
+	respondSuccess(w, team)
+}
+
+// Sem acesso à equipe ou ao bot responde com o erro de acesso, os demais são erros da requisição
+func respondTeamError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrTeamNotFound, models.ErrTeamForbidden, models.ErrBotForbidden:
+		respondAccessError(w, err)
+	default:
+		respondBadRequest(w, err)
+	}
+}
@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Equipes em memória, substitui o banco de dados nos testes
+type testTeamStore struct {
+	teams   map[string]models.QPTeam
+	members map[string]map[string]models.QPRole
+	bots    map[string]map[string]bool
+	sync    *sync.Mutex
+}
+
+func newTestTeamStore() *testTeamStore {
+	return &testTeamStore{
+		teams:   map[string]models.QPTeam{},
+		members: map[string]map[string]models.QPRole{},
+		bots:    map[string]map[string]bool{},
+		sync:    &sync.Mutex{},
+	}
+}
+
+func (store *testTeamStore) Create(name string, ownerID string) (models.QPTeam, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	team := models.QPTeam{ID: "team" + strconv.Itoa(len(store.teams)+1), Name: name}
+	store.teams[team.ID] = team
+	store.members[team.ID] = map[string]models.QPRole{ownerID: models.RoleOwner}
+	store.bots[team.ID] = map[string]bool{}
+	return team, nil
+}
+
+func (store *testTeamStore) FindByID(ID string) (models.QPTeam, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	team, ok := store.teams[ID]
+	if !ok {
+		return team, errors.New("team not found")
+	}
+	return team, nil
+}
+
+func (store *testTeamStore) FindAllForUser(userID string) (teams []models.QPTeamMembership, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	teams = []models.QPTeamMembership{}
+	for ID, members := range store.members {
+		if role, ok := members[userID]; ok {
+			teams = append(teams, models.QPTeamMembership{QPTeam: store.teams[ID], Role: role})
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+	return
+}
+
+func (store *testTeamStore) Delete(ID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	delete(store.teams, ID)
+	delete(store.members, ID)
+	delete(store.bots, ID)
+	return nil
+}
+
+func (store *testTeamStore) Members(teamID string) (members []models.QPTeamMember, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for userID, role := range store.members[teamID] {
+		members = append(members, models.QPTeamMember{TeamID: teamID, UserID: userID, Email: userID + "@example.com", Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return
+}
+
+func (store *testTeamStore) SetMember(teamID string, userID string, role models.QPRole) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	store.members[teamID][userID] = role
+	return nil
+}
+
+func (store *testTeamStore) RemoveMember(teamID string, userID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	delete(store.members[teamID], userID)
+	return nil
+}
+
+func (store *testTeamStore) Bots(teamID string) (bots []string, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	bots = []string{}
+	for botID := range store.bots[teamID] {
+		bots = append(bots, botID)
+	}
+	sort.Strings(bots)
+	return
+}
+
+func (store *testTeamStore) ShareBot(teamID string, botID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	store.bots[teamID][botID] = true
+	return nil
+}
+
+func (store *testTeamStore) UnshareBot(teamID string, botID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	delete(store.bots[teamID], botID)
+	return nil
+}
+
+func (store *testTeamStore) FindBotRoles(userID string) (roles []models.QPTeamBotRole, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for teamID, members := range store.members {
+		if role, ok := members[userID]; ok {
+			for botID := range store.bots[teamID] {
+				roles = append(roles, models.QPTeamBotRole{BotID: botID, Role: role})
+			}
+		}
+	}
+	return
+}
+
+func (store *testTeamStore) RemoveBot(botID string) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for _, bots := range store.bots {
+		delete(bots, botID)
+	}
+	return nil
+}
+
+func (store *testTeamStore) SetRequire2FA(teamID string, required bool) error {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	team := store.teams[teamID]
+	team.Require2FA = required
+	store.teams[teamID] = team
+	return nil
+}
+
+// Cadastra outro usuário com a sua própria chave de acesso
+func addTestUser(t *testing.T, ID string) string {
+	if _, err := models.WhatsAppService.DB.User.Create(ID+"@example.com", ""); err != nil {
+		t.Fatalf("error creating user: %s", err)
+	}
+
+	apikey, err := models.GenerateUserAPIKey(ID + "@example.com")
+	if err != nil {
+		t.Fatalf("error generating api key: %s", err)
+	}
+	return apikey
+}
+
+// Cria a equipe do usuário "user" com o bot de testes compartilhado e o membro informado
+func newSharedTestTeam(t *testing.T, apikey string, member string, role models.QPRole) string {
+	w := serveAdmin(apikey, "POST", "/v2/admin/teams", models.QPTeamRequestV2{Name: "Support"})
+	var team models.QPTeamDetails
+	decodeResponse(t, w, &team)
+	if team.Role != models.RoleOwner {
+		t.Fatalf("creator is not the team owner: %#v", team)
+	}
+
+	w = serveAdmin(apikey, "POST", "/v2/admin/team/"+team.ID+"/members", models.QPTeamMemberRequestV2{Email: member, Role: string(role)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status adding member: %d, %s", w.Code, w.Body.String())
+	}
+
+	w = serveAdmin(apikey, "POST", "/v2/admin/team/"+team.ID+"/bots", models.QPTeamBotRequestV2{BotID: testBotID})
+	decodeResponse(t, w, &team)
+	if len(team.Bots) != 1 || team.Bots[0] != testBotID {
+		t.Fatalf("bot not shared: %#v", team)
+	}
+	return team.ID
+}
+
+func TestTeamRolesOnSharedBot(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+	viewer := addTestUser(t, "viewer")
+
+	if w := serveAdmin(viewer, "GET", "/v2/admin/bot/"+testBotID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found before sharing, got %d", w.Code)
+	}
+
+	teamID := newSharedTestTeam(t, apikey, "viewer@example.com", models.RoleViewer)
+
+	w := serveAdmin(viewer, "GET", "/v2/admin/bots", nil)
+	var list []models.QPBotAdminV2
+	decodeResponse(t, w, &list)
+	if len(list) != 1 || list[0].ID != testBotID || list[0].Role != models.RoleViewer {
+		t.Fatalf("unexpected bots for the viewer: %#v", list)
+	}
+
+	// O token dá acesso completo à API do bot, somente administradores o recebem
+	if list[0].Token != "" {
+		t.Errorf("token listed to the viewer: %#v", list[0])
+	}
+
+	w = serveAdmin(viewer, "GET", "/v2/admin/bot/"+testBotID, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the viewer to see the bot, got %d", w.Code)
+	}
+
+	var single map[string]interface{}
+	decodeResponse(t, w, &single)
+	if _, found := single["token"]; found {
+		t.Errorf("token returned to the viewer: %v", single)
+	}
+
+	if w := serveAdmin(viewer, "POST", "/v2/admin/bot/"+testBotID+"/devel", nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden toggling devel as viewer, got %d", w.Code)
+	}
+
+	// Administradores da equipe gerenciam o bot, mas não o removem
+	if w := serveAdmin(apikey, "POST", "/v2/admin/team/"+teamID+"/members", models.QPTeamMemberRequestV2{Email: "viewer@example.com", Role: "admin"}); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status changing role: %d", w.Code)
+	}
+
+	if w := serveAdmin(viewer, "POST", "/v2/admin/bot/"+testBotID+"/devel", nil); w.Code != http.StatusOK {
+		t.Errorf("expected a team admin to toggle devel, got %d", w.Code)
+	}
+
+	if w := serveAdmin(viewer, "DELETE", "/v2/admin/bot/"+testBotID, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden deleting a shared bot, got %d", w.Code)
+	}
+
+	if w := serveAdmin(viewer, "POST", "/v2/admin/bot/"+testBotID+"/export", nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden exporting a shared bot, got %d", w.Code)
+	}
+
+	// Sem o compartilhamento o bot volta a ser invisível
+	if w := serveAdmin(apikey, "DELETE", "/v2/admin/team/"+teamID+"/bot/"+testBotID, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status unsharing: %d", w.Code)
+	}
+
+	if w := serveAdmin(viewer, "GET", "/v2/admin/bot/"+testBotID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found after unsharing, got %d", w.Code)
+	}
+}
+
+func TestTeamMembershipRules(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+	admin := addTestUser(t, "admin")
+	addTestUser(t, "operator")
+
+	teamID := newSharedTestTeam(t, apikey, "admin@example.com", models.RoleAdmin)
+
+	if w := serveAdmin(admin, "POST", "/v2/admin/team/"+teamID+"/members", models.QPTeamMemberRequestV2{Email: "operator@example.com", Role: "operator"}); w.Code != http.StatusOK {
+		t.Errorf("expected a team admin to add members, got %d", w.Code)
+	}
+
+	if w := serveAdmin(admin, "POST", "/v2/admin/team/"+teamID+"/members", models.QPTeamMemberRequestV2{Email: "operator@example.com", Role: "owner"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden granting owner as admin, got %d", w.Code)
+	}
+
+	if w := serveAdmin(admin, "DELETE", "/v2/admin/team/"+teamID+"/member/user", nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden removing the owner as admin, got %d", w.Code)
+	}
+
+	if w := serveAdmin(admin, "DELETE", "/v2/admin/team/"+teamID, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden deleting the team as admin, got %d", w.Code)
+	}
+
+	// O último dono não pode deixar a equipe
+	if w := serveAdmin(apikey, "DELETE", "/v2/admin/team/"+teamID+"/member/user", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request removing the last owner, got %d", w.Code)
+	}
+
+	if w := serveAdmin(admin, "DELETE", "/v2/admin/team/"+teamID+"/member/admin@example.com", nil); w.Code != http.StatusOK {
+		t.Errorf("expected a member to leave the team, got %d", w.Code)
+	}
+
+	if w := serveAdmin(admin, "GET", "/v2/admin/team/"+teamID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected not found after leaving, got %d", w.Code)
+	}
+
+	if w := serveAdmin(apikey, "DELETE", "/v2/admin/team/"+teamID, nil); w.Code != http.StatusOK {
+		t.Errorf("unexpected status deleting the team: %d", w.Code)
+	}
+}
+
+func TestTeamViewerReceiveForm(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+	addTestUser(t, "viewer")
+	newSharedTestTeam(t, apikey, "viewer@example.com", models.RoleViewer)
+
+	viewer, _ := models.WhatsAppService.DB.User.FindByEmail("viewer@example.com")
+	r := chi.NewRouter()
+	addWebRoutes(r)
+
+	// Sem acesso de operador a resposta é o erro de acesso, não o estado do bot
+	request := httptest.NewRequest("GET", "/bot/"+testBotID+"/receive", nil)
+	request.AddCookie(&http.Cookie{Name: "jwt", Value: newTestSessionToken(t, viewer)})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden receiving as viewer, got %d, %s", w.Code, w.Body.String())
+	}
+}
@@ -2,8 +2,6 @@ package controllers
 
 import (
 	"fmt"
-	"html/template"
-	"log"
 	"net/http"
 
 	"github.com/go-chi/chi"
@@ -42,6 +40,7 @@ var messageReceiveErrors = promauto.NewCounter(prometheus.CounterOpts{
 //
 
 // CycleHandler renders route POST "/bot/cycle"
+// Gera um novo token, exibido uma única vez
 func CycleHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := models.GetUser(r)
 	if err != nil {
@@ -49,39 +48,63 @@ func CycleHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.ParseForm()
-	botID := r.Form.Get("botID")
-	bot, err := models.WhatsAppService.DB.Bot.FindForUser(user.ID, botID)
+	bot, err := findFormBot(r, models.RoleAdmin)
 	if err != nil {
+		respondAccessError(w, err)
 		return
 	}
 
-	err = bot.CycleToken()
+	data := accountFormData{PageTitle: "Account", User: user}
+	data.NewBotToken, err = bot.CycleToken()
 	if err != nil {
-		return
+		getBotLogger(r, bot).WithError(err).Errorf("error cycling token")
+		data.ErrorMessage = err.Error()
+		data.NewBotToken = ""
+	} else {
+		data.NewBotTokenNumber = bot.GetNumber()
 	}
 
-	http.Redirect(w, r, "/account", http.StatusFound)
+	renderAccountForm(w, r, data)
 }
 
 // DebugHandler renders route POST "/bot/debug"
 func DebugHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := models.GetUser(r)
-	if err != nil {
+	if _, err := models.GetUser(r); err != nil {
 		redirectToLogin(w, r)
 		return
 	}
 
-	r.ParseForm()
-	botID := r.Form.Get("botID")
-	bot, err := models.WhatsAppService.DB.Bot.FindForUser(user.ID, botID)
+	bot, err := findFormBot(r, models.RoleAdmin)
 	if err != nil {
+		respondAccessError(w, err)
 		return
 	}
 
 	err = bot.ToggleDevel()
 	if err != nil {
-		log.Printf("(%s)(ERR) Debug Handler :: '%s',", bot.GetNumber(), err)
+		getBotLogger(r, bot).WithError(err).Errorf("error toggling debug")
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusFound)
+}
+
+// ArchiveHandler renders route POST "/bot/archive"
+func ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := models.GetUser(r); err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	bot, err := findFormBot(r, models.RoleAdmin)
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+
+	err = bot.ToggleArchive()
+	if err != nil {
+		getBotLogger(r, bot).WithError(err).Errorf("error toggling archive")
 		return
 	}
 
@@ -90,28 +113,47 @@ func DebugHandler(w http.ResponseWriter, r *http.Request) {
 
 // ToggleHandler renders route POST "/bot/toggle"
 func ToggleHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := models.GetUser(r)
-	if err != nil {
+	if _, err := models.GetUser(r); err != nil {
 		redirectToLogin(w, r)
 		return
 	}
 
-	r.ParseForm()
-	botID := r.Form.Get("botID")
-	bot, err := models.WhatsAppService.DB.Bot.FindForUser(user.ID, botID)
+	bot, err := findFormBot(r, models.RoleAdmin)
 	if err != nil {
+		respondAccessError(w, err)
 		return
 	}
 
 	err = bot.Toggle()
 	if err != nil {
-		log.Print("(%s)(ERR) Toggle Handler :: '%s',", bot.GetNumber(), err)
+		getBotLogger(r, bot).WithError(err).Errorf("error toggling bot")
 		return
 	}
 
 	http.Redirect(w, r, "/account", http.StatusFound)
 }
 
+// SimulateHandler renders route POST "/bot/simulate"
+func SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	data := accountFormData{PageTitle: "Account", User: user}
+	bot, token, err := models.CreateSimulatedBot(user.ID)
+	if err != nil {
+		getLogger(r).WithError(err).Errorf("error creating simulated bot")
+		data.ErrorMessage = err.Error()
+	} else {
+		data.NewBotToken = token
+		data.NewBotTokenNumber = bot.GetNumber()
+	}
+
+	renderAccountForm(w, r, data)
+}
+
 //
 // Verify
 //
@@ -132,10 +174,10 @@ func VerifyFormHandler(w http.ResponseWriter, r *http.Request) {
 		Host:      r.Host,
 	}
 
-	templates := template.Must(template.ParseFiles(
+	templates := parseTemplates(r,
 		"views/layouts/main.tmpl",
 		"views/bot/verify.tmpl",
-	))
+	)
 	templates.ExecuteTemplate(w, "main", data)
 }
 
@@ -145,14 +187,14 @@ var upgrader = websocket.Upgrader{}
 func VerifyHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := models.GetUser(r)
 	if err != nil {
-		log.Print("Connection upgrade error (not logged): ", err)
+		getLogger(r).WithError(err).Warnf("connection upgrade error (not logged)")
 		redirectToLogin(w, r)
 		return
 	}
 
 	con, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Print("Connection upgrade error: ", err)
+		getLogger(r).WithError(err).Errorf("connection upgrade error")
 		return
 	}
 
@@ -162,7 +204,7 @@ func VerifyHandler(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		err = con.WriteMessage(websocket.TextMessage, <-out)
 		if err != nil {
-			log.Println("Write message error: ", err)
+			getLogger(r).WithError(err).Errorf("write message error")
 		}
 	}()
 
@@ -173,7 +215,7 @@ func VerifyHandler(w http.ResponseWriter, r *http.Request) {
 		
 		// Se for timeout não me interessa e volta para tela de contas
 		if err != nil {
-			log.Printf("error on read qr code: %s", err)
+			getLogger(r).WithError(err).Errorf("error reading qrcode")
 			w.WriteHeader(500)
 			return
 		}
@@ -182,17 +224,18 @@ func VerifyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("(%s) Verificação QRCode confirmada ...", bot.GetNumber())
+	logger := getBotLogger(r, bot)
+	logger.Infof("qrcode verification confirmed")
 	err = bot.MarkVerified(true)
 	if err != nil {
-		log.Println(err)
+		logger.WithError(err).Errorf("error marking as verified")
 	}
 
 	go models.WhatsAppService.AppendNewServer(bot)
 
 	err = con.WriteMessage(websocket.TextMessage, []byte("Complete"))
 	if err != nil {
-		log.Println("Write message error: ", err)
+		logger.WithError(err).Errorf("write message error")
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -209,8 +252,8 @@ type sendFormData struct {
 	Bot          models.QPBot
 }
 
-func renderSendForm(w http.ResponseWriter, data sendFormData) {
-	templates := template.Must(template.ParseFiles("views/layouts/main.tmpl", "views/bot/send.tmpl"))
+func renderSendForm(w http.ResponseWriter, r *http.Request, data sendFormData) {
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/bot/send.tmpl")
 	templates.ExecuteTemplate(w, "main", data)
 }
 
@@ -220,15 +263,15 @@ func SendFormHandler(w http.ResponseWriter, r *http.Request) {
 		PageTitle: "Send",
 	}
 
-	bot, err := findBot(r)
+	bot, err := findBot(r, models.RoleOperator)
 	if err != nil {
 		data.ErrorMessage = err.Error()
-		renderSendForm(w, data)
+		renderSendForm(w, r, data)
 		return
 	}
 
 	data.Bot = bot
-	renderSendForm(w, data)
+	renderSendForm(w, r, data)
 }
 
 // SendHandler renders route POST "/bot/{botID}/send"
@@ -237,10 +280,10 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 	data := sendFormData{
 		PageTitle: "Send",
 	}
-	bot, err := findBot(r)
+	bot, err := findBot(r, models.RoleOperator)
 	if err != nil {
 		data.ErrorMessage = err.Error()
-		renderSendForm(w, data)
+		renderSendForm(w, r, data)
 		return
 	}
 
@@ -252,7 +295,7 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		messageSendErrors.Inc()
 		data.ErrorMessage = err.Error()
-		renderSendForm(w, data)
+		renderSendForm(w, r, data)
 		return
 	}
 
@@ -260,7 +303,7 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 
 	messagesSent.Inc()
 
-	renderSendForm(w, data)
+	renderSendForm(w, r, data)
 }
 
 //
@@ -285,15 +328,15 @@ func ReceiveFormHandler(w http.ResponseWriter, r *http.Request) {
 		PageTitle: "Receive",
 	}
 
-	bot, err := findBot(r)
+	bot, err := findBot(r, models.RoleOperator)
 	if err != nil {
-		data.ErrorMessage = err.Error()
-	} else {
-		data.Number = bot.GetNumber()
+		respondAccessError(w, err)
+		return
 	}
+	data.Number = bot.GetNumber()
 
 	// Evitando tentativa de download de anexos sem o bot estar devidamente sincronizado
-	if bot.GetStatus() != "ready" {
+	if !bot.IsReady() {
 		respondNotReady(w, fmt.Errorf("bot not ready yet ! try later."))
 		return
 	}
@@ -311,9 +354,9 @@ func ReceiveFormHandler(w http.ResponseWriter, r *http.Request) {
 
 	messagesReceived.Add(float64(len(messages)))
 
-	templates := template.Must(template.ParseFiles(
+	templates := parseTemplates(r,
 		"views/layouts/main.tmpl",
-		"views/bot/receive.tmpl"))
+		"views/bot/receive.tmpl")
 	templates.ExecuteTemplate(w, "main", data)
 }
 
@@ -323,24 +366,19 @@ func ReceiveFormHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteHandler renders route POST "/bot/{botID}/delete"
 func DeleteHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := models.GetUser(r)
-	if err != nil {
+	if _, err := models.GetUser(r); err != nil {
+		redirectToLogin(w, r)
 		return
 	}
 
-	r.ParseForm()
-	botID := r.Form.Get("botID")
-
-	bot, err := models.WhatsAppService.DB.Bot.FindForUser(user.ID, botID)
+	bot, err := findFormBot(r, models.RoleOwner)
 	if err != nil {
+		respondAccessError(w, err)
 		return
 	}
 
-	if err := models.WhatsAppService.DB.Store.Delete(bot.ID); err != nil {
-		return
-	}
-
-	if err := bot.Delete(); err != nil {
+	if err := bot.Remove(); err != nil {
+		getBotLogger(r, bot).WithError(err).Errorf("error deleting bot")
 		return
 	}
 
@@ -351,14 +389,23 @@ func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 // Helpers
 //
 
-func findBot(r *http.Request) (models.QPBot, error) {
-	var bot models.QPBot
+// Bot indicado na rota, acessível ao usuário atual com no mínimo o papel exigido
+func findBot(r *http.Request, required models.QPRole) (models.QPBot, error) {
+	return findBotForUser(r, chi.URLParam(r, "botID"), required)
+}
+
+// Bot indicado no formulário, acessível ao usuário atual com no mínimo o papel exigido
+func findFormBot(r *http.Request, required models.QPRole) (models.QPBot, error) {
+	r.ParseForm()
+	return findBotForUser(r, r.Form.Get("botID"), required)
+}
+
+func findBotForUser(r *http.Request, botID string, required models.QPRole) (models.QPBot, error) {
 	user, err := models.GetUser(r)
 	if err != nil {
-		return bot, err
+		return models.QPBot{}, err
 	}
 
-	botID := chi.URLParam(r, "botID")
-
-	return models.WhatsAppService.DB.Bot.FindForUser(user.ID, botID)
+	access, err := models.FindBotForUser(user.ID, botID, required)
+	return access.QPBot, err
 }
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+)
+
+// Cookie com o valor aleatório do navegador, o formulário envia a sua assinatura
+const csrfCookie = "csrf"
+
+// Campo dos formulários e header alternativo com o token
+const (
+	csrfFormField = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+type csrfContextKey string
+
+const csrfValueKey csrfContextKey = "quepasa_csrf"
+
+var errCSRFInvalid = errors.New("invalid or missing CSRF token, reload the page and try again")
+
+// Protege os formulários contra requisições forjadas por outros sites
+// Garante o cookie do navegador e, nos métodos que alteram dados, exige o token assinado
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := ""
+		if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) == 64 {
+			value = cookie.Value
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			token := r.Header.Get(csrfHeader)
+			if len(token) == 0 {
+				token = r.FormValue(csrfFormField)
+			}
+
+			if len(value) == 0 || !hmac.Equal([]byte(token), []byte(signCSRFValue(value))) {
+				getLogger(r).WithField("remote", r.RemoteAddr).Warnf("csrf token rejected for %s %s", r.Method, r.URL.Path)
+				respondForbidden(w, errCSRFInvalid)
+				return
+			}
+		}
+
+		if len(value) == 0 {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				getLogger(r).WithError(err).Errorf("error generating csrf value")
+				respondError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			value = hex.EncodeToString(b)
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    value,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		ctx := context.WithValue(r.Context(), csrfValueKey, value)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Assinatura do valor do cookie, outro site não consegue gerá-la mesmo que defina o cookie
+func signCSRFValue(value string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SIGNING_SECRET")))
+	mac.Write([]byte("csrf:" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Token dos formulários da requisição, vazio fora do csrfProtect
+func getCSRFToken(r *http.Request) string {
+	if value, ok := r.Context().Value(csrfValueKey).(string); ok {
+		return signCSRFValue(value)
+	}
+	return ""
+}
+
+// Carrega as views com a função csrfField, que inclui o token nos formulários
+func parseTemplates(r *http.Request, filenames ...string) *template.Template {
+	funcs := template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrfFormField + `" value="` + template.HTMLEscapeString(getCSRFToken(r)) + `">`)
+		},
+	}
+	return template.Must(template.New("main").Funcs(funcs).ParseFiles(filenames...))
+}
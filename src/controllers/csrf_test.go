@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+func TestCSRFProtection(t *testing.T) {
+	newWebTestServer(t)
+
+	// Sem token o formulário é recusado antes mesmo da senha
+	if w := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"wrong"}, csrfFormField: {""}}); w.Code != http.StatusForbidden {
+		t.Errorf("expected a missing token to be forbidden, got %d", w.Code)
+	}
+
+	if w := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"wrong"}, csrfFormField: {strings.Repeat("0", 64)}}); w.Code != http.StatusForbidden {
+		t.Errorf("expected an unsigned token to be forbidden, got %d", w.Code)
+	}
+
+	if w := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"wrong"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a valid token to reach the login, got %d", w.Code)
+	}
+
+	// Formulário autenticado, de outro site, sem o cookie do navegador
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+	cookie := &http.Cookie{Name: "jwt", Value: newTestSessionToken(t, user)}
+	r := chi.NewRouter()
+	addWebRoutes(r)
+	request := httptest.NewRequest("POST", "/bot/delete", strings.NewReader("botID="+testBotID))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a forged bot delete to be forbidden, got %d", w.Code)
+	}
+}
+
+func TestCSRFCookieAndHeader(t *testing.T) {
+	var token string
+	handler := csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = getCSRFToken(r)
+	}))
+
+	// O primeiro acesso cria o cookie e o token correspondente
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	cookie := findCookie(w, csrfCookie)
+	if cookie == nil || cookie.SameSite != http.SameSiteLaxMode || token != signCSRFValue(cookie.Value) {
+		t.Fatalf("unexpected csrf cookie %v and token %s", cookie, token)
+	}
+
+	request := httptest.NewRequest("POST", "/login", nil)
+	request.AddCookie(cookie)
+	request.Header.Set(csrfHeader, token)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+	if w.Code != http.StatusOK || findCookie(w, csrfCookie) != nil {
+		t.Errorf("expected the header token to be accepted keeping the cookie, got %d", w.Code)
+	}
+}
+
+func TestTemplatesIncludeCSRFToken(t *testing.T) {
+	var body bytes.Buffer
+	var token string
+	csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = getCSRFToken(r)
+		templates := parseTemplates(r, "../views/layouts/main.tmpl", "../views/login.tmpl")
+		if err := templates.ExecuteTemplate(&body, "main", loginFormData{PageTitle: "Login"}); err != nil {
+			t.Errorf("error rendering: %s", err)
+		}
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/login", nil))
+
+	field := `name="` + csrfFormField + `" value="` + token + `"`
+	if len(token) == 0 || !strings.Contains(body.String(), field) {
+		t.Errorf("token missing from the login form")
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+//
+// Health
+//
+
+type readinessResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HealthHandler renders route GET "/healthz"
+// Processo em execução, usado como liveness probe
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// ReadyHandler renders route GET "/readyz"
+// Banco acessível, migrações aplicadas e servidor web escutando, usado como readiness probe
+// Caso READINESSREADYRATIO seja definido, exige também essa fração dos bots verificados prontos
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	res := readinessResponse{Ready: true, Checks: make(map[string]string)}
+	check := func(name string, err error) {
+		if err != nil {
+			res.Ready = false
+			res.Checks[name] = err.Error()
+		} else {
+			res.Checks[name] = "ok"
+		}
+	}
+
+	check("database", checkDatabase())
+
+	if models.IsDatabaseMigrated() {
+		check("migrations", nil)
+	} else {
+		check("migrations", fmt.Errorf("not applied"))
+	}
+
+	if IsWebServerListening() {
+		check("listener", nil)
+	} else {
+		check("listener", fmt.Errorf("not listening"))
+	}
+
+	if required, err := strconv.ParseFloat(os.Getenv("READINESSREADYRATIO"), 64); err == nil && required > 0 {
+		if models.WhatsAppService == nil {
+			check("bots", fmt.Errorf("service not started"))
+		} else if ratio := models.WhatsAppService.GetReadyRatio(); ratio < required {
+			check("bots", fmt.Errorf("%.2f of verified bots ready, required %.2f", ratio, required))
+		} else {
+			check("bots", nil)
+		}
+	}
+
+	code := http.StatusOK
+	if !res.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+func checkDatabase() error {
+	if models.WhatsAppService == nil || models.WhatsAppService.DB.Connection == nil {
+		return fmt.Errorf("not connected")
+	}
+	return models.WhatsAppService.DB.Connection.Ping()
+}
+
+// ServersStatusAdminHandler renders route GET "/v2/status"
+// Estado, tempo em funcionamento, última mensagem e último erro de cada servidor que o usuário alcança
+func ServersStatusAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if models.WhatsAppService == nil {
+		respondNotReady(w, fmt.Errorf("service not started"))
+		return
+	}
+
+	user, err := models.GetUser(r)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	bots, err := models.FindAllBotsForUser(user.ID)
+	if err != nil {
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	reachable := make(map[string]bool)
+	for _, bot := range bots {
+		reachable[bot.ID] = true
+	}
+
+	servers := []models.QPServerStatus{}
+	for _, status := range models.WhatsAppService.GetServersStatus() {
+		if reachable[status.ID] {
+			servers = append(servers, status)
+		}
+	}
+
+	respondSuccess(w, servers)
+}
@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"html/template"
 	"net/http"
 
 	"github.com/sufficit/sufficit-quepasa-fork/models"
@@ -23,6 +22,6 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 		PageTitle: "Home",
 	}
 
-	templates := template.Must(template.ParseFiles("views/layouts/main.tmpl", "views/index.tmpl"))
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/index.tmpl")
 	templates.ExecuteTemplate(w, "main", data)
 }
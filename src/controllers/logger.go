@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Logger da requisição, com o id gerado pelo middleware RequestID
+func getLogger(r *http.Request) *models.QPLogger {
+	return models.Log.WithComponent("web").WithField("request_id", middleware.GetReqID(r.Context()))
+}
+
+// Logger do bot na requisição, respeita o nível de log próprio do bot
+func getBotLogger(r *http.Request, bot models.QPBot) *models.QPLogger {
+	return bot.GetLogger().WithComponent("api").WithField("request_id", middleware.GetReqID(r.Context()))
+}
+
+// Registra cada requisição com método, caminho, código de resposta e duração (HTTPLOGS)
+// O token dos bots nas rotas legadas é omitido do caminho
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		path := r.URL.Path
+		if token := chi.URLParam(r, "token"); len(token) > 0 {
+			path = strings.Replace(path, "/"+token, "/{token}", 1)
+		}
+
+		getLogger(r).WithFields(models.QPLogFields{
+			"method":   r.Method,
+			"path":     path,
+			"status":   ww.Status(),
+			"bytes":    ww.BytesWritten(),
+			"duration": time.Since(started).String(),
+			"remote":   r.RemoteAddr,
+		}).Infof("%s %s", r.Method, path)
+	})
+}
@@ -1,11 +1,13 @@
 package controllers
 
 import (
-	"log"
+	"context"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -14,6 +16,7 @@ import (
 	"github.com/sufficit/sufficit-quepasa-fork/models"
 )
 
+// Inicia o servidor web, retornando somente quando for desligado pelo QPWebServerShutdown
 func QPWebServerStart() {
 	r := newRouter()
 	webAPIPort := os.Getenv("WEBAPIPORT")
@@ -22,11 +25,60 @@ func QPWebServerStart() {
 		webAPIPort = "31000"
 	}
 
-	log.Printf("Starting Web Server on Port: %s", webAPIPort)
-	err := http.ListenAndServe(webAPIHost+":"+webAPIPort, r)
+	logger := models.Log.WithComponent("web")
+	logger.Infof("starting web server on port: %s", webAPIPort)
+	listener, err := net.Listen("tcp", webAPIHost+":"+webAPIPort)
 	if err != nil {
-		log.Fatal(err)
+		logger.WithError(err).Fatalf("error listening")
 	}
+
+	webServerSync.Lock()
+	webServer = &http.Server{Handler: r}
+	webServer.RegisterOnShutdown(closeWebStreams)
+	server := webServer
+	webServerListening = true
+	webServerSync.Unlock()
+
+	err = server.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		logger.WithError(err).Fatalf("error serving")
+	}
+}
+
+var webServer *http.Server
+var webServerListening bool
+var webServerSync sync.Mutex
+
+// Fechado no desligamento, encerra as conexões longas (/events) que o Shutdown não interrompe
+var webStreamsClosing = make(chan struct{})
+var webStreamsClosed sync.Once
+
+func closeWebStreams() {
+	webStreamsClosed.Do(func() { close(webStreamsClosing) })
+}
+
+func IsWebServerListening() bool {
+	webServerSync.Lock()
+	defer webServerSync.Unlock()
+	return webServerListening
+}
+
+// Para de aceitar novas conexões e aguarda as requisições em andamento até o prazo expirar
+func QPWebServerShutdown(ctx context.Context) error {
+	webServerSync.Lock()
+	server := webServer
+	webServerSync.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	models.Log.WithComponent("web").Infof("shutting down web server")
+	webServerSync.Lock()
+	webServerListening = false
+	webServerSync.Unlock()
+
+	return server.Shutdown(ctx)
 }
 
 func newRouter() chi.Router {
@@ -37,26 +89,44 @@ func newRouter() chi.Router {
 	
 	shouldLog, _ := models.GetEnvBool("HTTPLOGS", false)
 	if shouldLog {
-		r.Use(middleware.Logger)
+		r.Use(requestLogger)
 	}
 	
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
 
-	// web routes
-	addWebRoutes(r)
-
-	// api routes
+	// api routes, com o prazo das requisições exceto nos streams de eventos
 	addAPIRoutes(r)
 
-	// static files
-	workDir, _ := os.Getwd()
-	assetsDir := filepath.Join(workDir, "assets")
-	fileServer(r, "/assets", http.Dir(assetsDir))
+	r.Group(func(r chi.Router) {
+		r.Use(requestTimeout)
+
+		// health routes
+		addHealthRoutes(r)
+
+		// web routes
+		addWebRoutes(r)
+
+		// admin api routes
+		addAdminRoutes(r)
+
+		// static files
+		workDir, _ := os.Getwd()
+		assetsDir := filepath.Join(workDir, "assets")
+		fileServer(r, "/assets", http.Dir(assetsDir))
+	})
 
 	return r
 }
 
+// Prazo das requisições, os streams de eventos ficam abertos e não o utilizam
+var requestTimeout = middleware.Timeout(30 * time.Second)
+
+// Rotas de verificação de saúde, sem autenticação, para orquestradores (kubernetes)
+func addHealthRoutes(r chi.Router) {
+	r.Get("/healthz", HealthHandler)
+	r.Get("/readyz", ReadyHandler)
+}
+
 func addWebRoutes(r chi.Router) {
 	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SIGNING_SECRET")), nil)
 
@@ -64,46 +134,162 @@ func addWebRoutes(r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(jwtauth.Verifier(tokenAuth))
 		r.Use(authenticator)
+		r.Use(totpEnrollmentEnforcer)
+		r.Use(csrfProtect)
 
 		r.Get("/account", AccountFormHandler)
+		r.Get("/account/2fa", TOTPFormHandler)
+		r.Post("/account/2fa", TOTPEnrollHandler)
+		r.Post("/account/2fa/recovery", TOTPRecoveryHandler)
+		r.Post("/account/2fa/disable", TOTPDisableHandler)
+		r.Post("/account/webhook", LifecycleWebHookHandler)
+		r.Post("/account/apikey", APIKeyHandler)
+		r.Post("/account/password", ChangePasswordHandler)
+		r.Post("/account/sessions/revoke", RevokeSessionHandler)
+		r.Post("/account/sessions/revoke/others", RevokeOtherSessionsHandler)
+		r.Get("/users", UsersFormHandler)
+		r.Post("/users/invite", InviteUserHandler)
+		r.Post("/users/disable", DisableUserHandler)
+		r.Post("/users/sessions/revoke", RevokeUserSessionsHandler)
 		r.Get("/bot/verify/ws", VerifyHandler)
 		r.Get("/bot/verify", VerifyFormHandler)
 		r.Post("/bot/delete", DeleteHandler)
 		r.Post("/bot/cycle", CycleHandler)
 		r.Post("/bot/debug", DebugHandler)
+		r.Post("/bot/archive", ArchiveHandler)
 		r.Post("/bot/toggle", ToggleHandler)
+		r.Post("/bot/simulate", SimulateHandler)
 		r.Get("/bot/{botID}", SendFormHandler)
 		r.Get("/bot/{botID}/send", SendFormHandler)
 		r.Post("/bot/{botID}/send", SendHandler)
 		r.Get("/bot/{botID}/receive", ReceiveFormHandler)
+		r.Post("/team", CreateTeamHandler)
+		r.Get("/team/{teamID}", TeamFormHandler)
+		r.Post("/team/{teamID}/member", TeamMemberHandler)
+		r.Post("/team/{teamID}/member/remove", RemoveTeamMemberHandler)
+		r.Post("/team/{teamID}/bot", ShareBotHandler)
+		r.Post("/team/{teamID}/bot/remove", UnshareBotHandler)
+		r.Post("/team/{teamID}/2fa", TeamRequire2FAHandler)
+		r.Post("/team/{teamID}/delete", DeleteTeamHandler)
 	})
 
 	// unauthenticated web routes
 	r.Group(func(r chi.Router) {
+		r.Use(csrfProtect)
 		r.Get("/", IndexHandler)
 		r.Get("/login", LoginFormHandler)
 		r.Post("/login", LoginHandler)
+		r.Get("/login/2fa", LoginTOTPFormHandler)
+		r.Post("/login/2fa", LoginTOTPHandler)
 		r.Get("/setup", SetupFormHandler)
 		r.Post("/setup", SetupHandler)
+		r.Get("/password/forgot", ForgotPasswordFormHandler)
+		r.Post("/password/forgot", ForgotPasswordHandler)
+		r.Get("/password/reset", ResetPasswordFormHandler)
+		r.Post("/password/reset", ResetPasswordHandler)
 		r.Get("/logout", LogoutHandler)
 	})
 }
 
+// Rotas da API dos bots, cada rota aceita o token no caminho (legado) ou nos headers X-QUEPASA-TOKEN e Authorization: Bearer
+// As chaves de acesso dos bots somente acessam as rotas dos seus escopos
+// Os envios, recebimentos e anexos têm limites de requisições próprios por bot, além do limite por endereço
 func addAPIRoutes(r chi.Router) {
 	r.Group(func(r chi.Router) {
-		r.Get("/v1/bot/{token}", InfoAPIHandlerV1)
-		r.Post("/v1/bot/{token}/send", SendAPIHandlerV1)
-		r.Get("/v1/bot/{token}/receive", ReceiveAPIHandlerV1)
-		r.Post("/v1/bot/{token}/attachment", AttachmentAPIHandlerV1)
-		r.Post("/v1/bot/{token}/webhook", WebHookAPIHandlerV1)
+		r.Use(addressRateLimiter)
+		r.Group(func(r chi.Router) {
+			r.Use(requestTimeout)
+			addBotAPIRoutes(r)
+		})
+		addBotStreamRoutes(r)
 	})
+}
+
+func addBotAPIRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(botAuthenticator(""))
+		botRoute(r, "GET", "v1", "", InfoAPIHandlerV1)
+		botRoute(r, "GET", "v2", "", InfoAPIHandlerV2)
+		botRoute(r, "GET", "v2", "/status", StatusAPIHandlerV2)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(botAuthenticator(models.ScopeSend))
+		r.Use(botRateLimiter(models.RateLimitSend))
+		botRoute(r, "POST", "v1", "/send", SendAPIHandlerV1)
+		botRoute(r, "POST", "v2", "/sendtext", SendTextAPIHandlerV2)
+		botRoute(r, "POST", "v2", "/senddocument", SendDocumentAPIHandlerV2)
+		botRoute(r, "POST", "v2", "/inject", InjectAPIHandlerV2)
+		botRoute(r, "DELETE", "v2", "/sent", ClearSentAPIHandlerV2)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(botAuthenticator(models.ScopeReceive))
+		r.Use(botRateLimiter(models.RateLimitReceive))
+		botRoute(r, "GET", "v1", "/receive", ReceiveAPIHandlerV1)
+		botRoute(r, "GET", "v2", "/receive", ReceiveAPIHandlerV2)
+		botRoute(r, "GET", "v2", "/presence", PresenceAPIHandlerV2)
+		botRoute(r, "POST", "v2", "/presence", PresenceSubscribeAPIHandlerV2)
+		botRoute(r, "GET", "v2", "/sent", SentAPIHandlerV2)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(botAuthenticator(models.ScopeMedia))
+		r.Use(botRateLimiter(models.RateLimitAttachment))
+		botRoute(r, "POST", "v1", "/attachment", AttachmentAPIHandlerV1)
+		botRoute(r, "POST", "v2", "/attachment", AttachmentAPIHandlerV2)
+		botRoute(r, "GET", "v2", "/message/{id}/attachment", MessageAttachmentAPIHandlerV2)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(botAuthenticator(models.ScopeWebHookAdmin))
+		botRoute(r, "POST", "v1", "/webhook", WebHookAPIHandlerV1)
+		botRoute(r, "POST", "v2", "/webhook", WebHookAPIHandlerV2)
+		botRoute(r, "POST", "v2", "/battery", BatteryAPIHandlerV2)
+		botRoute(r, "GET", "v2", "/loglevel", LogLevelAPIHandlerV2)
+		botRoute(r, "POST", "v2", "/loglevel", SetLogLevelAPIHandlerV2)
+	})
+}
+
+// Streams abertos por tempo indeterminado, encerrados pelo cliente ou no desligamento
+func addBotStreamRoutes(r chi.Router) {
 	r.Group(func(r chi.Router) {
-		r.Get("/v2/bot/{token}", InfoAPIHandlerV2)
-		r.Post("/v2/bot/{token}/sendtext", SendTextAPIHandlerV2)
-		r.Post("/v2/bot/{token}/senddocument", SendDocumentAPIHandlerV2)
-		r.Get("/v2/bot/{token}/receive", ReceiveAPIHandlerV2)
-		r.Post("/v2/bot/{token}/attachment", AttachmentAPIHandlerV2)
-		r.Post("/v2/bot/{token}/webhook", WebHookAPIHandlerV2)
+		r.Use(botAuthenticator(models.ScopeReceive))
+		r.Use(botRateLimiter(models.RateLimitReceive))
+		botRoute(r, "GET", "v2", "/events", EventsAPIHandlerV2)
+	})
+}
+
+// Rotas de administração, autenticadas pela chave de acesso do usuário ou pelo mesmo JWT das rotas web (cookie ou Authorization: Bearer)
+func addAdminRoutes(r chi.Router) {
+	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SIGNING_SECRET")), nil)
+
+	r.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(apiAuthenticator)
+
+		r.Post("/v2/admin/apikey", APIKeyAdminHandler)
+		r.Get("/v2/admin/bots", BotsAdminHandler)
+		r.Get("/v2/admin/bot/{botID}", BotAdminHandler)
+		r.Delete("/v2/admin/bot/{botID}", DeleteBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/start", StartBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/stop", StopBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/restart", RestartBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/token", CycleTokenBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/devel", DevelBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/ratelimit", RateLimitsBotAdminHandler)
+		r.Get("/v2/admin/bot/{botID}/apikeys", BotAPIKeysAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/apikeys", CreateBotAPIKeyAdminHandler)
+		r.Delete("/v2/admin/bot/{botID}/apikeys/{keyID}", DeleteBotAPIKeyAdminHandler)
+		r.Post("/v2/admin/bot/import", ImportBotAdminHandler)
+		r.Post("/v2/admin/bot/{botID}/export", ExportBotAdminHandler)
+		r.Post("/v2/admin/bot/simulate", SimulateBotAdminHandler)
+		r.Get("/v2/admin/teams", TeamsAdminHandler)
+		r.Post("/v2/admin/teams", CreateTeamAdminHandler)
+		r.Get("/v2/admin/team/{teamID}", TeamAdminHandler)
+		r.Delete("/v2/admin/team/{teamID}", DeleteTeamAdminHandler)
+		r.Post("/v2/admin/team/{teamID}/members", TeamMemberAdminHandler)
+		r.Delete("/v2/admin/team/{teamID}/member/{userID}", RemoveTeamMemberAdminHandler)
+		r.Post("/v2/admin/team/{teamID}/bots", ShareBotAdminHandler)
+		r.Delete("/v2/admin/team/{teamID}/bot/{botID}", UnshareBotAdminHandler)
+		r.Post("/v2/admin/team/{teamID}/2fa", Team2FAAdminHandler)
+		r.Get("/v2/status", ServersStatusAdminHandler)
 	})
 }
 
@@ -137,6 +323,13 @@ func authenticator(next http.Handler) http.Handler {
 			return
 		}
 
+		// Sessão encerrada ou revogada, o JWT ainda válido não basta
+		if err := validateRequestSession(r); err != nil {
+			clearSessionCookie(w)
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -2,9 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"strings"
 
 	"github.com/sufficit/sufficit-quepasa-fork/models"
 )
@@ -20,43 +18,58 @@ func respondSuccess(w http.ResponseWriter, res interface{}) {
 }
 
 func respondBadRequest(w http.ResponseWriter, err error) {
-	log.Println("!Request Bad Format: ", err)
+	models.Log.WithComponent("api").WithError(err).Warnf("bad request")
 
 	respondError(w, err, http.StatusBadRequest)
 }
 
 func respondUnauthorized(w http.ResponseWriter, err error) {
-	log.Println("!Request Unauthorized: ", err)
+	models.Log.WithComponent("api").WithError(err).Warnf("unauthorized request")
 
 	respondError(w, err, http.StatusUnauthorized)
 }
 
 func respondNotFound(w http.ResponseWriter, err error) {
-	log.Println("!Request Not found: ", err)
+	models.Log.WithComponent("api").WithError(err).Warnf("not found")
 
 	respondError(w, err, http.StatusNotFound)
 }
 
+func respondForbidden(w http.ResponseWriter, err error) {
+	models.Log.WithComponent("api").WithError(err).Warnf("forbidden request")
+
+	respondError(w, err, http.StatusForbidden)
+}
+
+// Bot ou equipe inacessível, proibido quando o papel do usuário é insuficiente, senão inexistente
+func respondAccessError(w http.ResponseWriter, err error) {
+	if err == models.ErrBotForbidden || err == models.ErrTeamForbidden {
+		respondForbidden(w, err)
+		return
+	}
+	respondNotFound(w, err)
+}
+
 /// Usado para avisar que o bot ainda não esta pronto
 func respondNotReady(w http.ResponseWriter, err error) {
 	respondError(w, err, http.StatusServiceUnavailable)
 }
 
 func respondServerError(bot models.QPBot, w http.ResponseWriter, err error) {
-	if strings.Contains(err.Error(), "invalid websocket") {
+	if kind := models.ClassifyConnectionError(err); kind == models.ErrorInvalidWebsocket {
 
 		// Desconexão forçado é algum evento iniciado pelo whatsapp
-		log.Printf("(%s) Desconexão forçada por motivo de websocket inválido ou sem resposta", bot.GetNumber())
+		bot.GetLogger().WithComponent("api").Warnf("invalid websocket or no response, forcing reconnection")
 
 		// Reseta
 		waServer, _ := models.GetServer(bot.ID)
 		if waServer != nil {
-			go waServer.Restart()
+			go waServer.Restart(string(kind))
 		}
 
 	} else {
 		if models.ENV.DEBUGRequests() {
-			log.Printf("(%s) !Request Server error: %s", bot.GetNumber(), err)
+			bot.GetLogger().WithComponent("api").WithError(err).Errorf("request server error")
 		}
 	}
 	respondError(w, err, http.StatusInternalServerError)
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Id da sessão web da requisição, o jti do JWT já verificado
+func getSessionID(r *http.Request) string {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return ""
+	}
+
+	sessionID, _ := claims["jti"].(string)
+	return sessionID
+}
+
+// Confirma que a sessão do JWT continua registrada no banco
+// JWTs emitidos antes das sessões, sem jti, são recusados
+func validateRequestSession(r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	userID, _ := claims["user_id"].(string)
+	_, err = models.ValidateUserSession(userID, getSessionID(r))
+	return err
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "jwt", Value: "", MaxAge: -1, Path: "/", HttpOnly: true})
+}
+
+// RevokeSessionHandler renders route POST "/account/sessions/revoke"
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	sessionID := r.Form.Get("sessionID")
+	if err := models.RevokeUserSession(user.ID, sessionID); err != nil {
+		getLogger(r).WithError(err).Errorf("error revoking session")
+		renderAccountForm(w, r, accountFormData{PageTitle: "Account", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	// Revogou a própria sessão, equivale a sair
+	if sessionID == getSessionID(r) {
+		clearSessionCookie(w)
+		redirectToLogin(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusFound)
+}
+
+// RevokeOtherSessionsHandler renders route POST "/account/sessions/revoke/others"
+func RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	if err := models.RevokeUserSessions(user.ID, getSessionID(r)); err != nil {
+		getLogger(r).WithError(err).Errorf("error revoking sessions")
+		renderAccountForm(w, r, accountFormData{PageTitle: "Account", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusFound)
+}
+
+// RevokeUserSessionsHandler renders route POST "/users/sessions/revoke"
+// Encerra todas as sessões web do usuário, que precisa entrar novamente
+func RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.ParseForm()
+	userID := r.Form.Get("userID")
+	if err := models.RevokeAllUserSessions(user, userID); err != nil {
+		renderUsersForm(w, r, usersFormData{PageTitle: "Users", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	if userID == user.ID {
+		clearSessionCookie(w)
+		redirectToLogin(w, r)
+		return
+	}
+
+	renderUsersForm(w, r, usersFormData{PageTitle: "Users", User: user, SuccessMessage: "All sessions of the user were revoked, it must login again"})
+}
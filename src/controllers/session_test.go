@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/jwtauth"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Registra uma sessão para o usuário e retorna o JWT correspondente
+func newTestSessionToken(t *testing.T, user models.QPUser) string {
+	session, err := models.CreateUserSession(user, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatalf("error creating session: %s", err)
+	}
+
+	tokenAuth := jwtauth.New("HS256", []byte(""), nil)
+	_, token, _ := tokenAuth.Encode(jwt.MapClaims{"user_id": user.ID, "jti": session.ID})
+	return token
+}
+
+// Executa a requisição pelas rotas de administração, autenticada pelo cookie da sessão web
+func serveAdminWithCookie(cookie *http.Cookie, method string, path string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	addAdminRoutes(r)
+
+	request := httptest.NewRequest(method, path, nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func TestLoginSessionRevoked(t *testing.T) {
+	newWebTestServer(t)
+	models.WhatsAppService.DB.User.SetPassword("user", "secret")
+
+	w := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"secret"}})
+	cookie := findCookie(w, "jwt")
+	if w.Code != http.StatusFound || cookie == nil {
+		t.Fatalf("expected a session after login, got %d", w.Code)
+	}
+
+	if w := serveAdminWithCookie(cookie, "GET", "/v2/admin/bots"); w.Code != http.StatusOK {
+		t.Fatalf("expected the session to authenticate, got %d", w.Code)
+	}
+
+	sessions, _ := models.FindUserSessions("user")
+	if len(sessions) != 1 || sessions[0].Address != "192.0.2.1" {
+		t.Fatalf("unexpected sessions: %#v", sessions)
+	}
+
+	// Sair revoga a sessão, o mesmo JWT deixa de valer
+	r := chi.NewRouter()
+	addWebRoutes(r)
+	request := httptest.NewRequest("GET", "/logout", nil)
+	request.AddCookie(cookie)
+	r.ServeHTTP(httptest.NewRecorder(), request)
+
+	if w := serveAdminWithCookie(cookie, "GET", "/v2/admin/bots"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session to be rejected, got %d", w.Code)
+	}
+
+	// JWTs sem sessão, emitidos antes da atualização, também são recusados
+	tokenAuth := jwtauth.New("HS256", []byte(""), nil)
+	_, token, _ := tokenAuth.Encode(jwt.MapClaims{"user_id": "user"})
+	if w := serveAdminWithCookie(&http.Cookie{Name: "jwt", Value: token}, "GET", "/v2/admin/bots"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a token without session to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAdminRevokesUserSessions(t *testing.T) {
+	newAdminTestServer(t)
+	addTestUser(t, "member")
+	member, _ := models.WhatsAppService.DB.User.FindByID("member@example.com")
+	cookie := &http.Cookie{Name: "jwt", Value: newTestSessionToken(t, member)}
+	newTestSessionToken(t, member)
+
+	if err := models.RevokeAllUserSessions(member, "user"); err != models.ErrUserNotAdmin {
+		t.Errorf("expected only administrators to revoke sessions, got %v", err)
+	}
+
+	admin, _ := models.WhatsAppService.DB.User.FindByID("user")
+	admin.Admin = true
+	if err := models.RevokeAllUserSessions(admin, member.ID); err != nil {
+		t.Fatalf("error revoking sessions: %s", err)
+	}
+
+	if sessions, _ := models.FindUserSessions(member.ID); len(sessions) != 0 {
+		t.Errorf("expected all sessions revoked, got %d", len(sessions))
+	}
+
+	if w := serveAdminWithCookie(cookie, "GET", "/v2/admin/bots"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session to be rejected, got %d", w.Code)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	newAdminTestServer(t)
+	models.WhatsAppService.DB.User.SetPassword("user", "secret")
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+
+	current, _ := models.CreateUserSession(user, "192.0.2.1", "current")
+	models.CreateUserSession(user, "192.0.2.2", "other")
+
+	if err := models.ChangePassword(user, "secret", "correct horse battery staple", current.ID); err != nil {
+		t.Fatalf("error changing password: %s", err)
+	}
+
+	sessions, _ := models.FindUserSessions(user.ID)
+	if len(sessions) != 1 || sessions[0].ID != current.ID {
+		t.Errorf("expected only the current session to remain, got %#v", sessions)
+	}
+}
+
+func TestLoginDisabledUser(t *testing.T) {
+	newWebTestServer(t)
+	models.WhatsAppService.DB.User.SetPassword("user", "secret")
+	models.WhatsAppService.DB.User.SetDisabled("user", true)
+
+	wrong := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"wrong"}})
+	correct := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"secret"}})
+
+	// A resposta não revela que a senha do usuário desativado está correta
+	if correct.Code != http.StatusUnauthorized || correct.Body.String() != wrong.Body.String() {
+		t.Errorf("unexpected response for a disabled user: %d, %s", correct.Code, correct.Body.String())
+	}
+
+	if findCookie(correct, "jwt") != nil {
+		t.Errorf("session issued to a disabled user")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	newWebTestServer(t)
+	models.WhatsAppService.DB.User.SetPassword("user", "secret")
+	wrong := url.Values{"email": {"user@example.com"}, "password": {"wrong"}}
+
+	for i := 0; i < 3; i++ {
+		if w := serveWebForm("/login", wrong); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d should be tolerated, got %d", i, w.Code)
+		}
+	}
+
+	// A quarta falha bloqueia a conta, nem a senha correta entra
+	serveWebForm("/login", wrong)
+	w := serveWebForm("/login", url.Values{"email": {"User@Example.com"}, "password": {"secret"}})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected the account to be locked, got %d, retry after %s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if findCookie(w, "jwt") != nil {
+		t.Errorf("session issued while locked")
+	}
+}
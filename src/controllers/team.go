@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+//
+// Teams
+//
+
+type teamFormData struct {
+	PageTitle    string
+	ErrorMessage string
+	User         models.QPUser
+	Team         models.QPTeamDetails
+	Roles        []models.QPRole
+
+	// Bots próprios do usuário que ainda podem ser compartilhados com a equipe
+	Shareable []models.QPBotAccess
+}
+
+func renderTeamForm(w http.ResponseWriter, r *http.Request, data teamFormData) {
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/team.tmpl")
+	templates.ExecuteTemplate(w, "main", data)
+}
+
+// Exibe a equipe ao usuário atual, com o erro da última ação caso exista
+func renderTeam(w http.ResponseWriter, r *http.Request, user models.QPUser, teamID string, actionErr error) {
+	data := teamFormData{PageTitle: "Team", User: user, Roles: models.Roles}
+	if actionErr != nil {
+		data.ErrorMessage = actionErr.Error()
+	}
+
+	team, err := models.GetTeamDetails(user.ID, teamID)
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+	data.Team = team
+
+	shared := make(map[string]bool)
+	for _, botID := range team.Bots {
+		shared[botID] = true
+	}
+
+	bots, err := models.FindAllBotsForUser(user.ID)
+	if err != nil {
+		data.ErrorMessage = err.Error()
+	}
+
+	for _, bot := range bots {
+		if bot.Role.IsOwner() && !shared[bot.ID] {
+			data.Shareable = append(data.Shareable, bot)
+		}
+	}
+
+	renderTeamForm(w, r, data)
+}
+
+// CreateTeamHandler renders route POST "/team"
+// O usuário atual passa a ser o dono da nova equipe
+func CreateTeamHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	team, err := models.CreateTeam(user.ID, r.Form.Get("name"))
+	if err != nil {
+		renderAccountForm(w, r, accountFormData{PageTitle: "Account", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	http.Redirect(w, r, "/team/"+team.ID, http.StatusFound)
+}
+
+// TeamFormHandler renders route GET "/team/{teamID}"
+func TeamFormHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	renderTeam(w, r, user, chi.URLParam(r, "teamID"), nil)
+}
+
+// TeamMemberHandler renders route POST "/team/{teamID}/member"
+// Inclui um usuário já cadastrado pelo email ou altera o seu papel
+func TeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	teamAction(w, r, func(user models.QPUser, teamID string) error {
+		role, err := models.ParseRole(r.Form.Get("role"))
+		if err != nil {
+			return err
+		}
+		return models.SetTeamMember(user.ID, teamID, r.Form.Get("email"), role)
+	})
+}
+
+// RemoveTeamMemberHandler renders route POST "/team/{teamID}/member/remove"
+func RemoveTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	teamID := chi.URLParam(r, "teamID")
+	memberID := r.Form.Get("userID")
+	if err := models.RemoveTeamMember(user.ID, teamID, memberID); err != nil {
+		renderTeam(w, r, user, teamID, err)
+		return
+	}
+
+	// Quem deixou a equipe não a vê mais
+	if memberID == user.ID {
+		http.Redirect(w, r, "/account", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/team/"+teamID, http.StatusFound)
+}
+
+// ShareBotHandler renders route POST "/team/{teamID}/bot"
+func ShareBotHandler(w http.ResponseWriter, r *http.Request) {
+	teamAction(w, r, func(user models.QPUser, teamID string) error {
+		return models.ShareBotWithTeam(user.ID, teamID, r.Form.Get("botID"))
+	})
+}
+
+// UnshareBotHandler renders route POST "/team/{teamID}/bot/remove"
+func UnshareBotHandler(w http.ResponseWriter, r *http.Request) {
+	teamAction(w, r, func(user models.QPUser, teamID string) error {
+		return models.UnshareBotFromTeam(user.ID, teamID, r.Form.Get("botID"))
+	})
+}
+
+// TeamRequire2FAHandler renders route POST "/team/{teamID}/2fa"
+// Membros sem o segundo fator precisam cadastrá-lo no próximo acesso à interface web
+func TeamRequire2FAHandler(w http.ResponseWriter, r *http.Request) {
+	teamAction(w, r, func(user models.QPUser, teamID string) error {
+		return models.SetTeamRequire2FA(user.ID, teamID, r.Form.Get("required") == "true")
+	})
+}
+
+// DeleteTeamHandler renders route POST "/team/{teamID}/delete"
+// Os bots compartilhados continuam com os seus donos
+func DeleteTeamHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	teamID := chi.URLParam(r, "teamID")
+	if err := models.DeleteTeam(user.ID, teamID); err != nil {
+		renderTeam(w, r, user, teamID, err)
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusFound)
+}
+
+// Executa a ação do formulário sobre a equipe e volta para a página da equipe
+func teamAction(w http.ResponseWriter, r *http.Request, action func(models.QPUser, string) error) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	teamID := chi.URLParam(r, "teamID")
+	if err := action(user, teamID); err != nil {
+		getLogger(r).WithError(err).Warnf("team %s action failed", teamID)
+		renderTeam(w, r, user, teamID, err)
+		return
+	}
+
+	http.Redirect(w, r, "/team/"+teamID, http.StatusFound)
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Cookie do login aguardando o segundo fator, não autentica nenhuma rota
+const pendingLoginCookie = "login2fa"
+
+// Tempo para informar o código após a senha
+const pendingLoginExpiry = 5 * time.Minute
+
+//
+// Login
+//
+
+type loginTOTPFormData struct {
+	PageTitle    string
+	ErrorMessage string
+}
+
+func renderLoginTOTPForm(w http.ResponseWriter, r *http.Request, data loginTOTPFormData) {
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/login_2fa.tmpl")
+	templates.ExecuteTemplate(w, "main", data)
+}
+
+// Senha confirmada, guarda o usuário em um JWT próprio e de curta duração até o segundo fator
+func setPendingLoginCookie(w http.ResponseWriter, user models.QPUser) {
+	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SIGNING_SECRET")), nil)
+	claims := jwt.MapClaims{"pending_user_id": user.ID}
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiryIn(claims, pendingLoginExpiry)
+	_, tokenString, _ := tokenAuth.Encode(claims)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingLoginCookie,
+		Value:    tokenString,
+		MaxAge:   int(pendingLoginExpiry.Seconds()),
+		Path:     "/login",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearPendingLoginCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: pendingLoginCookie, Value: "", MaxAge: -1, Path: "/login", HttpOnly: true})
+}
+
+// Usuário que já informou a senha e aguarda o segundo fator
+func getPendingLoginUser(r *http.Request) (user models.QPUser, err error) {
+	cookie, err := r.Cookie(pendingLoginCookie)
+	if err != nil {
+		return user, errors.New("login expired, please login again")
+	}
+
+	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SIGNING_SECRET")), nil)
+	token, err := tokenAuth.Decode(cookie.Value)
+	if err != nil || !token.Valid {
+		return user, errors.New("login expired, please login again")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return user, errors.New("login expired, please login again")
+	}
+
+	userID, _ := claims["pending_user_id"].(string)
+	user, err = models.WhatsAppService.DB.User.FindByID(userID)
+	if err != nil || user.Disabled {
+		return user, errors.New("login expired, please login again")
+	}
+	return
+}
+
+// LoginTOTPFormHandler renders route GET "/login/2fa"
+func LoginTOTPFormHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := getPendingLoginUser(r); err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	renderLoginTOTPForm(w, r, loginTOTPFormData{PageTitle: "Two-factor authentication"})
+}
+
+// LoginTOTPHandler renders route POST "/login/2fa"
+// Aceita o código do aplicativo ou um código de recuperação
+func LoginTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := getPendingLoginUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	address := getRemoteAddress(r)
+	if wait := models.CheckLoginLockout(user.Email, address); wait > 0 {
+		respondLoginLocked(w, r, user.Email, wait)
+		return
+	}
+
+	r.ParseForm()
+	if err := models.VerifySecondFactor(user, r.Form.Get("code")); err != nil {
+		getLogger(r).WithError(err).Warnf("two-factor login failed for %s", user.Email)
+		models.LoginFailed(user.Email, address, "2fa")
+		renderLoginTOTPForm(w, r, loginTOTPFormData{PageTitle: "Two-factor authentication", ErrorMessage: err.Error()})
+		return
+	}
+
+	clearPendingLoginCookie(w)
+	completeLogin(w, r, user)
+}
+
+//
+// Enrollment
+//
+
+type totpFormData struct {
+	PageTitle    string
+	ErrorMessage string
+	User         models.QPUser
+
+	// Exigido por esta equipe, quando houver
+	RequiredBy string
+
+	// Cadastro em andamento
+	Secret string
+	QRCode template.URL
+
+	// Exibidos uma única vez, ao ativar ou gerar novamente
+	RecoveryCodes []string
+}
+
+func renderTOTPForm(w http.ResponseWriter, r *http.Request, data totpFormData) {
+	data.RequiredBy, _ = models.IsTOTPRequired(data.User.ID)
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/account_2fa.tmpl")
+	templates.ExecuteTemplate(w, "main", data)
+}
+
+// Inicia um novo cadastro, com um novo segredo, e exibe o QR code
+func renderTOTPEnrollment(w http.ResponseWriter, r *http.Request, user models.QPUser, errorMessage string) {
+	data := totpFormData{PageTitle: "Two-factor authentication", User: user, ErrorMessage: errorMessage}
+
+	secret, err := models.BeginTOTPEnrollment(user)
+	if err != nil {
+		getLogger(r).WithError(err).Errorf("error starting two-factor enrollment")
+		data.ErrorMessage = err.Error()
+		renderTOTPForm(w, r, data)
+		return
+	}
+
+	data.Secret = secret
+	png, err := models.TOTPQRCode(models.TOTPURI(user.Email, secret))
+	if err != nil {
+		data.ErrorMessage = err.Error()
+	} else {
+		data.QRCode = template.URL("data:image/png;base64," + png)
+	}
+
+	renderTOTPForm(w, r, data)
+}
+
+// TOTPFormHandler renders route GET "/account/2fa"
+func TOTPFormHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		renderTOTPEnrollment(w, r, user, "")
+		return
+	}
+
+	renderTOTPForm(w, r, totpFormData{PageTitle: "Two-factor authentication", User: user})
+}
+
+// TOTPEnrollHandler renders route POST "/account/2fa"
+// Confirma o cadastro com o primeiro código do aplicativo
+func TOTPEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	codes, err := models.ConfirmTOTPEnrollment(user, r.Form.Get("code"))
+	if err != nil {
+		renderTOTPEnrollment(w, r, user, err.Error()+", scan the new code and try again")
+		return
+	}
+
+	user.TOTPEnabled = true
+	renderTOTPForm(w, r, totpFormData{PageTitle: "Two-factor authentication", User: user, RecoveryCodes: codes})
+}
+
+// TOTPRecoveryHandler renders route POST "/account/2fa/recovery"
+func TOTPRecoveryHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	data := totpFormData{PageTitle: "Two-factor authentication", User: user}
+	data.RecoveryCodes, err = models.RegenerateRecoveryCodes(user, r.Form.Get("code"))
+	if err != nil {
+		data.ErrorMessage = err.Error()
+	}
+
+	renderTOTPForm(w, r, data)
+}
+
+// TOTPDisableHandler renders route POST "/account/2fa/disable"
+func TOTPDisableHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	if err := models.DisableTOTP(user, r.Form.Get("code")); err != nil {
+		renderTOTPForm(w, r, totpFormData{PageTitle: "Two-factor authentication", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusFound)
+}
+
+// Membros de equipes que exigem o segundo fator só acessam o seu cadastro até concluí-lo
+func totpEnrollmentEnforcer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/account/2fa") {
+			if user, err := models.GetUser(r); err == nil && models.RequiresTOTPEnrollment(user) {
+				http.Redirect(w, r, "/account/2fa", http.StatusFound)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Prepara o serviço para as rotas web, sem tentativas de login nem de segundo fator anteriores
+func newWebTestServer(t *testing.T) (apikey string) {
+	apikey, _, _ = newAdminTestServer(t)
+	resetTestLimiters(t, models.LoginGuard, models.TOTPRateLimiter)
+	return
+}
+
+// Executa o formulário pelas rotas web, com os cookies informados
+// Inclui o token CSRF válido, exceto quando o formulário já informa um
+func serveWebForm(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	addWebRoutes(r)
+
+	csrf := &http.Cookie{Name: csrfCookie, Value: strings.Repeat("0", 64)}
+	values := url.Values{csrfFormField: {signCSRFValue(csrf.Value)}}
+	for key, value := range form {
+		values[key] = value
+	}
+
+	request := httptest.NewRequest("POST", path, strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(csrf)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name && len(cookie.Value) > 0 {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// Ativa o segundo fator do usuário, retorna o segredo e os códigos de recuperação
+func enrollTestTOTP(t *testing.T, userID string) (string, []string) {
+	user, _ := models.WhatsAppService.DB.User.FindByID(userID)
+	secret, err := models.BeginTOTPEnrollment(user)
+	if err != nil {
+		t.Fatalf("error starting enrollment: %s", err)
+	}
+
+	user, _ = models.WhatsAppService.DB.User.FindByID(userID)
+	if _, err := models.ConfirmTOTPEnrollment(user, "000000"); err != models.ErrTOTPInvalid {
+		t.Errorf("expected a wrong code to be rejected, got %v", err)
+	}
+
+	code, _ := models.TOTPCode(secret, time.Now())
+	codes, err := models.ConfirmTOTPEnrollment(user, code)
+	if err != nil {
+		t.Fatalf("error confirming enrollment: %s", err)
+	}
+	return secret, codes
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	newWebTestServer(t)
+	models.WhatsAppService.DB.User.SetPassword("user", "secret")
+	_, codes := enrollTestTOTP(t, "user")
+	if len(codes) != 10 {
+		t.Fatalf("unexpected recovery codes: %v", codes)
+	}
+
+	w := serveWebForm("/login", url.Values{"email": {"user@example.com"}, "password": {"secret"}})
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "/login/2fa" {
+		t.Fatalf("expected the second step, got %d %s", w.Code, location)
+	}
+
+	if findCookie(w, "jwt") != nil {
+		t.Fatalf("session issued before the second factor")
+	}
+
+	pending := findCookie(w, pendingLoginCookie)
+	if pending == nil {
+		t.Fatalf("pending login cookie not set")
+	}
+
+	if w := serveWebForm("/login/2fa", url.Values{"code": {codes[0]}}); w.Header().Get("Location") != "/login" {
+		t.Errorf("expected the second step to require the pending login, got %d", w.Code)
+	}
+
+	w = serveWebForm("/login/2fa", url.Values{"code": {codes[0]}}, pending)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "/account" {
+		t.Fatalf("expected login with a recovery code, got %d %s", w.Code, location)
+	}
+
+	if findCookie(w, "jwt") == nil {
+		t.Errorf("session not issued after the second factor")
+	}
+
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+	if user.RecoveryCodesLeft() != 9 {
+		t.Errorf("recovery code not consumed, %d left", user.RecoveryCodesLeft())
+	}
+
+	if err := models.VerifySecondFactor(user, codes[0]); err != models.ErrTOTPInvalid {
+		t.Errorf("expected a recovery code to be used once, got %v", err)
+	}
+}
+
+func TestTOTPCodeUsedOnce(t *testing.T) {
+	newWebTestServer(t)
+	secret, _ := enrollTestTOTP(t, "user")
+
+	// O código da confirmação já foi utilizado, o seguinte é aceito uma única vez
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+	current, _ := models.TOTPCode(secret, time.Now())
+	if err := models.VerifySecondFactor(user, current); err != models.ErrTOTPInvalid {
+		t.Errorf("expected the enrollment code to be rejected, got %v", err)
+	}
+
+	next, _ := models.TOTPCode(secret, time.Now().Add(30*time.Second))
+	if err := models.VerifySecondFactor(user, next); err != nil {
+		t.Errorf("expected the next code to be accepted: %s", err)
+	}
+
+	if err := models.VerifySecondFactor(user, next); err != models.ErrTOTPInvalid {
+		t.Errorf("expected a code to be used once, got %v", err)
+	}
+}
+
+func TestTeamRequiresTOTP(t *testing.T) {
+	apikey := newWebTestServer(t)
+	addTestUser(t, "member")
+	teamID := newSharedTestTeam(t, apikey, "member@example.com", models.RoleOperator)
+
+	if w := serveAdmin(apikey, "POST", "/v2/admin/team/"+teamID+"/2fa", models.QPTeam2FARequestV2{Required: true}); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status requiring 2fa: %d, %s", w.Code, w.Body.String())
+	}
+
+	member, _ := models.WhatsAppService.DB.User.FindByID("member@example.com")
+	if !models.RequiresTOTPEnrollment(member) {
+		t.Fatalf("expected the member to require enrollment")
+	}
+
+	// A sessão web do membro fica restrita ao cadastro do segundo fator
+	token := newTestSessionToken(t, member)
+
+	r := chi.NewRouter()
+	addAdminRoutes(r)
+	request := httptest.NewRequest("GET", "/v2/admin/bots", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden before enrollment, got %d", w.Code)
+	}
+
+	enrollTestTOTP(t, member.ID)
+	member, _ = models.WhatsAppService.DB.User.FindByID(member.ID)
+	if err := models.DisableTOTP(member, "any"); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Errorf("expected disabling to be refused while required, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected access after enrollment, got %d", w.Code)
+	}
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+//
+// Password
+//
+
+type passwordFormData struct {
+	PageTitle      string
+	ErrorMessage   string
+	SuccessMessage string
+	Token          string
+}
+
+func renderPasswordForm(w http.ResponseWriter, r *http.Request, view string, data passwordFormData) {
+	templates := parseTemplates(r, "views/layouts/main.tmpl", view)
+	templates.ExecuteTemplate(w, "main", data)
+}
+
+// ChangePasswordHandler renders route POST "/account/password"
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	r.ParseForm()
+	data := accountFormData{PageTitle: "Account", User: user}
+	password := r.Form.Get("password")
+	if password != r.Form.Get("passwordConfirm") {
+		data.ErrorMessage = "Passwords don't match"
+	} else if err := models.ChangePassword(user, r.Form.Get("current"), password, getSessionID(r)); err != nil {
+		data.ErrorMessage = err.Error()
+	} else {
+		data.SuccessMessage = "Password changed, your other sessions were signed out"
+	}
+
+	renderAccountForm(w, r, data)
+}
+
+// ForgotPasswordFormHandler renders route GET "/password/forgot"
+func ForgotPasswordFormHandler(w http.ResponseWriter, r *http.Request) {
+	renderPasswordForm(w, r, "views/password_forgot.tmpl", passwordFormData{PageTitle: "Forgot password"})
+}
+
+// ForgotPasswordHandler renders route POST "/password/forgot"
+// Responde da mesma forma para emails cadastrados ou não
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	data := passwordFormData{PageTitle: "Forgot password"}
+
+	r.ParseForm()
+	email := r.Form.Get("email")
+	if allowed, wait := models.AllowPasswordReset(email, getRemoteAddress(r)); !allowed {
+		getLogger(r).WithField("remote", r.RemoteAddr).Warnf("password reset limited for %s", email)
+		data.ErrorMessage = models.PasswordResetLimitedError(wait).Error()
+		w.Header().Set("Retry-After", strconv.Itoa(models.RetryAfterSeconds(wait)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderPasswordForm(w, r, "views/password_forgot.tmpl", data)
+		return
+	}
+
+	if err := models.RequestPasswordReset(email, getBaseURL()); err != nil {
+		data.ErrorMessage = err.Error()
+	} else {
+		data.SuccessMessage = "If this email is registered, a link to choose a new password was sent to it"
+	}
+
+	renderPasswordForm(w, r, "views/password_forgot.tmpl", data)
+}
+
+// ResetPasswordFormHandler renders route GET "/password/reset"
+// Usado pelos links de redefinição de senha e de convite
+func ResetPasswordFormHandler(w http.ResponseWriter, r *http.Request) {
+	data := passwordFormData{PageTitle: "Choose your password", Token: r.URL.Query().Get("token")}
+	if _, err := models.FindUserByResetToken(data.Token); err != nil {
+		data.ErrorMessage = err.Error()
+	}
+
+	renderPasswordForm(w, r, "views/password_reset.tmpl", data)
+}
+
+// ResetPasswordHandler renders route POST "/password/reset"
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	data := passwordFormData{PageTitle: "Choose your password", Token: r.Form.Get("token")}
+
+	password := r.Form.Get("password")
+	if password != r.Form.Get("passwordConfirm") {
+		data.ErrorMessage = "Passwords don't match"
+		renderPasswordForm(w, r, "views/password_reset.tmpl", data)
+		return
+	}
+
+	if _, err := models.ResetPassword(data.Token, password); err != nil {
+		data.ErrorMessage = err.Error()
+		renderPasswordForm(w, r, "views/password_reset.tmpl", data)
+		return
+	}
+
+	redirectToLogin(w, r)
+}
+
+//
+// Users
+//
+
+type usersFormData struct {
+	PageTitle      string
+	ErrorMessage   string
+	SuccessMessage string
+	User           models.QPUser
+	Users          []models.QPUser
+
+	// Link do convite, exibido quando o email não pôde ser enviado
+	InviteLink string
+}
+
+func renderUsersForm(w http.ResponseWriter, r *http.Request, data usersFormData) {
+	users, err := models.WhatsAppService.DB.User.FindAll()
+	if err != nil {
+		data.ErrorMessage = err.Error()
+	} else {
+		data.Users = users
+	}
+
+	templates := parseTemplates(r, "views/layouts/main.tmpl", "views/users.tmpl")
+	templates.ExecuteTemplate(w, "main", data)
+}
+
+// Usuário logado, somente administradores
+func getAdminUser(w http.ResponseWriter, r *http.Request) (user models.QPUser, ok bool) {
+	user, err := models.GetUser(r)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+
+	if !user.Admin {
+		respondForbidden(w, models.ErrUserNotAdmin)
+		return
+	}
+	return user, true
+}
+
+// UsersFormHandler renders route GET "/users"
+func UsersFormHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	renderUsersForm(w, r, usersFormData{PageTitle: "Users", User: user})
+}
+
+// InviteUserHandler renders route POST "/users/invite"
+// Cria o usuário e envia por email o link para que escolha a sua senha
+func InviteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.ParseForm()
+	data := usersFormData{PageTitle: "Users", User: user}
+	email := strings.TrimSpace(r.Form.Get("email"))
+	if !validateEmail(email) {
+		data.ErrorMessage = "Email is invalid"
+		renderUsersForm(w, r, data)
+		return
+	}
+
+	_, link, err := models.InviteUser(user, email, r.Form.Get("admin") == "true", getBaseURL())
+	if err != nil {
+		data.ErrorMessage = err.Error()
+		if len(link) > 0 {
+			// Usuário criado, somente o email falhou
+			data.ErrorMessage = fmt.Sprintf("Invitation created, but it could not be emailed (%s), send this link to %s", err, email)
+			data.InviteLink = link
+		}
+		renderUsersForm(w, r, data)
+		return
+	}
+
+	data.SuccessMessage = fmt.Sprintf("Invitation sent to %s", email)
+	renderUsersForm(w, r, data)
+}
+
+// DisableUserHandler renders route POST "/users/disable"
+// Usuários desabilitados não entram nem usam a API, seus bots continuam em funcionamento
+func DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getAdminUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.ParseForm()
+	disabled := r.Form.Get("disabled") == "true"
+	if err := models.SetUserDisabled(user, r.Form.Get("userID"), disabled); err != nil {
+		renderUsersForm(w, r, usersFormData{PageTitle: "Users", User: user, ErrorMessage: err.Error()})
+		return
+	}
+
+	http.Redirect(w, r, "/users", http.StatusFound)
+}
+
+//
+// Helpers
+//
+
+// Endereço público da interface web, usado nos links enviados por email
+// Somente o WEBURL configurado, o host da requisição pode ser forjado
+func getBaseURL() string {
+	return strings.TrimRight(os.Getenv("WEBURL"), "/")
+}
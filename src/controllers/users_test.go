@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+// Emails enviados, ao invés de entregues
+type testMailer struct {
+	sent []testMail
+	sync *sync.Mutex
+}
+
+type testMail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func (mailer *testMailer) Send(to string, subject string, body string) error {
+	mailer.sync.Lock()
+	mailer.sent = append(mailer.sent, testMail{to, subject, body})
+	mailer.sync.Unlock()
+	return nil
+}
+
+func newTestMailer(t *testing.T) *testMailer {
+	mailer := &testMailer{sync: &sync.Mutex{}}
+	models.Mailer = mailer
+	t.Cleanup(func() { models.Mailer = nil })
+	return mailer
+}
+
+var resetLinkPattern = regexp.MustCompile(`https://quepasa.example.com/password/reset\?token=([0-9a-f]+)`)
+
+func TestInviteAndResetPassword(t *testing.T) {
+	newAdminTestServer(t)
+	mailer := newTestMailer(t)
+
+	admin, _ := models.WhatsAppService.DB.User.FindByID("user")
+	if _, _, err := models.InviteUser(admin, "colleague@example.com", false, "https://quepasa.example.com"); err != models.ErrUserNotAdmin {
+		t.Fatalf("expected only administrators to invite, got %v", err)
+	}
+
+	models.WhatsAppService.DB.User.SetAdmin("user", true)
+	admin, _ = models.WhatsAppService.DB.User.FindByID("user")
+	if _, _, err := models.InviteUser(admin, "colleague@example.com", false, "https://quepasa.example.com"); err != nil {
+		t.Fatalf("error inviting: %s", err)
+	}
+
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "colleague@example.com" {
+		t.Fatalf("invitation not sent: %#v", mailer.sent)
+	}
+
+	match := resetLinkPattern.FindStringSubmatch(mailer.sent[0].Body)
+	if match == nil {
+		t.Fatalf("invitation without link: %s", mailer.sent[0].Body)
+	}
+
+	if _, err := models.ResetPassword(match[1], "123"); err == nil {
+		t.Errorf("expected a weak password to be rejected")
+	}
+
+	if _, err := models.ResetPassword(match[1], "correct horse battery staple"); err != nil {
+		t.Fatalf("error choosing the password: %s", err)
+	}
+
+	if _, err := models.AuthenticateUser("colleague@example.com", "correct horse battery staple"); err != nil {
+		t.Errorf("expected login with the chosen password: %s", err)
+	}
+
+	// O link é de uso único
+	if _, err := models.ResetPassword(match[1], "another strong passphrase"); err != models.ErrResetTokenInvalid {
+		t.Errorf("expected the link to be used once, got %v", err)
+	}
+}
+
+func TestPasswordResetExpires(t *testing.T) {
+	newAdminTestServer(t)
+	mailer := newTestMailer(t)
+
+	if err := models.RequestPasswordReset("unknown@example.com", "https://quepasa.example.com"); err != nil || len(mailer.sent) != 0 {
+		t.Fatalf("unknown emails must not fail nor send mail: %v, %#v", err, mailer.sent)
+	}
+
+	if err := models.RequestPasswordReset("user@example.com", "https://quepasa.example.com"); err != nil {
+		t.Fatalf("error requesting reset: %s", err)
+	}
+
+	match := resetLinkPattern.FindStringSubmatch(mailer.sent[0].Body)
+	if match == nil {
+		t.Fatalf("reset mail without link: %s", mailer.sent[0].Body)
+	}
+
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+	expired := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	models.WhatsAppService.DB.User.SetResetToken(user.ID, user.ResetToken, expired)
+
+	if _, err := models.ResetPassword(match[1], "correct horse battery staple"); err != models.ErrResetTokenInvalid {
+		t.Errorf("expected an expired link to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordResetRequiresWebURL(t *testing.T) {
+	newAdminTestServer(t)
+	mailer := newTestMailer(t)
+
+	// Sem WEBURL nenhum link é enviado, o host da requisição não é confiável
+	if err := models.RequestPasswordReset("user@example.com", ""); err != models.ErrWebURLMissing {
+		t.Errorf("expected the reset to be refused without WEBURL, got %v", err)
+	}
+
+	models.WhatsAppService.DB.User.SetAdmin("user", true)
+	admin, _ := models.WhatsAppService.DB.User.FindByID("user")
+	if _, _, err := models.InviteUser(admin, "colleague@example.com", false, ""); err != models.ErrWebURLMissing {
+		t.Errorf("expected the invitation to be refused without WEBURL, got %v", err)
+	}
+
+	if exists, _ := models.WhatsAppService.DB.User.Exists("colleague@example.com"); exists {
+		t.Errorf("expected no user to be created without WEBURL")
+	}
+
+	if len(mailer.sent) != 0 {
+		t.Errorf("expected no mail without WEBURL, got %#v", mailer.sent)
+	}
+}
+
+func TestPasswordResetRateLimit(t *testing.T) {
+	resetTestLimiters(t, models.PasswordResetRateLimiter)
+	t.Setenv("PASSWORDRESETLIMIT", "2")
+	t.Setenv("PASSWORDRESETLIMITIP", "3")
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := models.AllowPasswordReset("user@example.com", "192.0.2.1"); !allowed {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+
+	allowed, wait := models.AllowPasswordReset("User@Example.com", "192.0.2.2")
+	if allowed || wait < 20*time.Minute {
+		t.Errorf("expected the email to be limited for about half an hour, got %v, %s", allowed, wait)
+	}
+
+	if allowed, _ := models.AllowPasswordReset("other@example.com", "192.0.2.1"); !allowed {
+		t.Errorf("expected another email to be allowed")
+	}
+
+	if allowed, _ := models.AllowPasswordReset("third@example.com", "192.0.2.1"); allowed {
+		t.Errorf("expected the address to be limited")
+	}
+}
+
+func TestDisabledUser(t *testing.T) {
+	apikey, _, _ := newAdminTestServer(t)
+	models.WhatsAppService.DB.User.Create("colleague@example.com", "")
+	models.WhatsAppService.DB.User.SetAdmin("colleague@example.com", true)
+	admin, _ := models.WhatsAppService.DB.User.FindByID("colleague@example.com")
+
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+	if err := models.SetUserDisabled(user, user.ID, true); err != models.ErrUserNotAdmin {
+		t.Errorf("expected only administrators to disable users, got %v", err)
+	}
+
+	if err := models.SetUserDisabled(admin, admin.ID, true); err == nil {
+		t.Errorf("expected administrators not to disable themselves")
+	}
+
+	if err := models.SetUserDisabled(admin, "user", true); err != nil {
+		t.Fatalf("error disabling: %s", err)
+	}
+
+	if w := serveAdmin(apikey, "GET", "/v2/admin/bots", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized for a disabled user, got %d", w.Code)
+	}
+
+	if err := models.SetUserDisabled(admin, "user", false); err != nil {
+		t.Fatalf("error enabling: %s", err)
+	}
+
+	if w := serveAdmin(apikey, "GET", "/v2/admin/bots", nil); w.Code != http.StatusOK {
+		t.Errorf("expected the enabled user to be accepted, got %d", w.Code)
+	}
+}
+
+func TestLifecycleWebHook(t *testing.T) {
+	newWebTestServer(t)
+	t.Setenv("LIFECYCLEWEBHOOK", "https://example.com/default")
+	server, _ := models.WhatsAppService.Servers.Get(testBotID)
+	user, _ := models.WhatsAppService.DB.User.FindByID("user")
+
+	for _, webhook := range []string{"not a url", "/relative", "ftp://example.com/hook", "https://"} {
+		if err := models.SetUserLifecycleWebHook(user, webhook); err != models.ErrInvalidWebHook {
+			t.Errorf("expected %q to be rejected, got %v", webhook, err)
+		}
+	}
+
+	cookie := &http.Cookie{Name: "jwt", Value: newTestSessionToken(t, user)}
+	if w := serveWebForm("/account/webhook", url.Values{"url": {" https://example.com/hook "}}, cookie); w.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d", w.Code)
+	}
+
+	if user, _ = models.WhatsAppService.DB.User.FindByID("user"); user.LifecycleWebHook != "https://example.com/hook" {
+		t.Errorf("expected the webhook to be stored, got %q", user.LifecycleWebHook)
+	}
+
+	// Servidores em execução recebem o novo endereço sem consultar o banco
+	if webhook := server.GetLifecycleWebHook(); webhook != "https://example.com/hook" {
+		t.Errorf("expected the running server to use the new webhook, got %q", webhook)
+	}
+
+	if err := models.SetUserLifecycleWebHook(user, ""); err != nil {
+		t.Fatalf("error clearing webhook: %s", err)
+	}
+
+	if webhook := server.GetLifecycleWebHook(); webhook != "https://example.com/default" {
+		t.Errorf("expected the default webhook once cleared, got %q", webhook)
+	}
+}
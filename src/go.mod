@@ -4,7 +4,7 @@ require (
 	github.com/go-chi/chi v4.1.1+incompatible
 	github.com/go-sql-driver/mysql v1.6.0 // indirect
 	github.com/golang-migrate/migrate/v4 v4.14.1 // indirect
-	github.com/joho/godotenv v1.3.0 // indirect
+	github.com/joho/godotenv v1.3.0
 	github.com/joncalhoun/migrate v0.0.2 // indirect
 	github.com/prometheus/client_golang v1.6.0
 	github.com/sufficit/sufficit-quepasa-fork/controllers v0.0.0
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/Rhymen/go-whatsapp"
@@ -52,11 +51,8 @@ func SendTextMessage(botID string, recipient string, text string) (response mode
 		RemoteJid: recipient,
 	}
 
-	if server.IsDevelopment() {
-		log.Printf("(%s)(DEV) Sending msg from bot :: %s :: %s", server.Bot.GetNumber(), recipient, text)
-	}
+	server.Log.Debugf("sending message :: %s :: %s", recipient, text)
 
-	// log.Printf("sending message from bot: %s :: to recipient: %s", botID, recipient)
 	if len(text) > 0 {
 		msg := whatsapp.TextMessage{
 			Info: info,
@@ -68,7 +64,7 @@ func SendTextMessage(botID string, recipient string, text string) (response mode
 	}
 
 	if err != nil {
-		log.Printf("(%s) recipient: %s :: error sending text message", server.Bot.GetNumber(), recipient)
+		server.Log.WithField("recipient", recipient).WithError(err).Errorf("error sending text message")
 	}
 
 	return
@@ -91,11 +87,8 @@ func SendDocumentMessage(botID string, recipient string, attachment models.QPAtt
 		RemoteJid: recipient,
 	}
 
-	if server.IsDevelopment() {
-		log.Printf("(%s)(DEV) Sending document from bot :: %s", server.Bot.GetNumber(), recipient)
-	}
+	server.Log.Debugf("sending document :: %s", recipient)
 
-	// log.Printf("sending message from bot: %s :: to recipient: %s", botID, recipient)
 	if attachment.Length > 0 {
 		var data []byte
 		data, err = base64.StdEncoding.DecodeString(attachment.Base64)
@@ -153,7 +146,7 @@ func SendDocumentMessage(botID string, recipient string, attachment models.QPAtt
 	}
 
 	if err != nil {
-		log.Printf("(%s) recipient: %s :: error sending message, attachment: %s :: %s", server.Bot.GetNumber(), recipient, attachment.MIME, attachment.FileName)
+		server.Log.WithField("recipient", recipient).WithError(err).Errorf("error sending message, attachment: %s :: %s", attachment.MIME, attachment.FileName)
 	}
 
 	return
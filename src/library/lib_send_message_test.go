@@ -0,0 +1,140 @@
+package library
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/Rhymen/go-whatsapp"
+	"github.com/sufficit/sufficit-quepasa-fork/models"
+)
+
+const (
+	testBotID     = "5521999990000@c.us"
+	testRecipient = "5521988887777@s.whatsapp.net"
+)
+
+func newSendTestServer(t *testing.T) (*models.QPWhatsAppServer, *models.QPFakeConnection) {
+	con := models.NewQPFakeConnection(testBotID)
+	con.AddContact(whatsapp.Contact{Jid: testRecipient, Name: "Fulano"})
+	server := models.AppendFakeServer(models.QPBot{ID: testBotID}, con)
+	t.Cleanup(func() { models.WhatsAppService.Servers.Remove(testBotID) })
+	return server, con
+}
+
+func TestSendValidate(t *testing.T) {
+	valid := []string{testRecipient, "+" + testRecipient, "552199999-1600000000@g.us"}
+	for _, recipient := range valid {
+		if err := SendValidate(testBotID, recipient); err != nil {
+			t.Errorf("%s should be valid: %s", recipient, err)
+		}
+	}
+
+	invalid := []string{"5521988887777", "5521988887777@c.us", ""}
+	for _, recipient := range invalid {
+		if err := SendValidate(testBotID, recipient); err == nil {
+			t.Errorf("%s should be invalid", recipient)
+		}
+	}
+}
+
+func TestSendTextMessage(t *testing.T) {
+	_, con := newSendTestServer(t)
+
+	response, err := SendTextMessage(testBotID, testRecipient, "olá")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(response.ID) == 0 || response.Chat.ID != testRecipient || response.Chat.Title != "Fulano" || response.From.ID != testBotID {
+		t.Errorf("unexpected response: %#v", response)
+	}
+
+	sent := con.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 sent message, got %d", len(sent))
+	}
+
+	msg, ok := sent[0].(whatsapp.TextMessage)
+	if !ok || msg.Text != "olá" || msg.Info.RemoteJid != testRecipient {
+		t.Errorf("unexpected message sent: %#v", sent[0])
+	}
+}
+
+func TestSendTextMessageErrors(t *testing.T) {
+	server, con := newSendTestServer(t)
+
+	if _, err := SendTextMessage(testBotID, testRecipient, ""); err == nil {
+		t.Errorf("expected error for empty text")
+	}
+
+	if _, err := SendTextMessage("5521900000000@c.us", testRecipient, "olá"); err == nil {
+		t.Errorf("expected error for unknown bot")
+	}
+
+	scripted := errors.New("scripted failure")
+	con.ScriptSendError(scripted)
+	if _, err := SendTextMessage(testBotID, testRecipient, "olá"); err != scripted {
+		t.Errorf("expected scripted error, got %v", err)
+	}
+
+	server.State.Transition(models.Unreachable, "test")
+	if _, err := SendTextMessage(testBotID, testRecipient, "olá"); err == nil {
+		t.Errorf("expected error when not ready")
+	}
+
+	if sent := con.Sent(); len(sent) != 0 {
+		t.Errorf("expected nothing sent, got %d", len(sent))
+	}
+}
+
+func TestSendDocumentMessageByMediaType(t *testing.T) {
+	_, con := newSendTestServer(t)
+	content := base64.StdEncoding.EncodeToString([]byte("conteúdo"))
+
+	attachments := []models.QPAttachment{
+		{MIME: "image/png", FileName: "foto.png", Base64: content, Length: 9},
+		{MIME: "audio/ogg", FileName: "audio.ogg", Base64: content, Length: 9},
+		{MIME: "application/pdf", FileName: "documento.pdf", Base64: content, Length: 9},
+	}
+
+	for _, attachment := range attachments {
+		if _, err := SendDocumentMessage(testBotID, testRecipient, attachment); err != nil {
+			t.Fatalf("unexpected error sending %s: %s", attachment.MIME, err)
+		}
+	}
+
+	sent := con.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 sent messages, got %d", len(sent))
+	}
+
+	if msg, ok := sent[0].(whatsapp.ImageMessage); !ok || msg.Caption != "foto" {
+		t.Errorf("expected image message, got %#v", sent[0])
+	}
+
+	if msg, ok := sent[1].(whatsapp.AudioMessage); !ok || !msg.Ptt {
+		t.Errorf("expected ptt audio message, got %#v", sent[1])
+	}
+
+	if msg, ok := sent[2].(whatsapp.DocumentMessage); !ok || msg.FileName != "documento.pdf" || msg.Title != "documento" {
+		t.Errorf("expected document message, got %#v", sent[2])
+	}
+}
+
+func TestSendDocumentMessageErrors(t *testing.T) {
+	_, con := newSendTestServer(t)
+
+	if _, err := SendDocumentMessage(testBotID, testRecipient, models.QPAttachment{}); err == nil {
+		t.Errorf("expected error for empty document")
+	}
+
+	invalid := models.QPAttachment{MIME: "application/pdf", Base64: "***", Length: 3}
+	if _, err := SendDocumentMessage(testBotID, testRecipient, invalid); err == nil {
+		t.Errorf("expected error for invalid base64")
+	}
+
+	if sent := con.Sent(); len(sent) != 0 {
+		t.Errorf("expected nothing sent, got %d", len(sent))
+	}
+}
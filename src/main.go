@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/joho/godotenv"
@@ -16,11 +20,21 @@ import (
 func main() {
 	// Carregando variaveis de ambiente apartir de arquivo .env
 	godotenv.Load()
+	models.ConfigureLogger()
+	logger := models.Log.WithComponent("main")
+
+	// Comandos administrativos, executam e encerram
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			logger.WithError(err).Fatalf("command error")
+		}
+		return
+	}
 
 	// Verifica se é necessario realizar alguma migração de base de dados
 	err := models.MigrateToLatest()
 	if err != nil {
-		log.Fatalf("Database migration error: %s", err.Error())
+		logger.WithError(err).Fatalf("database migration error")
 	}
 
 	// Inicializando serviço de controle do whatsapp
@@ -32,12 +46,46 @@ func main() {
 		m.Handle("/metrics", promhttp.Handler())
 		host := fmt.Sprintf("%s:%s", os.Getenv("METRICS_HOST"), os.Getenv("METRICS_PORT"))
 
-		log.Println("Starting Metrics Service")
+		logger.Infof("starting metrics service")
 		err := http.ListenAndServe(host, m)
 		if err != nil {
-			log.Fatal(err)
+			logger.WithError(err).Fatalf("error serving metrics")
 		}
 	}()
 
-	controllers.QPWebServerStart()
+	go controllers.QPWebServerStart()
+
+	// Aguardando o sinal de desligamento (docker stop, systemctl stop, ctrl+c)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	logger.Infof("received %s, shutting down", sig)
+
+	timeout := 30 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWNTIMEOUT")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	// Cada etapa tem o seu próprio prazo, um envio lento não impede a gravação das sessões
+	phase := func(name string, shutdown func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			logger.WithError(err).Errorf("%s shutdown", name)
+		}
+	}
+
+	// Não aceita mais requisições, encerra os streams de eventos e aguarda os envios em andamento
+	phase("web server", controllers.QPWebServerShutdown)
+
+	// Desliga os bots, parando o recebimento e gravando as sessões
+	if models.WhatsAppService != nil {
+		phase("whatsapp service", models.WhatsAppService.Shutdown)
+	}
+
+	// Entregando os webhooks pendentes
+	phase("outbound", models.WaitOutbound)
+
+	logger.Infof("shutdown complete")
 }
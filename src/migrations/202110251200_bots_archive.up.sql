@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN archive BOOLEAN NOT NULL DEFAULT false;
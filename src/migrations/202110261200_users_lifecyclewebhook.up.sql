@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN lifecyclewebhook VARCHAR (255) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN battery_threshold INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN unplugged_alert BOOLEAN NOT NULL DEFAULT false;
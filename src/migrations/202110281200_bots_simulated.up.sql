@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN simulated BOOLEAN NOT NULL DEFAULT false;
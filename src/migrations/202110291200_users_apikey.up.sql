@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN apikey VARCHAR (64) NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS bot_apikeys (
+  id VARCHAR (255) PRIMARY KEY UNIQUE NOT NULL,
+  bot_id VARCHAR (255) NOT NULL REFERENCES bots(id),
+  name VARCHAR (255) NOT NULL,
+  hash VARCHAR (64) UNIQUE NOT NULL,
+  scopes VARCHAR (255) NOT NULL DEFAULT '',
+  expires_at VARCHAR (64) NOT NULL DEFAULT '',
+  last_used VARCHAR (64) NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
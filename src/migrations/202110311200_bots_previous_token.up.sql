@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN previous_token VARCHAR (255) NOT NULL DEFAULT '';
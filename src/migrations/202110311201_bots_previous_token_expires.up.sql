@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN previous_token_expires VARCHAR (64) NOT NULL DEFAULT '';
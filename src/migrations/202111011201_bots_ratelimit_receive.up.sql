@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN ratelimit_receive INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE bots ADD COLUMN ratelimit_attachment INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS teams (
+  id VARCHAR (255) PRIMARY KEY UNIQUE NOT NULL,
+  name VARCHAR (255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
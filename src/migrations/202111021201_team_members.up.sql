@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS team_members (
+  team_id VARCHAR (255) NOT NULL REFERENCES teams(id),
+  user_id VARCHAR (255) NOT NULL REFERENCES users(id),
+  role VARCHAR (16) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  PRIMARY KEY (team_id, user_id)
+);
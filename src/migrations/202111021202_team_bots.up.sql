@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS team_bots (
+  team_id VARCHAR (255) NOT NULL REFERENCES teams(id),
+  bot_id VARCHAR (255) NOT NULL REFERENCES bots(id),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  PRIMARY KEY (team_id, bot_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+UPDATE users SET admin = false WHERE id = (SELECT id FROM (SELECT id FROM users ORDER BY created_at, id LIMIT 1) AS first_user);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN reset_expires VARCHAR (64) NOT NULL DEFAULT '';
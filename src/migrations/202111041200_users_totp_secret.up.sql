@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR (255) NOT NULL DEFAULT '';
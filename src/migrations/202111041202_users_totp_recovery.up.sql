@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN totp_recovery VARCHAR (1024) NOT NULL DEFAULT '';
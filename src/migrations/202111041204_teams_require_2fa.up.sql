@@ -0,0 +1 @@
+ALTER TABLE teams ADD COLUMN require_2fa BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_sessions (
+  id VARCHAR (64) PRIMARY KEY UNIQUE NOT NULL,
+  user_id VARCHAR (255) NOT NULL REFERENCES users(id),
+  address VARCHAR (64) NOT NULL DEFAULT '',
+  user_agent VARCHAR (255) NOT NULL DEFAULT '',
+  expires_at VARCHAR (64) NOT NULL,
+  last_seen VARCHAR (64) NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
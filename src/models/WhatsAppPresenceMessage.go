@@ -0,0 +1,10 @@
+package models
+
+// Atualização de presença enviada pelo whatsapp
+// Chega como json no formato ["Presence", {"id": "...@c.us", "type": "available", "t": 1600000000}]
+type WhatsAppPresenceMessage struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Timestamp int64  `json:"t"`
+	Deny      bool   `json:"deny"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// Resposta da geração de uma nova chave de acesso, exibida uma única vez
+type QPAPIKeyResponseV2 struct {
+	Header string `json:"header"`
+	Key    string `json:"key"`
+}
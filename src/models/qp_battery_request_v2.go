@@ -0,0 +1,9 @@
+package models
+
+// Requisição no formato QuePasa
+// Utilizada na API do QuePasa para configurar os alertas de bateria do bot
+type QPBatteryRequestV2 struct {
+	// Percentual, zero usa BATTERYLOWTHRESHOLD e um valor negativo desativa o aviso
+	Threshold int  `json:"threshold"`
+	Unplugged bool `json:"unplugged"`
+}
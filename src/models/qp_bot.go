@@ -1,40 +1,62 @@
 package models
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"net/http"
 	"strings"
+	"time"
 )
 
 type QPBot struct {
 	ID        string `db:"id" json:"id"`
 	Verified  bool   `db:"is_verified" json:"is_verified"`
-	Token     string `db:"token" json:"token"`
+	TokenHash string `db:"token" json:"-"` // somente o hash, o token é exibido ao ser gerado
 	UserID    string `db:"user_id" json:"user_id"`
 	WebHook   string `db:"webhook" json:"webhook"`
 	CreatedAt string `db:"created_at" json:"created_at"`
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
 	Devel     bool   `db:"devel" json:"devel"`
+	Archive   bool   `db:"archive" json:"archive"`
+
+	// Alertas de bateria, limite zero utiliza o padrão global
+	BatteryThreshold int  `db:"battery_threshold" json:"battery_threshold"`
+	UnpluggedAlert   bool `db:"unplugged_alert" json:"unplugged_alert"`
+
+	// Bot de testes, sem celular, sobre uma conexão em memória
+	Simulated bool `db:"simulated" json:"simulated"`
+
+	// Hash do token anterior à última troca, aceito até a expiração (RFC3339, UTC)
+	PreviousTokenHash    string `db:"previous_token" json:"-"`
+	PreviousTokenExpires string `db:"previous_token_expires" json:"-"`
+
+	// Limites de requisições por minuto deste bot, zero utiliza o padrão global e negativo desabilita
+	RateLimitSend       int `db:"ratelimit_send" json:"ratelimit_send"`
+	RateLimitReceive    int `db:"ratelimit_receive" json:"ratelimit_receive"`
+	RateLimitAttachment int `db:"ratelimit_attachment" json:"ratelimit_attachment"`
 }
 
 type IQPBot interface {
 	FindAll() ([]QPBot, error)
 	FindAllForUser(userID string) ([]QPBot, error)
-	FindByToken(token string) (QPBot, error)
+	FindByTokenHash(hash string) (QPBot, error)
 	FindForUser(userID string, ID string) (QPBot, error)
 	FindByID(botID string) (QPBot, error)
-	GetOrCreate(botID string, userID string) (bot QPBot, err error)
-	Create(botID string, userID string) (QPBot, error)
+	GetOrCreate(botID string, userID string, tokenHash string) (bot QPBot, err error)
+	Create(botID string, userID string, tokenHash string) (QPBot, error)
 
 	/// FORWARDING ---
 	MarkVerified(id string, ok bool) error
-	CycleToken(id string) error
+	CycleToken(id string, tokenHash string, previousExpires string) error
+	SetTokenHashes(id string, tokenHash string, previousTokenHash string) error
 	Delete(id string) error
 	WebHookUpdate(webhook string, id string) error
 	WebHookSincronize(id string) (result string, err error)
 	Devel(id string, status bool) error
+	Archive(id string, status bool) error
+	BatteryAlerts(id string, threshold int, unplugged bool) error
+	Simulate(id string, status bool) error
+	RateLimits(id string, send int, receive int, attachment int) error
 }
 
 // Traduz o Wid para um número de telefone em formato E164
@@ -46,21 +68,26 @@ func (bot *QPBot) GetNumber() string {
 	return "+" + phoneNumber
 }
 
-func (bot *QPBot) GetStatus() string {
-	server, ok := WhatsAppService.Servers[bot.ID]
+// Estado atual da conexão do bot, parado caso não exista servidor
+func (bot *QPBot) GetState() QPConnectionState {
+	server, ok := GetServer(bot.ID)
 	if !ok {
-		return "stopped"
+		return Stopped
 	}
+	return server.State.Get()
+}
 
-	if len(*server.Status) > 0 {
-		return *server.Status
-	}
+func (bot *QPBot) GetStatus() string {
+	return bot.GetState().String()
+}
 
-	return "running"
+// Pronto para enviar e receber mensagens ?
+func (bot *QPBot) IsReady() bool {
+	return bot.GetState() == Ready
 }
 
 func (bot *QPBot) GetBatteryInfo() WhatsAppBateryStatus {
-	server, ok := WhatsAppService.Servers[bot.ID]
+	server, ok := GetServer(bot.ID)
 	if !ok {
 		return WhatsAppBateryStatus{}
 	}
@@ -71,8 +98,7 @@ func (bot *QPBot) GetBatteryInfo() WhatsAppBateryStatus {
 func (bot *QPBot) PostToWebHook(message QPMessage) error {
 	if len(bot.WebHook) > 0 {
 		payloadJson, _ := json.Marshal(message.ToV2())
-		requestBody := bytes.NewBuffer(payloadJson)
-		resp, _ := http.Post(bot.WebHook, "application/json", requestBody)
+		resp, _ := postWebHook(*bot, "message", bot.WebHook, payloadJson)
 
 		if resp != nil {
 			defer resp.Body.Close()
@@ -83,9 +109,10 @@ func (bot *QPBot) PostToWebHook(message QPMessage) error {
 					// Sincroniza o token mais novo
 					bot.WebHookSincronize()
 
-					// Preenche o body novamente pois foi esvaziado na requisição anterior
-					requestBody = bytes.NewBuffer(payloadJson)
-					http.Post(bot.WebHook, "application/json", requestBody)
+					// Reenvia com o token sincronizado
+					if resp, _ := postWebHook(*bot, "message", bot.WebHook, payloadJson); resp != nil {
+						resp.Body.Close()
+					}
 				}
 			}
 		}
@@ -93,13 +120,28 @@ func (bot *QPBot) PostToWebHook(message QPMessage) error {
 	return nil
 }
 
+// Encaminha eventos (presença, etc) ao WebHook específicado
+func (bot *QPBot) PostEventToWebHook(event QPEvent) error {
+	if len(bot.WebHook) > 0 {
+		payloadJson, _ := json.Marshal(event)
+		resp, err := postWebHook(*bot, "event", bot.WebHook, payloadJson)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
 func (bot *QPBot) Toggle() (err error) {
-	server, ok := WhatsAppService.Servers[bot.ID]
+	server, ok := GetServer(bot.ID)
 	if !ok {
 		go WhatsAppService.AppendNewServer(*bot)
 	} else {
-		if *server.Status == "stopped" || *server.Status == "created" {
+		if server.State.Is(Stopped, Created) {
 			err = server.Start()
+		} else if server.State.Is(Suspended) {
+			server.Resume()
 		} else {
 			err = server.Shutdown()
 		}
@@ -107,16 +149,101 @@ func (bot *QPBot) Toggle() (err error) {
 	return
 }
 
+// Inicia o servidor do bot, criando caso ainda não exista
+func (bot *QPBot) Start() (err error) {
+	server, ok := GetServer(bot.ID)
+	if !ok {
+		go WhatsAppService.AppendNewServer(*bot)
+		return
+	}
+
+	switch {
+	case server.State.Is(Suspended):
+		server.Resume()
+	case server.State.Is(Stopped, Created, Unverified, Critical):
+		err = server.Start()
+	default:
+		err = fmt.Errorf("bot already running, state: %s", server.State.Get())
+	}
+	return
+}
+
+// Desliga o servidor do bot, sem reconexão automática
+func (bot *QPBot) Stop() error {
+	server, ok := GetServer(bot.ID)
+	if !ok || server.State.Is(Stopped) {
+		return nil
+	}
+	return server.Shutdown()
+}
+
+// Reinicia a conexão do bot em andamento, ou inicia caso esteja parado
+func (bot *QPBot) Restart() error {
+	server, ok := GetServer(bot.ID)
+	if !ok || server.State.Is(Stopped, Created, Suspended, Unverified) {
+		return bot.Start()
+	}
+
+	go server.Restart("admin_request")
+	return nil
+}
+
+// Desliga o servidor, apaga a sessão e o bot
+func (bot *QPBot) Remove() error {
+	// Desligando o servidor em andamento antes de apagar a sessão
+	if err := WhatsAppService.RemoveServer(bot.ID); err != nil {
+		bot.GetLogger().WithError(err).Warnf("error shutting down deleted bot")
+	}
+
+	if err := WhatsAppService.DB.Store.Delete(bot.ID); err != nil {
+		return err
+	}
+
+	if err := WhatsAppService.DB.APIKey.DeleteForBot(bot.ID); err != nil {
+		return err
+	}
+
+	if err := WhatsAppService.DB.Team.RemoveBot(bot.ID); err != nil {
+		return err
+	}
+
+	return bot.Delete()
+}
+
 func (bot *QPBot) IsDevelopmentGlobal() bool {
 	return ENV.IsDevelopment()
 }
 
+// Existe algum armazenamento permanente configurado para arquivar anexos ?
+func (bot *QPBot) IsMediaStoreEnabled() bool {
+	return GetMediaStore() != nil
+}
+
 func (bot *QPBot) MarkVerified(ok bool) error {
 	return WhatsAppService.DB.Bot.MarkVerified(bot.ID, ok)
 }
 
-func (bot *QPBot) CycleToken() error {
-	return WhatsAppService.DB.Bot.CycleToken(bot.ID)
+// Gera um novo token, o anterior continua aceito durante o período de carência (TOKENGRACEPERIOD)
+// Somente o hash é gravado, o token retornado deve ser exibido uma única vez
+func (bot *QPBot) CycleToken() (token string, err error) {
+	previousExpires := ""
+	if grace := GetTokenGracePeriod(); grace > 0 && len(bot.TokenHash) > 0 {
+		previousExpires = time.Now().UTC().Add(grace).Format(time.RFC3339)
+	}
+
+	token, hash := GenerateBotToken()
+	err = WhatsAppService.DB.Bot.CycleToken(bot.ID, hash, previousExpires)
+	return
+}
+
+// Possui token anterior ainda aceito ?
+func (bot *QPBot) HasPreviousToken() bool {
+	return len(bot.PreviousTokenHash) > 0 && isTokenGraceActive(bot.PreviousTokenExpires)
+}
+
+// Possui token ? Bots verificados pelo QRCode só recebem um token ao gerá-lo
+func (bot *QPBot) HasToken() bool {
+	return len(bot.TokenHash) > 0
 }
 
 func (bot *QPBot) Delete() error {
@@ -124,7 +251,16 @@ func (bot *QPBot) Delete() error {
 }
 
 func (bot *QPBot) WebHookUpdate() error {
-	return WhatsAppService.DB.Bot.WebHookUpdate(bot.WebHook, bot.ID)
+	err := WhatsAppService.DB.Bot.WebHookUpdate(bot.WebHook, bot.ID)
+	if err == nil {
+
+		// Atualiza o servidor em andamento, que guarda sua própria cópia do bot
+		if server, ok := GetServer(bot.ID); ok {
+			webhook := bot.WebHook
+			server.UpdateBot(func(running *QPBot) { running.WebHook = webhook })
+		}
+	}
+	return err
 }
 
 func (bot *QPBot) WebHookSincronize() error {
@@ -141,5 +277,66 @@ func (bot *QPBot) ToggleDevel() (err error) {
 		err = WhatsAppService.DB.Bot.Devel(bot.ID, true)
 		bot.Devel = true
 	}
+
+	// Atualiza o servidor em andamento, depuração altera o nível de log do bot
+	if server, ok := GetServer(bot.ID); ok && err == nil {
+		devel := bot.Devel
+		server.UpdateBot(func(running *QPBot) { running.Devel = devel })
+		if devel {
+			level := LogDebug
+			server.Log.SetLevel(&level)
+		} else {
+			server.Log.SetLevel(nil)
+		}
+	}
+	return err
+}
+
+// Logger do servidor em andamento, ou um novo com os campos do bot
+func (bot *QPBot) GetLogger() *QPLogger {
+	if server, ok := GetServer(bot.ID); ok {
+		return server.Log
+	}
+	return NewBotLogger(*bot)
+}
+
+// Habilita/Desabilita o arquivamento dos anexos recebidos no armazenamento permanente
+func (bot *QPBot) ToggleArchive() (err error) {
+	err = WhatsAppService.DB.Bot.Archive(bot.ID, !bot.Archive)
+	if err == nil {
+		bot.Archive = !bot.Archive
+
+		// Atualiza o servidor em andamento, que guarda sua própria cópia do bot
+		if server, ok := GetServer(bot.ID); ok {
+			archive := bot.Archive
+			server.UpdateBot(func(running *QPBot) { running.Archive = archive })
+		}
+	}
+	return err
+}
+
+// Percentual da bateria abaixo do qual avisamos
+// Zero usa o limite global e um valor negativo desativa o aviso, como nos limites de requisições
+func (bot *QPBot) GetBatteryThreshold() int {
+	if bot.BatteryThreshold != 0 {
+		return bot.BatteryThreshold
+	}
+	return GetBatteryLowThreshold()
+}
+
+func (bot *QPBot) SetBatteryAlerts(threshold int, unplugged bool) (err error) {
+	err = WhatsAppService.DB.Bot.BatteryAlerts(bot.ID, threshold, unplugged)
+	if err == nil {
+		bot.BatteryThreshold = threshold
+		bot.UnpluggedAlert = unplugged
+
+		// Atualiza o servidor em andamento, que guarda sua própria cópia do bot
+		if server, ok := GetServer(bot.ID); ok {
+			server.UpdateBot(func(running *QPBot) {
+				running.BatteryThreshold = threshold
+				running.UnpluggedAlert = unplugged
+			})
+		}
+	}
 	return err
 }
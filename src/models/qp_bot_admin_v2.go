@@ -0,0 +1,60 @@
+package models
+
+// Bot no formato da API de administração, com o estado da conexão
+// O token só é preenchido na resposta que o gera, o banco guarda apenas o seu hash
+type QPBotAdminV2 struct {
+	ID        string            `json:"id"`
+	Phone     string            `json:"phone"`
+	Token     string            `json:"token,omitempty"`
+	Verified  bool              `json:"verified"`
+	Devel     bool              `json:"devel"`
+	Archive   bool              `json:"archive"`
+	Simulated bool              `json:"simulated,omitempty"`
+	WebHook   string            `json:"webhook,omitempty"`
+	State     QPConnectionState `json:"state"`
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+
+	// Limites configurados no bot, zero utiliza o padrão global
+	RateLimits QPRateLimitsV2 `json:"rate_limits"`
+
+	// Expiração do token anterior à última troca, somente durante o período de carência
+	PreviousTokenExpires string `json:"previous_token_expires,omitempty"`
+
+	// Papel do usuário sobre o bot, somente nas listagens
+	Role QPRole `json:"role,omitempty"`
+}
+
+func (source QPBot) ToAdminV2() QPBotAdminV2 {
+	admin := QPBotAdminV2{
+		ID:        source.ID,
+		Phone:     source.GetNumber(),
+		Verified:  source.Verified,
+		Devel:     source.Devel,
+		Archive:   source.Archive,
+		Simulated: source.Simulated,
+		WebHook:   source.WebHook,
+		State:     source.GetState(),
+		CreatedAt: source.CreatedAt,
+		UpdatedAt: source.UpdatedAt,
+		RateLimits: QPRateLimitsV2{
+			Send:       source.RateLimitSend,
+			Receive:    source.RateLimitReceive,
+			Attachment: source.RateLimitAttachment,
+		},
+	}
+
+	if source.HasPreviousToken() {
+		admin.PreviousTokenExpires = source.PreviousTokenExpires
+	}
+	return admin
+}
+
+func (source QPBotAccess) ToAdminV2() QPBotAdminV2 {
+	admin := source.QPBot.ToAdminV2()
+	admin.Role = source.Role
+	if !source.Role.CanManage() {
+		admin.PreviousTokenExpires = ""
+	}
+	return admin
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Header alternativo ao token no caminho da url, evita que o token apareça em logs de proxies
+const TokenHeader = "X-QUEPASA-TOKEN"
+
+// Escopos das chaves de acesso dos bots
+const (
+	ScopeSend         = "send"
+	ScopeReceive      = "receive"
+	ScopeMedia        = "media"
+	ScopeWebHookAdmin = "webhook-admin"
+)
+
+var BotAPIKeyScopes = []string{ScopeSend, ScopeReceive, ScopeMedia, ScopeWebHookAdmin}
+
+// Prefixo das chaves dos bots, diferencia das chaves de usuário e dos tokens
+const botAPIKeyPrefix = "qpb_"
+
+// Intervalo mínimo entre as atualizações do último uso, evita uma escrita por requisição
+const botAPIKeyUsedInterval = time.Minute
+
+var (
+	ErrAPIKeyExpired = errors.New("api key expired")
+	ErrAPIKeyScope   = errors.New("api key without the required scope")
+)
+
+// Chave de acesso nomeada de um bot, somente o hash é gravado
+// As datas são gravadas como texto RFC3339, vazio quando não definidas
+type QPBotAPIKey struct {
+	ID        string `db:"id" json:"id"`
+	BotID     string `db:"bot_id" json:"bot_id"`
+	Name      string `db:"name" json:"name"`
+	Hash      string `db:"hash" json:"hash"`
+	Scopes    string `db:"scopes" json:"scopes"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"`
+	LastUsed  string `db:"last_used" json:"last_used"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+type IQPBotAPIKey interface {
+	FindAllForBot(botID string) ([]QPBotAPIKey, error)
+	FindByHash(hash string) (QPBotAPIKey, error)
+	Create(key QPBotAPIKey) error
+	Delete(botID string, ID string) error
+	DeleteForBot(botID string) error
+	MarkUsed(ID string, when string) error
+}
+
+func (key QPBotAPIKey) GetScopes() []string {
+	if len(key.Scopes) == 0 {
+		return []string{}
+	}
+	return strings.Split(key.Scopes, ",")
+}
+
+func (key QPBotAPIKey) HasScope(scope string) bool {
+	for _, item := range key.GetScopes() {
+		if item == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (key QPBotAPIKey) IsExpired() bool {
+	if len(key.ExpiresAt) == 0 {
+		return false
+	}
+
+	expires, err := time.Parse(time.RFC3339, key.ExpiresAt)
+	return err != nil || time.Now().After(expires)
+}
+
+func isBotAPIKeyScope(scope string) bool {
+	for _, item := range BotAPIKeyScopes {
+		if item == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Cria uma nova chave de acesso para o bot, a chave é retornada uma única vez
+func CreateBotAPIKey(botID string, request QPBotAPIKeyRequestV2) (key string, apikey QPBotAPIKey, err error) {
+	if len(strings.TrimSpace(request.Name)) == 0 {
+		return key, apikey, fmt.Errorf("name is required")
+	}
+
+	if len(request.Scopes) == 0 {
+		return key, apikey, fmt.Errorf("at least one scope is required, valid scopes: %s", strings.Join(BotAPIKeyScopes, ", "))
+	}
+
+	for _, scope := range request.Scopes {
+		if !isBotAPIKeyScope(scope) {
+			return key, apikey, fmt.Errorf("invalid scope %s, valid scopes: %s", scope, strings.Join(BotAPIKeyScopes, ", "))
+		}
+	}
+
+	if len(request.ExpiresAt) > 0 {
+		expires, err := time.Parse(time.RFC3339, request.ExpiresAt)
+		if err != nil {
+			return key, apikey, fmt.Errorf("invalid expires_at, use RFC3339: %s", err)
+		}
+
+		if !expires.After(time.Now()) {
+			return key, apikey, fmt.Errorf("expires_at must be in the future")
+		}
+		request.ExpiresAt = expires.UTC().Format(time.RFC3339)
+	}
+
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	key = botAPIKeyPrefix + hex.EncodeToString(b)
+	apikey = QPBotAPIKey{
+		ID:        uuid.New().String(),
+		BotID:     botID,
+		Name:      strings.TrimSpace(request.Name),
+		Hash:      HashAPIKey(key),
+		Scopes:    strings.Join(request.Scopes, ","),
+		ExpiresAt: request.ExpiresAt,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	err = WhatsAppService.DB.APIKey.Create(apikey)
+	return
+}
+
+// Bot autenticado pela credencial informada, o token do bot ou uma de suas chaves de acesso
+// O token do bot tem acesso completo, as chaves somente aos escopos atribuídos
+func AuthenticateBot(credential string, scope string) (bot QPBot, err error) {
+	if len(credential) == 0 {
+		return bot, fmt.Errorf("token not informed")
+	}
+
+	if !strings.HasPrefix(credential, botAPIKeyPrefix) {
+		return FindBotByToken(credential)
+	}
+
+	apikey, err := WhatsAppService.DB.APIKey.FindByHash(HashAPIKey(credential))
+	if err != nil {
+		return bot, fmt.Errorf("api key not found")
+	}
+
+	if apikey.IsExpired() {
+		return bot, ErrAPIKeyExpired
+	}
+
+	if len(scope) > 0 && !apikey.HasScope(scope) {
+		return bot, ErrAPIKeyScope
+	}
+
+	apikey.markUsed()
+	return WhatsAppService.DB.Bot.FindByID(apikey.BotID)
+}
+
+func (key QPBotAPIKey) markUsed() {
+	now := time.Now().UTC()
+	if last, err := time.Parse(time.RFC3339, key.LastUsed); err == nil && now.Sub(last) < botAPIKeyUsedInterval {
+		return
+	}
+
+	if err := WhatsAppService.DB.APIKey.MarkUsed(key.ID, now.Format(time.RFC3339)); err != nil {
+		Log.WithComponent("apikey").WithField("bot", key.BotID).WithError(err).Warnf("error updating api key last use")
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type QPBotAPIKeyMysql struct {
+	db *sqlx.DB
+}
+
+func (source QPBotAPIKeyMysql) FindAllForBot(botID string) ([]QPBotAPIKey, error) {
+	keys := []QPBotAPIKey{}
+	err := source.db.Select(&keys, "SELECT * FROM bot_apikeys WHERE bot_id = ? ORDER BY created_at", botID)
+	return keys, err
+}
+
+func (source QPBotAPIKeyMysql) FindByHash(hash string) (QPBotAPIKey, error) {
+	var key QPBotAPIKey
+	err := source.db.Get(&key, "SELECT * FROM bot_apikeys WHERE hash = ?", hash)
+	return key, err
+}
+
+func (source QPBotAPIKeyMysql) Create(key QPBotAPIKey) error {
+	query := `INSERT INTO bot_apikeys
+    (id, bot_id, name, hash, scopes, expires_at, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := source.db.Exec(query, key.ID, key.BotID, key.Name, key.Hash, key.Scopes, key.ExpiresAt, key.CreatedAt)
+	return err
+}
+
+func (source QPBotAPIKeyMysql) Delete(botID string, ID string) error {
+	query := "DELETE FROM bot_apikeys WHERE bot_id = ? AND id = ?"
+	_, err := source.db.Exec(query, botID, ID)
+	return err
+}
+
+func (source QPBotAPIKeyMysql) DeleteForBot(botID string) error {
+	query := "DELETE FROM bot_apikeys WHERE bot_id = ?"
+	_, err := source.db.Exec(query, botID)
+	return err
+}
+
+func (source QPBotAPIKeyMysql) MarkUsed(ID string, when string) error {
+	query := "UPDATE bot_apikeys SET last_used = ? WHERE id = ?"
+	_, err := source.db.Exec(query, when, ID)
+	return err
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type QPBotAPIKeyPostgres struct {
+	db *sqlx.DB
+}
+
+func (source QPBotAPIKeyPostgres) FindAllForBot(botID string) ([]QPBotAPIKey, error) {
+	keys := []QPBotAPIKey{}
+	err := source.db.Select(&keys, "SELECT * FROM bot_apikeys WHERE bot_id = $1 ORDER BY created_at", botID)
+	return keys, err
+}
+
+func (source QPBotAPIKeyPostgres) FindByHash(hash string) (QPBotAPIKey, error) {
+	var key QPBotAPIKey
+	err := source.db.Get(&key, "SELECT * FROM bot_apikeys WHERE hash = $1", hash)
+	return key, err
+}
+
+func (source QPBotAPIKeyPostgres) Create(key QPBotAPIKey) error {
+	query := `INSERT INTO bot_apikeys
+    (id, bot_id, name, hash, scopes, expires_at, created_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := source.db.Exec(query, key.ID, key.BotID, key.Name, key.Hash, key.Scopes, key.ExpiresAt, key.CreatedAt)
+	return err
+}
+
+func (source QPBotAPIKeyPostgres) Delete(botID string, ID string) error {
+	query := "DELETE FROM bot_apikeys WHERE bot_id = $1 AND id = $2"
+	_, err := source.db.Exec(query, botID, ID)
+	return err
+}
+
+func (source QPBotAPIKeyPostgres) DeleteForBot(botID string) error {
+	query := "DELETE FROM bot_apikeys WHERE bot_id = $1"
+	_, err := source.db.Exec(query, botID)
+	return err
+}
+
+func (source QPBotAPIKeyPostgres) MarkUsed(ID string, when string) error {
+	query := "UPDATE bot_apikeys SET last_used = $1 WHERE id = $2"
+	_, err := source.db.Exec(query, when, ID)
+	return err
+}
@@ -0,0 +1,10 @@
+package models
+
+// Requisição de criação de uma chave de acesso do bot
+type QPBotAPIKeyRequestV2 struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+
+	// RFC3339, vazio para uma chave sem expiração
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// Chave de acesso do bot no formato da API, sem o hash
+// A chave em si somente é retornada na criação
+type QPBotAPIKeyV2 struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+	LastUsed  string   `json:"last_used,omitempty"`
+	CreatedAt string   `json:"created_at"`
+	Expired   bool     `json:"expired,omitempty"`
+	Key       string   `json:"key,omitempty"`
+}
+
+func (source QPBotAPIKey) ToV2() QPBotAPIKeyV2 {
+	return QPBotAPIKeyV2{
+		ID:        source.ID,
+		Name:      source.Name,
+		Scopes:    source.GetScopes(),
+		ExpiresAt: source.ExpiresAt,
+		LastUsed:  source.LastUsed,
+		CreatedAt: source.CreatedAt,
+		Expired:   source.IsExpired(),
+	}
+}
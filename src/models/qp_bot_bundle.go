@@ -0,0 +1,238 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Prefixo que identifica um pacote de exportação de bot
+var bundleMagic = []byte("QPBB1")
+
+// Pacote com tudo que é necessário para mover um bot entre instâncias do QuePasa
+// sem precisar ler o QRCode novamente
+type QPBotBundle struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Bot       QPBot     `json:"bot"`
+
+	// Hash do token do bot, as integrações continuam usando o mesmo token após a importação
+	TokenHash string `json:"token_hash,omitempty"`
+
+	// Chaves de acesso do bot, somente os hashes, continuam valendo após a importação
+	APIKeys []QPBotAPIKey `json:"api_keys,omitempty"`
+
+	// whatsapp.Session em gob, sem a criptografia do banco de dados
+	// Vazia para bots simulados, que não têm sessão
+	Session []byte `json:"session"`
+}
+
+// O pacote contém as chaves da sessão, a frase secreta tem a mesma exigência das senhas
+func CheckBundlePassphrase(passphrase string) error {
+	if err := CheckPasswordStrength(passphrase); err != nil {
+		return fmt.Errorf("invalid passphrase: %s", err)
+	}
+	return nil
+}
+
+// Exporta o bot, suas configurações, suas chaves de acesso e sua sessão
+// O resultado é criptografado com uma chave derivada da frase secreta (scrypt + AES-GCM)
+func ExportBotBundle(botID string, passphrase string) ([]byte, error) {
+	if err := CheckBundlePassphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	bot, err := WhatsAppService.DB.Bot.FindByID(botID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	if !bot.Simulated {
+		session, err := ReadSession(bot.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = gob.NewEncoder(&buff).Encode(session); err != nil {
+			return nil, err
+		}
+	}
+
+	apikeys, err := WhatsAppService.DB.APIKey.FindAllForBot(bot.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := QPBotBundle{
+		Version:   1,
+		CreatedAt: time.Now().UTC(),
+		Bot:       bot,
+		TokenHash: bot.TokenHash,
+		APIKeys:   apikeys,
+		Session:   buff.Bytes(),
+	}
+
+	plain, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	key, err := bundleKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealGCM(key, plain, bundleMagic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Formato: magic | salt | nonce + dados criptografados
+	result := append([]byte{}, bundleMagic...)
+	result = append(result, salt...)
+	return append(result, sealed...), nil
+}
+
+// Abre um pacote de exportação
+func OpenBotBundle(data []byte, passphrase string) (bundle QPBotBundle, err error) {
+	if !bytes.HasPrefix(data, bundleMagic) || len(data) < len(bundleMagic)+16 {
+		err = fmt.Errorf("invalid bundle")
+		return
+	}
+
+	salt := data[len(bundleMagic) : len(bundleMagic)+16]
+	key, err := bundleKey(passphrase, salt)
+	if err != nil {
+		return
+	}
+
+	plain, err := openGCM(key, data[len(bundleMagic)+16:], bundleMagic)
+	if err != nil {
+		err = fmt.Errorf("invalid passphrase or corrupted bundle")
+		return
+	}
+
+	err = json.Unmarshal(plain, &bundle)
+	if err == nil && bundle.Version != 1 {
+		err = fmt.Errorf("bundle version not supported: %d", bundle.Version)
+	}
+	return
+}
+
+// Importa um pacote, criando (ou atualizando) o bot para o usuário informado e gravando sua sessão
+// O token, as chaves de acesso e as configurações exportadas são restaurados
+// O servidor não é iniciado, veja StartImportedBot
+func ImportBotBundle(data []byte, passphrase string, userID string) (bot QPBot, err error) {
+	bundle, err := OpenBotBundle(data, passphrase)
+	if err != nil {
+		return
+	}
+
+	var session whatsapp.Session
+	if !bundle.Bot.Simulated {
+		if err = gob.NewDecoder(bytes.NewReader(bundle.Session)).Decode(&session); err != nil {
+			return
+		}
+	}
+
+	bot, err = WhatsAppService.DB.Bot.GetOrCreate(bundle.Bot.ID, userID, bundle.TokenHash)
+	if err != nil {
+		return
+	}
+
+	if bot.UserID != userID {
+		err = fmt.Errorf("bot %s already belongs to another user", bot.GetNumber())
+		return
+	}
+
+	if len(bundle.TokenHash) > 0 && bot.TokenHash != bundle.TokenHash {
+		if err = WhatsAppService.DB.Bot.SetTokenHashes(bot.ID, bundle.TokenHash, ""); err != nil {
+			return
+		}
+		bot.TokenHash, bot.PreviousTokenHash = bundle.TokenHash, ""
+	}
+
+	if !bundle.Bot.Simulated {
+		if err = WriteSession(bot.ID, session); err != nil {
+			return
+		}
+	}
+
+	if bot.Simulated != bundle.Bot.Simulated {
+		if err = WhatsAppService.DB.Bot.Simulate(bot.ID, bundle.Bot.Simulated); err != nil {
+			return
+		}
+		bot.Simulated = bundle.Bot.Simulated
+	}
+
+	// As chaves locais são substituídas pelas exportadas
+	if err = WhatsAppService.DB.APIKey.DeleteForBot(bot.ID); err != nil {
+		return
+	}
+
+	for _, apikey := range bundle.APIKeys {
+		apikey.BotID = bot.ID
+		if err = WhatsAppService.DB.APIKey.Create(apikey); err != nil {
+			return
+		}
+	}
+
+	bot.WebHook = bundle.Bot.WebHook
+	if err = bot.WebHookUpdate(); err != nil {
+		return
+	}
+
+	if bot.Devel != bundle.Bot.Devel {
+		if err = bot.ToggleDevel(); err != nil {
+			return
+		}
+	}
+
+	if bot.Archive != bundle.Bot.Archive {
+		if err = bot.ToggleArchive(); err != nil {
+			return
+		}
+	}
+
+	if err = bot.SetBatteryAlerts(bundle.Bot.BatteryThreshold, bundle.Bot.UnpluggedAlert); err != nil {
+		return
+	}
+
+	if err = bot.SetRateLimits(bundle.Bot.RateLimitSend, bundle.Bot.RateLimitReceive, bundle.Bot.RateLimitAttachment); err != nil {
+		return
+	}
+
+	if err = bot.MarkVerified(true); err != nil {
+		return
+	}
+	bot.Verified = true
+	return
+}
+
+// Inicia o servidor de um bot recém importado
+// Caso já exista um servidor para o bot, ele é reiniciado com a nova sessão
+func StartImportedBot(bot QPBot) {
+	if server, ok := GetServer(bot.ID); ok {
+		server.UpdateBot(func(running *QPBot) { *running = bot })
+		go server.Restart("session_imported")
+		return
+	}
+	go WhatsAppService.AppendNewServer(bot)
+}
+
+func bundleKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
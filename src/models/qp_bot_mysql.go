@@ -4,7 +4,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -26,9 +25,11 @@ func (source QPBotMysql) FindAllForUser(userID string) ([]QPBot, error) {
 	return bots, err
 }
 
-func (source QPBotMysql) FindByToken(token string) (QPBot, error) {
+// Somente o hash dos tokens é gravado, nunca o token
+func (source QPBotMysql) FindByTokenHash(hash string) (QPBot, error) {
 	var bot QPBot
-	err := source.db.Get(&bot, "SELECT * FROM bots WHERE token = ?", token)
+	query := "SELECT * FROM bots WHERE token = ? OR (previous_token = ? AND previous_token_expires > ?)"
+	err := source.db.Get(&bot, query, hash, hash, tokenGraceNow())
 	return bot, err
 }
 
@@ -44,25 +45,25 @@ func (source QPBotMysql) FindByID(botID string) (QPBot, error) {
 	return bot, err
 }
 
-func (source QPBotMysql) GetOrCreate(botID string, userID string) (bot QPBot, err error) {
+func (source QPBotMysql) GetOrCreate(botID string, userID string, tokenHash string) (bot QPBot, err error) {
 	bot, err = source.FindByID(botID)
 	if err != nil {
 		if strings.Contains(err.Error(), "no rows in result set") {
-			bot, err = source.Create(botID, userID)
+			bot, err = source.Create(botID, userID, tokenHash)
 		}
 	}
 	return
 }
 
 // botID = Wid of whatsapp connection
-func (source QPBotMysql) Create(botID string, userID string) (QPBot, error) {
+// tokenHash vazio cria o bot sem token, gerado depois pelo dono
+func (source QPBotMysql) Create(botID string, userID string, tokenHash string) (QPBot, error) {
 	var bot QPBot
-	token := uuid.New().String()
 	now := time.Now()
 	query := `INSERT INTO bots
     (id, is_verified, token, user_id, created_at, updated_at, webhook, devel)
     VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	if _, err := source.db.Exec(query, botID, false, token, userID, now, now, "", false); err != nil {
+	if _, err := source.db.Exec(query, botID, false, tokenHash, userID, now, now, "", false); err != nil {
 		return bot, err
 	}
 
@@ -76,11 +77,22 @@ func (source QPBotMysql) MarkVerified(id string, ok bool) error {
 	return err
 }
 
-func (source QPBotMysql) CycleToken(id string) error {
-	token := uuid.New().String()
+// Sem expiração informada o token anterior é descartado
+func (source QPBotMysql) CycleToken(id string, tokenHash string, previousExpires string) error {
 	now := time.Now()
-	query := "UPDATE bots SET token = ?, updated_at = ? WHERE id = ?"
-	_, err := source.db.Exec(query, token, now, id)
+	query := "UPDATE bots SET previous_token = token, previous_token_expires = ?, token = ?, updated_at = ? WHERE id = ?"
+	if len(previousExpires) == 0 {
+		query = "UPDATE bots SET previous_token = '', previous_token_expires = ?, token = ?, updated_at = ? WHERE id = ?"
+	}
+	_, err := source.db.Exec(query, previousExpires, tokenHash, now, id)
+	return err
+}
+
+// Grava os hashes informados, na conversão dos tokens legados e na importação
+func (source QPBotMysql) SetTokenHashes(id string, tokenHash string, previousTokenHash string) error {
+	now := time.Now()
+	query := "UPDATE bots SET token = ?, previous_token = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, tokenHash, previousTokenHash, now, id)
 	return err
 }
 
@@ -108,3 +120,31 @@ func (source QPBotMysql) Devel(id string, status bool) (err error) {
 	_, err = source.db.Exec(query, status, now, id)
 	return err
 }
+
+func (source QPBotMysql) Archive(id string, status bool) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET archive = ?, updated_at = ? WHERE id = ?"
+	_, err = source.db.Exec(query, status, now, id)
+	return err
+}
+
+func (source QPBotMysql) BatteryAlerts(id string, threshold int, unplugged bool) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET battery_threshold = ?, unplugged_alert = ?, updated_at = ? WHERE id = ?"
+	_, err = source.db.Exec(query, threshold, unplugged, now, id)
+	return err
+}
+
+func (source QPBotMysql) Simulate(id string, status bool) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET simulated = ?, updated_at = ? WHERE id = ?"
+	_, err = source.db.Exec(query, status, now, id)
+	return err
+}
+
+func (source QPBotMysql) RateLimits(id string, send int, receive int, attachment int) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET ratelimit_send = ?, ratelimit_receive = ?, ratelimit_attachment = ?, updated_at = ? WHERE id = ?"
+	_, err = source.db.Exec(query, send, receive, attachment, now, id)
+	return err
+}
@@ -4,7 +4,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
@@ -25,9 +24,11 @@ func (source QPBotPostgres) FindAllForUser(userID string) ([]QPBot, error) {
 	return bots, err
 }
 
-func (source QPBotPostgres) FindByToken(token string) (QPBot, error) {
+// Somente o hash dos tokens é gravado, nunca o token
+func (source QPBotPostgres) FindByTokenHash(hash string) (QPBot, error) {
 	var bot QPBot
-	err := source.db.Get(&bot, "SELECT * FROM bots WHERE token = $1", token)
+	query := "SELECT * FROM bots WHERE token = $1 OR (previous_token = $2 AND previous_token_expires > $3)"
+	err := source.db.Get(&bot, query, hash, hash, tokenGraceNow())
 	return bot, err
 }
 
@@ -43,25 +44,25 @@ func (source QPBotPostgres) FindByID(botID string) (QPBot, error) {
 	return bot, err
 }
 
-func (source QPBotPostgres) GetOrCreate(botID string, userID string) (bot QPBot, err error) {
+func (source QPBotPostgres) GetOrCreate(botID string, userID string, tokenHash string) (bot QPBot, err error) {
 	bot, err = source.FindByID(botID)
 	if err != nil {
 		if strings.Contains(err.Error(), "no rows in result set") {
-			bot, err = source.Create(botID, userID)
+			bot, err = source.Create(botID, userID, tokenHash)
 		}
 	}
 	return
 }
 
 // botID = Wid of whatsapp connection
-func (source QPBotPostgres) Create(botID string, userID string) (QPBot, error) {
+// tokenHash vazio cria o bot sem token, gerado depois pelo dono
+func (source QPBotPostgres) Create(botID string, userID string, tokenHash string) (QPBot, error) {
 	var bot QPBot
-	token := uuid.New().String()
 	now := time.Now()
 	query := `INSERT INTO bots
     (id, is_verified, token, user_id, created_at, updated_at, webhook, devel)
     VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	if _, err := source.db.Exec(query, botID, false, token, userID, now, now, "", false); err != nil {
+	if _, err := source.db.Exec(query, botID, false, tokenHash, userID, now, now, "", false); err != nil {
 		return bot, err
 	}
 
@@ -75,11 +76,22 @@ func (source QPBotPostgres) MarkVerified(id string, ok bool) error {
 	return err
 }
 
-func (source QPBotPostgres) CycleToken(id string) error {
-	token := uuid.New().String()
+// Sem expiração informada o token anterior é descartado
+func (source QPBotPostgres) CycleToken(id string, tokenHash string, previousExpires string) error {
 	now := time.Now()
-	query := "UPDATE bots SET token = $1, updated_at = $2 WHERE id = $3"
-	_, err := source.db.Exec(query, token, now, id)
+	query := "UPDATE bots SET previous_token = token, previous_token_expires = $1, token = $2, updated_at = $3 WHERE id = $4"
+	if len(previousExpires) == 0 {
+		query = "UPDATE bots SET previous_token = '', previous_token_expires = $1, token = $2, updated_at = $3 WHERE id = $4"
+	}
+	_, err := source.db.Exec(query, previousExpires, tokenHash, now, id)
+	return err
+}
+
+// Grava os hashes informados, na conversão dos tokens legados e na importação
+func (source QPBotPostgres) SetTokenHashes(id string, tokenHash string, previousTokenHash string) error {
+	now := time.Now()
+	query := "UPDATE bots SET token = $1, previous_token = $2, updated_at = $3 WHERE id = $4"
+	_, err := source.db.Exec(query, tokenHash, previousTokenHash, now, id)
 	return err
 }
 
@@ -107,3 +119,31 @@ func (source QPBotPostgres) Devel(id string, status bool) (err error) {
 	_, err = source.db.Exec(query, status, now, id)
 	return err
 }
+
+func (source QPBotPostgres) Archive(id string, status bool) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET archive = $1, updated_at = $2 WHERE id = $3"
+	_, err = source.db.Exec(query, status, now, id)
+	return err
+}
+
+func (source QPBotPostgres) BatteryAlerts(id string, threshold int, unplugged bool) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET battery_threshold = $1, unplugged_alert = $2, updated_at = $3 WHERE id = $4"
+	_, err = source.db.Exec(query, threshold, unplugged, now, id)
+	return err
+}
+
+func (source QPBotPostgres) Simulate(id string, status bool) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET simulated = $1, updated_at = $2 WHERE id = $3"
+	_, err = source.db.Exec(query, status, now, id)
+	return err
+}
+
+func (source QPBotPostgres) RateLimits(id string, send int, receive int, attachment int) (err error) {
+	now := time.Now()
+	query := "UPDATE bots SET ratelimit_send = $1, ratelimit_receive = $2, ratelimit_attachment = $3, updated_at = $4 WHERE id = $5"
+	_, err = source.db.Exec(query, send, receive, attachment, now, id)
+	return err
+}
@@ -0,0 +1,73 @@
+package models
+
+// Situação atual do bot, do celular e da conexão
+type QPBotStatus struct {
+	ID               string                        `json:"id"`
+	Phone            string                        `json:"phone"`
+	Verified         bool                          `json:"verified"`
+	State            QPConnectionState             `json:"state"`
+	Battery          WhatsAppBateryStatus          `json:"battery"`
+	BatteryThreshold int                           `json:"battery_threshold"`
+	UnpluggedAlert   bool                          `json:"unplugged_alert"`
+	Device           *QPDeviceInfo                 `json:"device,omitempty"`
+	History          []QPConnectionStateTransition `json:"history,omitempty"`
+	Simulated        bool                          `json:"simulated,omitempty"`
+}
+
+// Informações do aparelho, recebidas do whatsapp ao conectar
+type QPDeviceInfo struct {
+	Platform      string `json:"platform,omitempty"`
+	Pushname      string `json:"pushname,omitempty"`
+	Manufacturer  string `json:"manufacturer,omitempty"`
+	Model         string `json:"model,omitempty"`
+	OsVersion     string `json:"osversion,omitempty"`
+	OsBuildNumber string `json:"osbuildnumber,omitempty"`
+	WaVersion     string `json:"waversion,omitempty"`
+	Mcc           string `json:"mcc,omitempty"`
+	Mnc           string `json:"mnc,omitempty"`
+}
+
+func (bot *QPBot) GetBotStatus() (status QPBotStatus) {
+	status.ID = bot.ID
+	status.Phone = bot.GetNumber()
+	status.Verified = bot.Verified
+	status.State = bot.GetState()
+	status.Battery = bot.GetBatteryInfo()
+	status.BatteryThreshold = bot.GetBatteryThreshold()
+	status.UnpluggedAlert = bot.UnpluggedAlert
+	status.Simulated = bot.Simulated
+
+	if server, ok := GetServer(bot.ID); ok {
+		status.Device = server.GetDeviceInfo()
+		status.History = server.State.History()
+	}
+	return
+}
+
+// Nulo enquanto não houver conexão estabelecida
+func (server *QPWhatsAppServer) GetDeviceInfo() *QPDeviceInfo {
+	if server.Connection == nil {
+		return nil
+	}
+
+	info := server.Connection.Info()
+	if info == nil {
+		return nil
+	}
+
+	device := &QPDeviceInfo{
+		Platform: info.Platform,
+		Pushname: info.Pushname,
+	}
+
+	if info.Phone != nil {
+		device.Manufacturer = info.Phone.DeviceManufacturer
+		device.Model = info.Phone.DeviceModel
+		device.OsVersion = info.Phone.OsVersion
+		device.OsBuildNumber = info.Phone.OsBuildNumber
+		device.WaVersion = info.Phone.WaVersion
+		device.Mcc = info.Phone.Mcc
+		device.Mnc = info.Phone.Mnc
+	}
+	return device
+}
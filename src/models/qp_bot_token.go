@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Período padrão em que o token anterior continua aceito após a troca
+const defaultTokenGracePeriod = 24 * time.Hour
+
+var botPreviousTokenUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_bot_previous_token_used_total",
+	Help: "Requests authenticated with the previous token of a bot, still in its grace period",
+}, []string{"bot"})
+
+// Período de carência do token anterior (TOKENGRACEPERIOD, ex: 24h), zero desabilita
+func GetTokenGracePeriod() time.Duration {
+	if s, err := getenvStr("TOKENGRACEPERIOD"); err == nil {
+		if grace, err := time.ParseDuration(s); err == nil && grace >= 0 {
+			return grace
+		}
+		Log.WithComponent("token").Warnf("invalid TOKENGRACEPERIOD %s, using %s", s, defaultTokenGracePeriod)
+	}
+	return defaultTokenGracePeriod
+}
+
+// Marca de tempo atual no mesmo formato gravado em previous_token_expires
+// A comparação entre os textos em RFC3339 UTC equivale à comparação entre as datas
+func tokenGraceNow() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func isTokenGraceActive(expires string) bool {
+	return len(expires) > 0 && expires > tokenGraceNow()
+}
+
+// Gera um novo token de bot e o hash que é gravado no banco
+func GenerateBotToken() (token string, hash string) {
+	token = uuid.New().String()
+	return token, HashAPIKey(token)
+}
+
+// Bot pelo token atual ou pelo anterior, ainda no período de carência
+// O uso do token anterior é registrado para acompanhar as integrações pendentes de atualização
+func FindBotByToken(token string) (bot QPBot, err error) {
+	if len(token) == 0 {
+		return bot, sql.ErrNoRows
+	}
+
+	hash := HashAPIKey(token)
+	bot, err = WhatsAppService.DB.Bot.FindByTokenHash(hash)
+	if err != nil {
+		return
+	}
+
+	if bot.TokenHash != hash {
+		botPreviousTokenUsed.WithLabelValues(metricsBotLabel(bot)).Inc()
+		bot.GetLogger().WithComponent("token").Warnf("previous token used, valid until %s", bot.PreviousTokenExpires)
+	}
+	return
+}
+
+// Hashes gravados têm sempre 64 caracteres hexadecimais, tokens legados são uuids
+func isBotTokenHash(value string) bool {
+	if len(value) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// Substitui os tokens gravados em texto pelas versões anteriores pelo seu hash
+// As integrações continuam usando os mesmos tokens
+func HashLegacyBotTokens() error {
+	bots, err := WhatsAppService.DB.Bot.FindAll()
+	if err != nil {
+		return err
+	}
+
+	for _, bot := range bots {
+		tokenHash, previousHash := bot.TokenHash, bot.PreviousTokenHash
+		if len(tokenHash) > 0 && !isBotTokenHash(tokenHash) {
+			tokenHash = HashAPIKey(tokenHash)
+		}
+		if len(previousHash) > 0 && !isBotTokenHash(previousHash) {
+			previousHash = HashAPIKey(previousHash)
+		}
+
+		if tokenHash == bot.TokenHash && previousHash == bot.PreviousTokenHash {
+			continue
+		}
+
+		if err = WhatsAppService.DB.Bot.SetTokenHashes(bot.ID, tokenHash, previousHash); err != nil {
+			return err
+		}
+		bot.GetLogger().WithComponent("token").Infof("legacy token replaced by its hash")
+	}
+	return nil
+}
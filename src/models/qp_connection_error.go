@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+)
+
+// Classificação dos erros de conexão, define a reação do servidor
+type QPConnectionErrorKind string
+
+const (
+	ErrorUnknown            QPConnectionErrorKind = "unknown"
+	ErrorWebsocketCorrupted QPConnectionErrorKind = "websocket_corrupted" // close 1006, provavelmente baixa qualidade de internet no celular
+	ErrorConnectionReset    QPConnectionErrorKind = "connection_reset"    // possível falha no keep alive, muito tempo sem tráfego
+	ErrorForcedDisconnect   QPConnectionErrorKind = "forced_disconnect"   // code: 1000, desconexão iniciada pelo whatsapp
+	ErrorServerClosed       QPConnectionErrorKind = "server_closed"       // o whatsapp encerrou a conexão
+	ErrorInvalidWebsocket   QPConnectionErrorKind = "invalid_websocket"   // websocket inválido ou sem resposta
+	ErrorKeepAliveFailed    QPConnectionErrorKind = "keepalive_failed"    // celular sem responder, aguardamos
+	ErrorNotImplemented     QPConnectionErrorKind = "not_implemented"     // tipo de mensagem sem handler ainda
+	ErrorUnauthorized       QPConnectionErrorKind = "unauthorized"        // 401, sessão não é mais aceita
+	ErrorTimeout            QPConnectionErrorKind = "timeout"             // tempo esgotado ao restaurar a sessão
+	ErrorServiceUnreachable QPConnectionErrorKind = "service_unreachable" // bad handshake, servidores do whatsapp fora
+	ErrorNotConnected       QPConnectionErrorKind = "not_connected"       // operação em conexão já encerrada
+)
+
+// O servidor deve ser reiniciado após este erro ?
+func (kind QPConnectionErrorKind) ShouldRestart() bool {
+	switch kind {
+	case ErrorWebsocketCorrupted, ErrorConnectionReset, ErrorForcedDisconnect, ErrorServerClosed, ErrorInvalidWebsocket:
+		return true
+	default:
+		return false
+	}
+}
+
+// Erro de conexão já classificado
+type QPConnectionError struct {
+	Kind QPConnectionErrorKind
+	Err  error
+}
+
+func (e *QPConnectionError) Error() string {
+	return string(e.Kind) + ": " + e.Err.Error()
+}
+
+func (e *QPConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// Classifica o erro pelos tipos conhecidos da biblioteca do whatsapp
+// Somente quando a biblioteca não fornece um tipo, o texto do erro é analisado
+func ClassifyConnectionError(err error) QPConnectionErrorKind {
+	if err == nil {
+		return ErrorUnknown
+	}
+
+	var classified *QPConnectionError
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+
+	var unreachable *ServiceUnreachableError
+	if errors.As(err, &unreachable) {
+		return ErrorServiceUnreachable
+	}
+
+	var closed *whatsapp.ErrConnectionClosed
+	if errors.As(err, &closed) {
+		if closed.Code == 1000 {
+			return ErrorForcedDisconnect
+		}
+		return ErrorServerClosed
+	}
+
+	var failed *whatsapp.ErrConnectionFailed
+	if errors.As(err, &failed) {
+		return classifyConnectionErrorText(failed.Err.Error())
+	}
+
+	switch {
+	case errors.Is(err, whatsapp.ErrMessageTypeNotImplemented):
+		return ErrorNotImplemented
+	case errors.Is(err, whatsapp.ErrInvalidWebsocket):
+		return ErrorInvalidWebsocket
+	case errors.Is(err, whatsapp.ErrNotConnected):
+		return ErrorNotConnected
+	case errors.Is(err, whatsapp.ErrConnectionTimeout):
+		return ErrorTimeout
+	case errors.Is(err, whatsapp.ErrInvalidSession):
+		return ErrorUnauthorized
+	}
+
+	return classifyConnectionErrorText(err.Error())
+}
+
+// Resposta do whatsapp ao restaurar a sessão, "init responded with 401"
+// A biblioteca formata o status como float, "admin login responded with %!d(float64=401)"
+var respondedWithStatus = regexp.MustCompile(`responded with (?:%!d\(float64=)?(\d{3})\b`)
+
+// Código de status da resposta do whatsapp contido no texto do erro
+func connectionErrorStatus(text string) (status int, ok bool) {
+	match := respondedWithStatus.FindStringSubmatch(text)
+	if match == nil {
+		return
+	}
+
+	status, err := strconv.Atoi(match[1])
+	return status, err == nil
+}
+
+// Erros que a biblioteca gera somente como texto
+func classifyConnectionErrorText(text string) QPConnectionErrorKind {
+	if status, ok := connectionErrorStatus(text); ok && status == 401 {
+		return ErrorUnauthorized
+	}
+
+	switch {
+	case strings.Contains(text, "close 1006"):
+		return ErrorWebsocketCorrupted
+	case strings.Contains(text, "connection reset by peer"):
+		return ErrorConnectionReset
+	case strings.Contains(text, "code: 1000"):
+		return ErrorForcedDisconnect
+	case strings.Contains(text, "keepAlive failed"):
+		return ErrorKeepAliveFailed
+	case strings.Contains(text, "server closed connection"):
+		return ErrorServerClosed
+	case strings.Contains(text, "invalid websocket"):
+		return ErrorInvalidWebsocket
+	case strings.Contains(text, "message type not implemented"):
+		return ErrorNotImplemented
+	case strings.Contains(text, "timed out"):
+		return ErrorTimeout
+	case strings.Contains(text, "bad handshake"):
+		return ErrorServiceUnreachable
+	case strings.Contains(text, "not connected"):
+		return ErrorNotConnected
+	default:
+		return ErrorUnknown
+	}
+}
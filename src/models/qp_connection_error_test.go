@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+)
+
+func TestClassifyConnectionError(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind QPConnectionErrorKind
+	}{
+		{nil, ErrorUnknown},
+		{&QPConnectionError{ErrorTimeout, errors.New("custom")}, ErrorTimeout},
+		{&ServiceUnreachableError{Server: "web.whatsapp.com"}, ErrorServiceUnreachable},
+		{&whatsapp.ErrConnectionClosed{Code: 1000}, ErrorForcedDisconnect},
+		{&whatsapp.ErrConnectionClosed{Code: 1006}, ErrorServerClosed},
+		{&whatsapp.ErrConnectionFailed{Err: errors.New("websocket: close 1006 (abnormal closure)")}, ErrorWebsocketCorrupted},
+		{&whatsapp.ErrConnectionFailed{Err: errors.New("read tcp: connection reset by peer")}, ErrorConnectionReset},
+		{fmt.Errorf("restoring: %w", whatsapp.ErrMessageTypeNotImplemented), ErrorNotImplemented},
+		{whatsapp.ErrInvalidWebsocket, ErrorInvalidWebsocket},
+		{whatsapp.ErrNotConnected, ErrorNotConnected},
+		{whatsapp.ErrConnectionTimeout, ErrorTimeout},
+		{whatsapp.ErrInvalidSession, ErrorUnauthorized},
+		{errors.New("keepAlive failed"), ErrorKeepAliveFailed},
+		{errors.New("restore session login timed out"), ErrorTimeout},
+		{errors.New("websocket: bad handshake"), ErrorServiceUnreachable},
+		{errors.New("something else"), ErrorUnknown},
+	}
+
+	for _, c := range cases {
+		if kind := ClassifyConnectionError(c.err); kind != c.kind {
+			t.Errorf("%v: expected %s, got %s", c.err, c.kind, kind)
+		}
+	}
+}
+
+// Somente o status da resposta do whatsapp indica sessão recusada
+func TestClassifyConnectionErrorStatus(t *testing.T) {
+	cases := []struct {
+		text string
+		kind QPConnectionErrorKind
+	}{
+		{"init responded with 401", ErrorUnauthorized},
+		{"admin login responded with %!d(float64=401)", ErrorUnauthorized},
+		{"admin login responded with 403", ErrorUnknown},
+		{"challenge responded with 4010", ErrorUnknown},
+		{"error sending message 3EB0401ABC", ErrorUnknown},
+		{"invalid media key 401", ErrorUnknown},
+	}
+
+	for _, c := range cases {
+		if kind := ClassifyConnectionError(errors.New(c.text)); kind != c.kind {
+			t.Errorf("%q: expected %s, got %s", c.text, c.kind, kind)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Estado da conexão de um servidor whatsapp
+type QPConnectionState string
+
+const (
+	Created      QPConnectionState = "created"      // Servidor instanciado, ainda não iniciado
+	Starting     QPConnectionState = "starting"     // Restaurando a sessão
+	Connected    QPConnectionState = "connected"    // Sessão restaurada, gravando as novas chaves
+	Fetching     QPConnectionState = "fetching"     // Carregando as mensagens iniciais
+	Ready        QPConnectionState = "ready"        // Pronto para enviar e receber
+	Unreachable  QPConnectionState = "unreachable"  // KeepAlive falhou, aguardando o retorno do celular
+	Restarting   QPConnectionState = "restarting"   // Derrubando a conexão para iniciar novamente
+	Disconnected QPConnectionState = "disconnected" // Conexão derrubada, aguardando nova tentativa
+	Halting      QPConnectionState = "halting"      // Desligando a pedido do usuário
+	Stopped      QPConnectionState = "stopped"      // Desligado, não reconecta automaticamente
+	Failed       QPConnectionState = "fail"         // Falha ao iniciar, será tentado novamente
+	Unverified   QPConnectionState = "unverified"   // O whatsapp não aceita mais a sessão, é necessário ler o QRCode novamente
+	Critical     QPConnectionState = "critical"     // Falha inesperada, necessita intervenção
+	Suspended    QPConnectionState = "suspended"    // Muitas falhas seguidas, aguardando ser iniciado manualmente
+)
+
+// Transições permitidas apartir de cada estado
+var connectionTransitions = map[QPConnectionState][]QPConnectionState{
+	Created:      {Starting, Halting, Stopped},
+	Starting:     {Connected, Failed, Unverified, Halting},
+	Connected:    {Fetching, Failed, Restarting, Halting},
+	Fetching:     {Ready, Failed, Restarting, Halting},
+	Ready:        {Unreachable, Restarting, Disconnected, Halting},
+	Unreachable:  {Ready, Restarting, Disconnected, Halting},
+	Restarting:   {Disconnected, Halting},
+	Disconnected: {Starting, Restarting, Halting, Critical},
+	Halting:      {Stopped},
+	Stopped:      {Starting},
+	Failed:       {Starting, Restarting, Unverified, Halting, Stopped, Suspended},
+	Unverified:   {Starting, Halting, Stopped},
+	Critical:     {Starting, Restarting, Halting},
+	Suspended:    {Starting, Halting, Stopped},
+}
+
+func (state QPConnectionState) String() string {
+	return string(state)
+}
+
+// Registro de uma mudança de estado
+type QPConnectionStateTransition struct {
+	From      QPConnectionState `json:"from"`
+	To        QPConnectionState `json:"to"`
+	Reason    string            `json:"reason,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Quantidade máxima de transições mantidas no histórico de cada servidor
+const connectionHistoryLength = 100
+
+// Máquina de estados da conexão, segura para uso por várias rotinas simultâneas
+type QPConnectionStateMachine struct {
+	state    QPConnectionState
+	history  []QPConnectionStateTransition
+	listener func(QPConnectionStateTransition) // Avisado a cada mudança de estado
+	sync     *sync.RWMutex                     // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+func NewQPConnectionStateMachine() *QPConnectionStateMachine {
+	return &QPConnectionStateMachine{state: Created, sync: &sync.RWMutex{}}
+}
+
+func (machine *QPConnectionStateMachine) Get() QPConnectionState {
+	machine.sync.RLock()
+	defer machine.sync.RUnlock()
+	return machine.state
+}
+
+// Define quem será avisado a cada mudança de estado, fora da trava
+func (machine *QPConnectionStateMachine) OnTransition(listener func(QPConnectionStateTransition)) {
+	machine.sync.Lock()
+	machine.listener = listener
+	machine.sync.Unlock()
+}
+
+// O estado atual é algum dos informados ?
+func (machine *QPConnectionStateMachine) Is(states ...QPConnectionState) bool {
+	current := machine.Get()
+	for _, state := range states {
+		if current == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Muda para o novo estado, caso a transição seja permitida apartir do estado atual
+func (machine *QPConnectionStateMachine) Transition(to QPConnectionState, reason string) error {
+	machine.sync.Lock()
+	record, err := machine.transition(to, reason)
+	listener := machine.listener
+	machine.sync.Unlock()
+
+	notify(listener, record)
+	return err
+}
+
+// Muda para o novo estado somente se o estado atual for algum dos informados
+// Verificação e mudança acontecem de forma atômica, evitando que duas rotinas façam a mesma transição
+func (machine *QPConnectionStateMachine) TransitionFrom(from []QPConnectionState, to QPConnectionState, reason string) bool {
+	machine.sync.Lock()
+	var record *QPConnectionStateTransition
+	var err error = fmt.Errorf("current state %s not in %v", machine.state, from)
+	for _, state := range from {
+		if machine.state == state {
+			record, err = machine.transition(to, reason)
+			break
+		}
+	}
+	listener := machine.listener
+	machine.sync.Unlock()
+
+	notify(listener, record)
+	return err == nil
+}
+
+func notify(listener func(QPConnectionStateTransition), record *QPConnectionStateTransition) {
+	if listener != nil && record != nil {
+		listener(*record)
+	}
+}
+
+// Retorna o registro da transição, nulo caso o estado não tenha mudado
+func (machine *QPConnectionStateMachine) transition(to QPConnectionState, reason string) (*QPConnectionStateTransition, error) {
+	from := machine.state
+	if from == to {
+		return nil, nil
+	}
+
+	allowed := false
+	for _, state := range connectionTransitions[from] {
+		if state == to {
+			allowed = true
+			break
+		}
+	}
+
+	if !allowed {
+		return nil, fmt.Errorf("invalid connection state transition: %s -> %s", from, to)
+	}
+
+	record := QPConnectionStateTransition{from, to, reason, time.Now()}
+	machine.state = to
+	machine.history = append(machine.history, record)
+	if len(machine.history) > connectionHistoryLength {
+		machine.history = machine.history[len(machine.history)-connectionHistoryLength:]
+	}
+	return &record, nil
+}
+
+// Cópia do histórico de transições, da mais antiga para a mais recente
+func (machine *QPConnectionStateMachine) History() []QPConnectionStateTransition {
+	machine.sync.RLock()
+	defer machine.sync.RUnlock()
+
+	history := make([]QPConnectionStateTransition, len(machine.history))
+	copy(history, machine.history)
+	return history
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConnectionStateTransitions(t *testing.T) {
+	machine := NewQPConnectionStateMachine()
+
+	for _, state := range []QPConnectionState{Starting, Connected, Fetching, Ready} {
+		if err := machine.Transition(state, "test"); err != nil {
+			t.Fatalf("unexpected error moving to %s: %s", state, err)
+		}
+	}
+
+	if err := machine.Transition(Starting, "test"); err == nil {
+		t.Errorf("expected error on invalid transition ready -> starting")
+	}
+
+	if state := machine.Get(); state != Ready {
+		t.Errorf("invalid transition changed the state to %s", state)
+	}
+
+	// Permanecer no mesmo estado não é uma transição
+	if err := machine.Transition(Ready, "again"); err != nil {
+		t.Errorf("unexpected error staying on the same state: %s", err)
+	}
+
+	if history := machine.History(); len(history) != 4 || history[3].From != Fetching || history[3].To != Ready {
+		t.Errorf("unexpected history: %#v", history)
+	}
+}
+
+// Desligando nunca volta a falhar, o que reiniciaria o laço de reconexão
+func TestConnectionStateHaltingOnlyStops(t *testing.T) {
+	machine := NewQPConnectionStateMachine()
+	machine.Transition(Starting, "test")
+	machine.Transition(Halting, "test")
+
+	if err := machine.Transition(Failed, "test"); err == nil || !machine.Is(Halting) {
+		t.Errorf("expected halting -> fail to be refused, got %v, %s", err, machine.Get())
+	}
+}
+
+// Toda transição declarada deve levar a um estado conhecido
+func TestConnectionStateTransitionsDeclared(t *testing.T) {
+	for from, targets := range connectionTransitions {
+		for _, to := range targets {
+			if _, ok := connectionTransitions[to]; !ok {
+				t.Errorf("transition %s -> %s leads to an undeclared state", from, to)
+			}
+		}
+	}
+}
+
+func TestConnectionStateTransitionFrom(t *testing.T) {
+	machine := NewQPConnectionStateMachine()
+	machine.Transition(Starting, "test")
+	machine.Transition(Failed, "test")
+
+	if machine.TransitionFrom([]QPConnectionState{Ready}, Restarting, "test") {
+		t.Errorf("expected no transition from a state not listed")
+	}
+
+	// Somente uma das rotinas simultâneas realiza a transição
+	var wait sync.WaitGroup
+	var count int32
+	var mutex sync.Mutex
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if machine.TransitionFrom([]QPConnectionState{Failed}, Restarting, "concurrent") {
+				mutex.Lock()
+				count++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wait.Wait()
+
+	if count != 1 || !machine.Is(Restarting) {
+		t.Errorf("expected a single transition to restarting, got %d, %s", count, machine.Get())
+	}
+}
+
+func TestConnectionStateListener(t *testing.T) {
+	machine := NewQPConnectionStateMachine()
+
+	var records []QPConnectionStateTransition
+	machine.OnTransition(func(record QPConnectionStateTransition) {
+		// Chamado fora da trava, pode consultar a máquina
+		if machine.Get() != record.To {
+			t.Errorf("listener called before the state changed")
+		}
+		records = append(records, record)
+	})
+
+	machine.Transition(Starting, "start")
+	machine.Transition(Starting, "again")
+	machine.Transition(Ready, "invalid")
+
+	if len(records) != 1 || records[0].From != Created || records[0].To != Starting || records[0].Reason != "start" {
+		t.Errorf("unexpected notifications: %#v", records)
+	}
+}
+
+func TestConnectionStateHistoryLength(t *testing.T) {
+	machine := NewQPConnectionStateMachine()
+	machine.Transition(Starting, "test")
+	for i := 0; i < connectionHistoryLength; i++ {
+		machine.Transition(Failed, "test")
+		machine.Transition(Starting, "test")
+	}
+
+	history := machine.History()
+	if len(history) != connectionHistoryLength {
+		t.Fatalf("expected history capped at %d, got %d", connectionHistoryLength, len(history))
+	}
+
+	if last := history[len(history)-1]; last.From != Failed || last.To != Starting {
+		t.Errorf("expected the most recent transition last, got %#v", last)
+	}
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"log"
 	"os"
 	"sync"
 	"time"
@@ -11,6 +10,7 @@ import (
 	
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -19,11 +19,14 @@ import (
 )
 
 type QPDatabase struct {
-	Config     QPDatabaseConfig
-	Connection *sqlx.DB
-	Store      IQPStore
-	User       IQPUser
-	Bot        IQPBot
+	Config      QPDatabaseConfig
+	Connection  *sqlx.DB
+	Store       IQPStore
+	User        IQPUser
+	Bot         IQPBot
+	APIKey      IQPBotAPIKey
+	Team        IQPTeam
+	UserSession IQPUserSession
 }
 
 var (
@@ -40,17 +43,13 @@ func GetDB() *sqlx.DB {
 		// Tenta realizar a conexão
 		dbconn, err := sqlx.Connect(config.Driver, config.GetConnectionString())		
 		if err != nil {
-			log.Println(err)
+			Log.WithComponent("database").WithError(err).Errorf("error connecting to database")
 		}
 
 		dbconn.DB.SetMaxIdleConns(500)		
 		dbconn.DB.SetMaxOpenConns(1000)
 		dbconn.DB.SetConnMaxLifetime(30 * time.Second)
 
-		if err != nil {
-			log.Println(err)
-		}
-
 		// Definindo uma única conexão para todo o sistema
 		Connection = dbconn
 	})
@@ -63,20 +62,29 @@ func GetDatabase() *QPDatabase {
 	var istore IQPStore
 	var iuser IQPUser
 	var ibot IQPBot
+	var iapikey IQPBotAPIKey
+	var iteam IQPTeam
+	var isession IQPUserSession
 
 	if config.Driver == "postgres" {
 		istore = QPStorePostgres{db}
 		iuser = QPUserPostgres{db}
 		ibot = QPBotPostgres{db}
+		iapikey = QPBotAPIKeyPostgres{db}
+		iteam = QPTeamPostgres{db}
+		isession = QPUserSessionPostgres{db}
 	} else if config.Driver == "mysql" || config.Driver == "sqlite3" {
 		istore = QPStoreMysql{db}
 		iuser = QPUserMysql{db}
 		ibot = QPBotMysql{db}
+		iapikey = QPBotAPIKeyMysql{db}
+		iteam = QPTeamMysql{db}
+		isession = QPUserSessionMysql{db}
 	} else {
-		log.Fatal("database driver not supported")
+		Log.WithComponent("database").Fatalf("database driver not supported")
 	}
 
-	return &QPDatabase{*config, db, istore, iuser, ibot}
+	return &QPDatabase{*config, db, istore, iuser, ibot, iapikey, iteam, isession}
 }
 
 func GetDBConfig() *QPDatabaseConfig {
@@ -94,8 +102,24 @@ func GetDBConfig() *QPDatabaseConfig {
 	return config
 }
 
+// Migrações aplicadas (ou desabilitadas) com sucesso, usado pela verificação de prontidão
+var databaseMigrated bool
+var databaseMigratedSync = &sync.RWMutex{}
+
+func IsDatabaseMigrated() bool {
+	databaseMigratedSync.RLock()
+	defer databaseMigratedSync.RUnlock()
+	return databaseMigrated
+}
+
 // MigrateToLatest updates the database to the latest schema
 func MigrateToLatest() (err error) {
+	defer func() {
+		databaseMigratedSync.Lock()
+		databaseMigrated = err == nil
+		databaseMigratedSync.Unlock()
+	}()
+
 	strMigrations := os.Getenv("MIGRATIONS")
 	if len(strMigrations) == 0 {
 		return
@@ -113,7 +137,7 @@ func MigrateToLatest() (err error) {
 		fullPath = strMigrations
 	}
 
-	log.Println("Migrating database (if necessary)")
+	Log.WithComponent("migrations").Infof("migrating database (if necessary)")
 	if boolMigrations {
 		workDir, err := os.Getwd()
 		if err != nil {
@@ -121,7 +145,7 @@ func MigrateToLatest() (err error) {
 		}
 
 		if runtime.GOOS == "windows" {
-			log.Println("Migrating database on Windows")
+			Log.WithComponent("migrations").Infof("migrating database on windows")
 
 			// windows ===================
 			leadingWindowsUnit, _ := filepath.Rel("z:\\", workDir)
@@ -139,28 +163,28 @@ func MigrateToLatest() (err error) {
 	db := superDB.DB
 	migrator := migrate.Sqlx{
 		Printf: func(format string, args ...interface{}) (int, error) {
-			log.Println(format, args)
+			Log.WithComponent("migrations").Infof(strings.TrimRight(format, "\n"), args...)
 			return 0, nil
 		},
 		Migrations: Migrations(fullPath),
 	}
 	
-	log.Println("Migrating ...")	
+	Log.WithComponent("migrations").Infof("migrating ...")	
 	err = migrator.Migrate(db, config.Driver)
 	if err != nil {
-		log.Fatal(err)
+		Log.WithComponent("migrations").WithError(err).Fatalf("error migrating database")
 	}
 	return nil
 }
 
 func Migrations(fullPath string) (migrations []migrate.SqlxMigration) {
-	log.Println("Migrating files from: ", fullPath)	
+	Log.WithComponent("migrations").Infof("migrating files from: %s", fullPath)	
 	files, err := ioutil.ReadDir(fullPath)
     if err != nil {
-        log.Fatal(err)
+        Log.WithComponent("migrations").WithError(err).Fatalf("error reading migrations")
     }
 
-	log.Println("Migrating creating array with definitions")	
+	Log.WithComponent("migrations").Debugf("creating array with definitions")	
 	confMap := make(map[string]*QPMigrationFile)
 
 	for _, file := range files {
@@ -187,7 +211,19 @@ func Migrations(fullPath string) (migrations []migrate.SqlxMigration) {
 		}
 	}
 
-	for _, migration := range confMap {
+	// Ordenando pelo ID, as migrações mais novas dependem das anteriores
+	var ids []string
+	for id := range confMap {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseUint(ids[i], 10, 64)
+		b, _ := strconv.ParseUint(ids[j], 10, 64)
+		return a < b
+	})
+
+	for _, id := range ids {
+		migration := confMap[id]
 		migrations = append(migrations, migrate.SqlxFileMigration(migration.ID, migration.FileUp, migration.FileDown))
 	}
 	
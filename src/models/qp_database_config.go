@@ -1,9 +1,6 @@
 package models
 
-import (
-	"fmt"
-	"log"
-)
+import "fmt"
 
 type QPDatabaseConfig struct {
 	Driver   string
@@ -24,6 +21,6 @@ func (config *QPDatabaseConfig) GetConnectionString() (connection string) {
 			config.Host, config.DataBase, config.Port, config.User, config.Password, config.SSL)
 	} else if config.Driver == "sqlite3" {
 		connection = "quepasa.db?cache=shared&mode=memory"
-	} else { log.Fatal("database driver not supported") }
+	} else { Log.WithComponent("database").Fatalf("database driver not supported") }
 	return
 }
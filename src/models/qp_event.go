@@ -0,0 +1,20 @@
+package models
+
+// Evento no formato QuePasa
+// Enviado ao WebHook e ao stream de eventos, separado das mensagens
+type QPEvent struct {
+	Type      string `json:"event"`
+	Timestamp int64  `json:"timestamp"`
+
+	// Bot que originou o evento
+	Controller QPEndPoint `json:"controller"`
+
+	Presence *QPPresence `json:"presence,omitempty"`
+
+	// Eventos sobre o estado da conexão
+	Previous QPConnectionState `json:"previous,omitempty"`
+	State    QPConnectionState `json:"state,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+
+	Battery *WhatsAppBateryStatus `json:"battery,omitempty"`
+}
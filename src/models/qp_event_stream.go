@@ -0,0 +1,47 @@
+package models
+
+import (
+	"sync"
+)
+
+// Distribui eventos de um servidor para os clientes conectados ao stream
+type QPEventStream struct {
+	subscribers map[chan QPEvent]bool
+	sync        *sync.Mutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+func NewQPEventStream() *QPEventStream {
+	return &QPEventStream{make(map[chan QPEvent]bool), &sync.Mutex{}}
+}
+
+// Cria um novo canal que receberá todos os eventos publicados apartir de agora
+func (stream *QPEventStream) Subscribe() chan QPEvent {
+	ch := make(chan QPEvent, 32)
+
+	stream.sync.Lock()
+	stream.subscribers[ch] = true
+	stream.sync.Unlock()
+
+	return ch
+}
+
+func (stream *QPEventStream) Unsubscribe(ch chan QPEvent) {
+	stream.sync.Lock()
+	if _, ok := stream.subscribers[ch]; ok {
+		delete(stream.subscribers, ch)
+		close(ch)
+	}
+	stream.sync.Unlock()
+}
+
+// Publica sem bloquear, clientes lentos demais perdem o evento
+func (stream *QPEventStream) Publish(event QPEvent) {
+	stream.sync.Lock()
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	stream.sync.Unlock()
+}
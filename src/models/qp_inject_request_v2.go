@@ -0,0 +1,40 @@
+package models
+
+// Requisição no formato QuePasa
+// Utilizada na API do QuePasa para simular o recebimento de uma mensagem por um bot simulado
+type QPInjectRequestV2 struct {
+	// text, image, audio, document, location, contact, battery ou json
+	Type string `json:"type"`
+
+	// Opcional, gerado caso não informado
+	ID        string `json:"id,omitempty"`
+	Timestamp uint64 `json:"timestamp,omitempty"`
+
+	// Conversa de origem, contato (@s.whatsapp.net) ou grupo (@g.us)
+	From string `json:"from,omitempty"`
+
+	// Quem enviou a mensagem dentro de um grupo
+	Participant string `json:"participant,omitempty"`
+
+	// Nome do contato, incluído no cache de contatos do bot
+	Name   string `json:"name,omitempty"`
+	FromMe bool   `json:"fromme,omitempty"`
+
+	// Texto da mensagem ou legenda do anexo
+	Text string `json:"text,omitempty"`
+
+	// Anexo em base64, servido depois pelo download de anexos
+	Attachment QPAttachment `json:"attachment,omitempty"`
+
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	VCard     string  `json:"vcard,omitempty"`
+
+	// Atualização de bateria do celular
+	Percentage int  `json:"percentage,omitempty"`
+	Plugged    bool `json:"plugged,omitempty"`
+	Powersave  bool `json:"powersave,omitempty"`
+
+	// Mensagem json crua, como enviada pelo whatsapp
+	Json string `json:"json,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// Estado mantido para cada chave, descartado quando ocioso
+type qpKeyedEntry interface {
+	Idle(now time.Time) bool
+}
+
+// Estados por chave, seguro para uso por várias rotinas, com remoção periódica das chaves ociosas
+// Base do limitador de requisições e do bloqueio de login
+type qpKeyedStore struct {
+	sync    *sync.Mutex
+	entries map[string]qpKeyedEntry
+	swept   time.Time
+
+	// Relógio do controle, substituído nos testes
+	Now func() time.Time
+}
+
+func newQPKeyedStore() qpKeyedStore {
+	return qpKeyedStore{
+		sync:    &sync.Mutex{},
+		entries: make(map[string]qpKeyedEntry),
+		Now:     time.Now,
+	}
+}
+
+// Executa a ação com os estados travados, após remover as chaves ociosas
+func (store *qpKeyedStore) update(action func(entries map[string]qpKeyedEntry, now time.Time)) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+
+	now := store.Now()
+	store.sweep(now)
+	action(store.entries, now)
+}
+
+// Esquece o estado da chave
+func (store *qpKeyedStore) Forget(key string) {
+	store.sync.Lock()
+	delete(store.entries, key)
+	store.sync.Unlock()
+}
+
+// Descarta todos os estados
+func (store *qpKeyedStore) Reset() {
+	store.sync.Lock()
+	store.entries = make(map[string]qpKeyedEntry)
+	store.sync.Unlock()
+}
+
+// Remove os estados ociosos, no máximo uma vez por minuto
+func (store *qpKeyedStore) sweep(now time.Time) {
+	if now.Sub(store.swept) < time.Minute {
+		return
+	}
+
+	for key, entry := range store.entries {
+		if entry.Idle(now) {
+			delete(store.entries, key)
+		}
+	}
+	store.swept = now
+}
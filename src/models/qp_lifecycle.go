@@ -0,0 +1,168 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// Eventos de ciclo de vida, enviados ao WebHook do usuário dono do bot
+// ou ao WebHook global definido pela variável de ambiente LIFECYCLEWEBHOOK
+const (
+	LifecycleConnected    = "connected"
+	LifecycleReady        = "ready"
+	LifecycleDisconnected = "disconnected"
+	LifecycleUnreachable  = "unreachable"
+	LifecycleUnverified   = "unverified"
+	LifecycleRestarting   = "restarting"
+	LifecycleSuspended    = "suspended"
+	LifecycleBatteryLow   = "battery_low"
+	LifecycleUnplugged    = "unplugged"
+)
+
+// Estados que geram um evento ao serem alcançados
+var lifecycleEvents = map[QPConnectionState]string{
+	Connected:    LifecycleConnected,
+	Ready:        LifecycleReady,
+	Disconnected: LifecycleDisconnected,
+	Unreachable:  LifecycleUnreachable,
+	Unverified:   LifecycleUnverified,
+	Restarting:   LifecycleRestarting,
+	Suspended:    LifecycleSuspended,
+}
+
+// Percentual padrão da bateria abaixo do qual avisamos, configurável por BATTERYLOWTHRESHOLD
+func GetBatteryLowThreshold() int {
+	return getenvInt("BATTERYLOWTHRESHOLD", 20)
+}
+
+// Chamado pela máquina de estados a cada mudança
+func (server *QPWhatsAppServer) onStateTransition(transition QPConnectionStateTransition) {
+	observeConnectionState(server.GetBot(), transition)
+
+	eventType, ok := lifecycleEvents[transition.To]
+	if !ok {
+		return
+	}
+
+	event := server.NewEvent(eventType)
+	event.Timestamp = transition.Timestamp.Unix()
+	event.Previous = transition.From
+	event.State = transition.To
+	event.Reason = transition.Reason
+	server.RaiseLifecycleEvent(event)
+}
+
+// Avisa caso a bateria tenha acabado de cruzar o limite ou o carregador tenha sido removido
+func (server *QPWhatsAppServer) checkBattery(previous WhatsAppBateryStatus, current WhatsAppBateryStatus) {
+	bot := server.GetBot()
+	known := !previous.Timestamp.IsZero()
+	if bot.UnpluggedAlert && known && previous.Plugged && !current.Plugged {
+		event := server.NewEvent(LifecycleUnplugged)
+		event.State = server.State.Get()
+		event.Reason = "charger removed"
+		event.Battery = &current
+		server.RaiseLifecycleEvent(event)
+	}
+
+	threshold := bot.GetBatteryThreshold()
+	if threshold < 0 || current.Plugged || current.Percentage > threshold {
+		return
+	}
+
+	// Já estava abaixo do limite na última atualização
+	if known && !previous.Plugged && previous.Percentage <= threshold {
+		return
+	}
+
+	event := server.NewEvent(LifecycleBatteryLow)
+	event.State = server.State.Get()
+	event.Reason = "battery at " + strconv.Itoa(current.Percentage) + "%"
+	event.Battery = &current
+	server.RaiseLifecycleEvent(event)
+}
+
+// Avisa os inscritos no stream e o WebHook de ciclo de vida
+func (server *QPWhatsAppServer) RaiseLifecycleEvent(event QPEvent) {
+	server.Events.Publish(event)
+
+	// Executando WebHook de forma assincrona
+	RunOutbound(func() {
+		bot := server.GetBot()
+		if err := bot.PostLifecycleEvent(server.GetLifecycleWebHook(), event); err != nil {
+			server.Log.WithComponent("webhook").WithError(err).Errorf("error posting lifecycle event")
+		}
+	})
+}
+
+var ErrInvalidWebHook = errors.New("invalid webhook url, use an absolute http or https url")
+
+// WebHook que recebe os eventos de ciclo de vida deste bot
+// O definido pelo usuário tem preferência sobre o global
+func (server *QPWhatsAppServer) GetLifecycleWebHook() string {
+	server.syncBot.RLock()
+	url := server.lifecycleWebHook
+	server.syncBot.RUnlock()
+
+	if len(url) > 0 {
+		return url
+	}
+
+	url, _ = getenvStr("LIFECYCLEWEBHOOK")
+	return url
+}
+
+func (server *QPWhatsAppServer) setLifecycleWebHook(url string) {
+	server.syncBot.Lock()
+	server.lifecycleWebHook = url
+	server.syncBot.Unlock()
+}
+
+// Lê do banco o WebHook do dono, uma única vez ao incluir o servidor
+func (server *QPWhatsAppServer) loadLifecycleWebHook() {
+	if WhatsAppService == nil || WhatsAppService.DB == nil {
+		return
+	}
+
+	user, err := WhatsAppService.DB.User.FindByID(server.GetBot().UserID)
+	if err != nil {
+		server.Log.WithError(err).Warnf("error loading lifecycle webhook")
+		return
+	}
+	server.setLifecycleWebHook(user.LifecycleWebHook)
+}
+
+// Valida e grava o WebHook de ciclo de vida do usuário, vazio usa o global
+// Os servidores em execução dos bots do usuário passam a usar o novo endereço
+func SetUserLifecycleWebHook(user QPUser, webhook string) (err error) {
+	if len(webhook) > 0 {
+		parsed, err := url.ParseRequestURI(webhook)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+			return ErrInvalidWebHook
+		}
+	}
+
+	if err = WhatsAppService.DB.User.SetLifecycleWebHook(user.ID, webhook); err != nil {
+		return
+	}
+
+	for _, server := range WhatsAppService.Servers.List() {
+		if server.GetBot().UserID == user.ID {
+			server.setLifecycleWebHook(webhook)
+		}
+	}
+	return
+}
+
+func (bot *QPBot) PostLifecycleEvent(url string, event QPEvent) error {
+	if len(url) > 0 {
+		payloadJson, _ := json.Marshal(event)
+		resp, err := postWebHook(*bot, "lifecycle", url, payloadJson)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
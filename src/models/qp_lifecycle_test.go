@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLifecycleEventUsesCachedWebHook(t *testing.T) {
+	server, _ := newHandlerTestServer(t)
+
+	received := make(chan QPEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event QPEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer webhook.Close()
+
+	// Sem banco configurado, o endereço vem apenas do cache do servidor
+	server.setLifecycleWebHook(webhook.URL)
+	server.RaiseLifecycleEvent(server.NewEvent(LifecycleBatteryLow))
+
+	select {
+	case event := <-received:
+		if event.Type != LifecycleBatteryLow {
+			t.Errorf("expected a battery event, got %q", event.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the event to be posted to the cached webhook")
+	}
+}
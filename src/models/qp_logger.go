@@ -0,0 +1,238 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Nível de log, do mais detalhado ao mais grave
+type QPLogLevel int
+
+const (
+	LogDebug QPLogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = map[QPLogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+}
+
+func (level QPLogLevel) String() string {
+	return logLevelNames[level]
+}
+
+func (level QPLogLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(level.String())
+}
+
+func ParseLogLevel(s string) (QPLogLevel, error) {
+	for level, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return LogInfo, fmt.Errorf("invalid log level: %s", s)
+}
+
+// Campos estruturados, gravados separados da mensagem
+type QPLogFields map[string]interface{}
+
+// Saída compartilhada por todos os loggers, configurada por LOGLEVEL (debug, info, warn, error)
+// e LOGFORMAT (text, json)
+type qpLogOutput struct {
+	writer io.Writer
+	json   bool
+	level  QPLogLevel
+	sync   *sync.Mutex
+}
+
+var logOutput = newLogOutput()
+
+func newLogOutput() *qpLogOutput {
+	output := &qpLogOutput{writer: os.Stderr, level: LogInfo, sync: &sync.Mutex{}}
+	if level, err := ParseLogLevel(os.Getenv("LOGLEVEL")); err == nil {
+		output.level = level
+	}
+	output.json = strings.EqualFold(os.Getenv("LOGFORMAT"), "json")
+	return output
+}
+
+// Relê LOGLEVEL e LOGFORMAT, usado após carregar o arquivo .env
+func ConfigureLogger() {
+	configured := newLogOutput()
+	logOutput.sync.Lock()
+	logOutput.level = configured.level
+	logOutput.json = configured.json
+	logOutput.sync.Unlock()
+}
+
+// Logger com campos fixos (bot, número, componente, requisição)
+// O nível pode ser sobrescrito em tempo de execução, usado por bot
+type QPLogger struct {
+	fields QPLogFields
+	level  *qpLogLevelOverride
+}
+
+type qpLogLevelOverride struct {
+	level *QPLogLevel
+	sync  *sync.RWMutex
+}
+
+// Logger raiz, sem campos
+var Log = &QPLogger{fields: QPLogFields{}}
+
+// Novo logger que herda os campos e o nível deste
+func (logger *QPLogger) WithFields(fields QPLogFields) *QPLogger {
+	merged := make(QPLogFields, len(logger.fields)+len(fields))
+	for key, value := range logger.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &QPLogger{fields: merged, level: logger.level}
+}
+
+func (logger *QPLogger) WithField(key string, value interface{}) *QPLogger {
+	return logger.WithFields(QPLogFields{key: value})
+}
+
+func (logger *QPLogger) WithComponent(component string) *QPLogger {
+	return logger.WithField("component", component)
+}
+
+func (logger *QPLogger) WithError(err error) *QPLogger {
+	return logger.WithField("error", err)
+}
+
+// Novo logger com nível próprio, independente do global
+func (logger *QPLogger) WithOwnLevel() *QPLogger {
+	child := logger.WithFields(nil)
+	child.level = &qpLogLevelOverride{sync: &sync.RWMutex{}}
+	return child
+}
+
+// Nível em uso, o próprio (se definido) ou o global
+func (logger *QPLogger) Level() QPLogLevel {
+	if logger.level != nil {
+		logger.level.sync.RLock()
+		defer logger.level.sync.RUnlock()
+		if logger.level.level != nil {
+			return *logger.level.level
+		}
+	}
+
+	logOutput.sync.Lock()
+	defer logOutput.sync.Unlock()
+	return logOutput.level
+}
+
+// Define o nível próprio, nulo volta a seguir o global
+func (logger *QPLogger) SetLevel(level *QPLogLevel) error {
+	if logger.level == nil {
+		return fmt.Errorf("logger without own level")
+	}
+
+	logger.level.sync.Lock()
+	logger.level.level = level
+	logger.level.sync.Unlock()
+	return nil
+}
+
+func (logger *QPLogger) IsEnabled(level QPLogLevel) bool {
+	return level >= logger.Level()
+}
+
+func (logger *QPLogger) Debugf(format string, args ...interface{}) {
+	logger.write(LogDebug, format, args...)
+}
+
+func (logger *QPLogger) Infof(format string, args ...interface{}) {
+	logger.write(LogInfo, format, args...)
+}
+
+func (logger *QPLogger) Warnf(format string, args ...interface{}) {
+	logger.write(LogWarn, format, args...)
+}
+
+func (logger *QPLogger) Errorf(format string, args ...interface{}) {
+	logger.write(LogError, format, args...)
+}
+
+// Registra como erro e encerra o processo
+func (logger *QPLogger) Fatalf(format string, args ...interface{}) {
+	logger.write(LogError, format, args...)
+	os.Exit(1)
+}
+
+func (logger *QPLogger) write(level QPLogLevel, format string, args ...interface{}) {
+	if !logger.IsEnabled(level) {
+		return
+	}
+
+	now := time.Now()
+	message := fmt.Sprintf(format, args...)
+
+	logOutput.sync.Lock()
+	defer logOutput.sync.Unlock()
+
+	if logOutput.json {
+		entry := make(map[string]interface{}, len(logger.fields)+3)
+		for key, value := range logger.fields {
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			entry[key] = value
+		}
+		entry["time"] = now.Format(time.RFC3339)
+		entry["level"] = level.String()
+		entry["msg"] = message
+
+		line, _ := json.Marshal(entry)
+		logOutput.writer.Write(append(line, '\n'))
+		return
+	}
+
+	keys := make([]string, 0, len(logger.fields))
+	for key := range logger.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var line strings.Builder
+	line.WriteString(now.Format(time.RFC3339))
+	line.WriteString(" ")
+	line.WriteString(strings.ToUpper(level.String()))
+	line.WriteString(" ")
+	line.WriteString(message)
+	for _, key := range keys {
+		line.WriteString(fmt.Sprintf(" %s=%q", key, fmt.Sprint(logger.fields[key])))
+	}
+	line.WriteString("\n")
+	logOutput.writer.Write([]byte(line.String()))
+}
+
+// Logger de um bot, com nível próprio, em depuração caso o bot esteja marcado como Devel
+func NewBotLogger(bot QPBot) *QPLogger {
+	logger := Log.WithComponent("whatsapp").WithFields(QPLogFields{
+		"bot":    bot.ID,
+		"number": bot.GetNumber(),
+	}).WithOwnLevel()
+
+	if bot.Devel {
+		level := LogDebug
+		logger.SetLevel(&level)
+	}
+	return logger
+}
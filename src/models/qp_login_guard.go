@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Tentativas de login com falha toleradas antes do bloqueio, por conta e por endereço de origem
+const (
+	defaultLoginAttemptsAccount = 3
+	defaultLoginAttemptsIP      = 10
+)
+
+// Bloqueio após a primeira falha excedente, dobrado a cada nova falha até o máximo
+const (
+	defaultLoginLockoutDelay = 2 * time.Second
+	defaultLoginLockoutMax   = 15 * time.Minute
+)
+
+// Falhas sem novas tentativas há mais tempo que isso são esquecidas
+const loginFailuresIdle = time.Hour
+
+var loginFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_login_failures_total",
+	Help: "Failed web login attempts, by factor (password, 2fa)",
+}, []string{"factor"})
+
+// Controle global das tentativas de login
+var LoginGuard = NewQPLoginGuard()
+
+type qpLoginFailures struct {
+	count  int
+	locked time.Time // bloqueado até este momento
+	last   time.Time
+}
+
+// Falhas ociosas e já desbloqueadas podem ser esquecidas
+func (failures *qpLoginFailures) Idle(now time.Time) bool {
+	return now.Sub(failures.last) > loginFailuresIdle && !failures.locked.After(now)
+}
+
+// Bloqueio de login por chave, com espera exponencial após as falhas toleradas
+// Forget esquece as falhas da chave, após um login bem sucedido
+type QPLoginGuard struct {
+	qpKeyedStore
+}
+
+func NewQPLoginGuard() *QPLoginGuard {
+	return &QPLoginGuard{newQPKeyedStore()}
+}
+
+// Tempo restante do bloqueio mais longo entre as chaves, zero quando liberado
+func (guard *QPLoginGuard) Locked(keys ...string) (wait time.Duration) {
+	guard.update(func(entries map[string]qpKeyedEntry, now time.Time) {
+		for _, key := range keys {
+			if failures, ok := entries[key].(*qpLoginFailures); ok && failures.locked.After(now) {
+				if remaining := failures.locked.Sub(now); remaining > wait {
+					wait = remaining
+				}
+			}
+		}
+	})
+	return
+}
+
+// Registra uma falha para a chave, bloqueando após as tentativas toleradas
+func (guard *QPLoginGuard) Fail(key string, attempts int) {
+	guard.update(func(entries map[string]qpKeyedEntry, now time.Time) {
+		failures, ok := entries[key].(*qpLoginFailures)
+		if !ok {
+			failures = &qpLoginFailures{}
+			entries[key] = failures
+		}
+
+		failures.count++
+		failures.last = now
+		if exceeded := failures.count - attempts; exceeded > 0 {
+			failures.locked = now.Add(GetLoginLockoutDelay(exceeded))
+		}
+	})
+}
+
+// Espera do bloqueio para a enésima falha excedente (LOGINLOCKOUTDELAY, LOGINLOCKOUTMAX)
+func GetLoginLockoutDelay(exceeded int) time.Duration {
+	delay := getenvDuration("LOGINLOCKOUTDELAY", defaultLoginLockoutDelay)
+	max := getenvDuration("LOGINLOCKOUTMAX", defaultLoginLockoutMax)
+	for i := 1; i < exceeded && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+func loginAccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginAddressKey(address string) string {
+	return "ip:" + address
+}
+
+// Tempo restante do bloqueio da conta ou do endereço de origem
+func CheckLoginLockout(email string, address string) time.Duration {
+	return LoginGuard.Locked(loginAccountKey(email), loginAddressKey(address))
+}
+
+// Registra a falha de login para a conta e o endereço de origem (LOGINATTEMPTS, LOGINATTEMPTSIP)
+func LoginFailed(email string, address string, factor string) {
+	loginFailures.WithLabelValues(factor).Inc()
+	LoginGuard.Fail(loginAccountKey(email), getenvInt("LOGINATTEMPTS", defaultLoginAttemptsAccount))
+	LoginGuard.Fail(loginAddressKey(address), getenvInt("LOGINATTEMPTSIP", defaultLoginAttemptsIP))
+}
+
+// Login completo, libera a conta, o endereço de origem segue com as suas falhas
+func LoginSucceeded(email string) {
+	LoginGuard.Forget(loginAccountKey(email))
+}
+
+// Erro dos logins recusados durante o bloqueio
+func LoginLockedError(wait time.Duration) error {
+	return fmt.Errorf("too many failed login attempts, retry in %d seconds", RetryAfterSeconds(wait))
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginGuardExponentialLockout(t *testing.T) {
+	now := time.Date(2021, 11, 5, 12, 0, 0, 0, time.UTC)
+	guard := NewQPLoginGuard()
+	guard.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		guard.Fail("account:user@example.com", 3)
+	}
+
+	if wait := guard.Locked("account:user@example.com"); wait != 0 {
+		t.Fatalf("tolerated failures should not lock, got %s", wait)
+	}
+
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for _, delay := range expected {
+		guard.Fail("account:user@example.com", 3)
+		if wait := guard.Locked("ip:192.0.2.1", "account:user@example.com"); wait != delay {
+			t.Errorf("expected to wait %s, got %s", delay, wait)
+		}
+	}
+
+	// Outras chaves têm suas próprias falhas
+	if wait := guard.Locked("account:other@example.com"); wait != 0 {
+		t.Errorf("expected another account to be free, got %s", wait)
+	}
+
+	now = now.Add(8 * time.Second)
+	if wait := guard.Locked("account:user@example.com"); wait != 0 {
+		t.Errorf("expected the lock to expire, got %s", wait)
+	}
+
+	guard.Forget("account:user@example.com")
+	guard.Fail("account:user@example.com", 3)
+	if wait := guard.Locked("account:user@example.com"); wait != 0 {
+		t.Errorf("expected the failures to be forgotten, got %s", wait)
+	}
+}
+
+func TestLoginGuardSweepsIdleFailures(t *testing.T) {
+	t.Setenv("LOGINLOCKOUTMAX", "24h")
+	now := time.Date(2021, 11, 5, 12, 0, 0, 0, time.UTC)
+	guard := NewQPLoginGuard()
+	guard.Now = func() time.Time { return now }
+
+	guard.Fail("idle", 3)
+	for i := 0; i < 20; i++ {
+		guard.Fail("locked", 3)
+	}
+
+	now = now.Add(loginFailuresIdle + time.Minute)
+	guard.Fail("active", 3)
+
+	if _, ok := guard.entries["idle"]; ok {
+		t.Errorf("expected idle failures to be swept")
+	}
+
+	// Ainda bloqueada, a chave é mantida mesmo ociosa
+	if _, ok := guard.entries["locked"]; !ok {
+		t.Errorf("expected locked failures to be kept")
+	}
+}
+
+func TestLoginLockoutDelayCapped(t *testing.T) {
+	if delay := GetLoginLockoutDelay(1); delay != defaultLoginLockoutDelay {
+		t.Errorf("unexpected first delay: %s", delay)
+	}
+
+	if delay := GetLoginLockoutDelay(100); delay != defaultLoginLockoutMax {
+		t.Errorf("expected the delay to be capped, got %s", delay)
+	}
+}
@@ -0,0 +1,7 @@
+package models
+
+// Requisição no formato QuePasa
+// Utilizada na API do QuePasa para alterar o nível de log do bot em execução, vazio volta ao global
+type QPLogLevelRequestV2 struct {
+	Level string `json:"level"`
+}
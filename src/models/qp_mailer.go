@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrMailerNotConfigured = errors.New("smtp not configured (SMTPHOST)")
+
+// Envio de emails aos usuários (convites e redefinição de senha)
+type IQPMailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// Remetente utilizado, quando vazio é criado a partir das variáveis de ambiente
+// Substituído nos testes
+var Mailer IQPMailer
+
+func GetMailer() IQPMailer {
+	if Mailer != nil {
+		return Mailer
+	}
+	return NewQPSMTPMailerFromEnv()
+}
+
+// Envio por SMTP, sem autenticação quando o usuário não é informado
+// Com TLS conecta diretamente por TLS (porta 465), senão usa STARTTLS caso o servidor ofereça
+type QPSMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      bool
+
+	// Aceita certificados não confiáveis, somente para servidores de teste
+	Insecure bool
+}
+
+// SMTPHOST, SMTPPORT (25), SMTPUSER, SMTPPASSWORD, SMTPFROM, SMTPTLS e SMTPINSECURE
+func NewQPSMTPMailerFromEnv() *QPSMTPMailer {
+	mailer := &QPSMTPMailer{
+		Port: getenvInt("SMTPPORT", 25),
+	}
+	mailer.Host, _ = getenvStr("SMTPHOST")
+	mailer.Username, _ = getenvStr("SMTPUSER")
+	mailer.Password, _ = getenvStr("SMTPPASSWORD")
+	mailer.From, _ = getenvStr("SMTPFROM")
+	mailer.TLS, _ = GetEnvBool("SMTPTLS", false)
+	mailer.Insecure, _ = GetEnvBool("SMTPINSECURE", false)
+
+	if len(mailer.From) == 0 {
+		mailer.From = "quepasa@" + mailer.Host
+	}
+	return mailer
+}
+
+func (mailer *QPSMTPMailer) Send(to string, subject string, body string) (err error) {
+	if len(mailer.Host) == 0 {
+		return ErrMailerNotConfigured
+	}
+
+	address := net.JoinHostPort(mailer.Host, strconv.Itoa(mailer.Port))
+	config := &tls.Config{ServerName: mailer.Host, InsecureSkipVerify: mailer.Insecure}
+
+	var conn net.Conn
+	if mailer.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", address, config)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, 30*time.Second)
+	}
+	if err != nil {
+		return
+	}
+
+	client, err := smtp.NewClient(conn, mailer.Host)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !mailer.TLS {
+		if err = client.StartTLS(config); err != nil {
+			return
+		}
+	}
+
+	if len(mailer.Username) > 0 {
+		if err = client.Auth(smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)); err != nil {
+			return
+		}
+	}
+
+	if err = client.Mail(mailer.From); err != nil {
+		return
+	}
+
+	if err = client.Rcpt(to); err != nil {
+		return
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return
+	}
+
+	if _, err = writer.Write(mailer.message(to, subject, body)); err != nil {
+		writer.Close()
+		return
+	}
+
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	Log.WithComponent("mailer").Infof("mail '%s' sent to %s", subject, to)
+	return client.Quit()
+}
+
+// Mensagem em texto puro, com as quebras de linha CRLF exigidas pelo protocolo
+func (mailer *QPSMTPMailer) message(to string, subject string, body string) []byte {
+	headers := []string{
+		"From: " + mailer.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+	return []byte(fmt.Sprintf("%s\r\n\r\n%s\r\n", strings.Join(headers, "\r\n"), body))
+}
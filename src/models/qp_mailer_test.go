@@ -0,0 +1,96 @@
+package models
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Servidor SMTP mínimo, registra a conversa e a mensagem recebida
+func startTestSMTPServer(t *testing.T) (port int, received chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received = make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP test")
+
+		var transcript strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			command := strings.ToUpper(strings.TrimSpace(line))
+			transcript.WriteString(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 end with <CRLF>.<CRLF>")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	port, received := startTestSMTPServer(t)
+	t.Setenv("SMTPHOST", "127.0.0.1")
+	t.Setenv("SMTPPORT", strconv.Itoa(port))
+	t.Setenv("SMTPFROM", "quepasa@example.com")
+
+	mailer := NewQPSMTPMailerFromEnv()
+	if err := mailer.Send("user@example.com", "Hello", "first line\nsecond line"); err != nil {
+		t.Fatalf("error sending: %s", err)
+	}
+
+	transcript := <-received
+	for _, expected := range []string{
+		"MAIL FROM:<quepasa@example.com>",
+		"RCPT TO:<user@example.com>",
+		"Subject: Hello\r\n",
+		"To: user@example.com\r\n",
+		"first line\r\nsecond line\r\n",
+	} {
+		if !strings.Contains(transcript, expected) {
+			t.Errorf("expected %q in the transcript:\n%s", expected, transcript)
+		}
+	}
+}
+
+func TestSMTPMailerNotConfigured(t *testing.T) {
+	t.Setenv("SMTPHOST", "")
+	if err := NewQPSMTPMailerFromEnv().Send("user@example.com", "Hello", "body"); err != ErrMailerNotConfigured {
+		t.Errorf("expected not configured error, got %v", err)
+	}
+}
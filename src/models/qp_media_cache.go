@@ -0,0 +1,178 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache em disco dos anexos já baixados do whatsapp
+// Os arquivos são endereçados pelo sha256 do conteúdo, evitando duplicidade
+type QPMediaCache struct {
+	Path    string
+	MaxSize int64 // Tamanho máximo em bytes antes de começar a remover os arquivos mais antigos
+
+	size  int64             // Tamanho atual ocupado em disco
+	index map[string]string // Id da mensagem => hash do conteúdo
+	sync  *sync.Mutex       // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+var (
+	mediaCacheSync sync.Once
+	mediaCache     *QPMediaCache
+)
+
+// Instancia única do cache, configurada pelas variáveis de ambiente MEDIACACHEPATH e MEDIACACHEMAXSIZE (MB)
+func GetMediaCache() *QPMediaCache {
+	mediaCacheSync.Do(func() {
+		path, err := getenvStr("MEDIACACHEPATH")
+		if err != nil {
+			path = filepath.Join(os.TempDir(), "quepasa-media")
+		}
+
+		maxSize := int64(512)
+		if s, err := getenvStr("MEDIACACHEMAXSIZE"); err == nil {
+			if parsed, err := strconv.ParseInt(s, 10, 64); err == nil {
+				maxSize = parsed
+			}
+		}
+
+		mediaCache = &QPMediaCache{
+			Path:    path,
+			MaxSize: maxSize * 1024 * 1024,
+			index:   make(map[string]string),
+			sync:    &sync.Mutex{},
+		}
+
+		if err := os.MkdirAll(path, 0700); err != nil {
+			Log.WithComponent("mediacache").WithError(err).Errorf("media cache unavailable at %s", path)
+		}
+		mediaCache.size = mediaCache.usage()
+	})
+	return mediaCache
+}
+
+// Caminho completo do arquivo apartir do hash
+func (cache *QPMediaCache) filename(hash string) string {
+	return filepath.Join(cache.Path, hash[:2], hash)
+}
+
+// Abre o arquivo em cache da mensagem, se houver
+// Aberto sob o mesmo sinaleiro da remoção, o arquivo continua legível mesmo que removido em seguida
+func (cache *QPMediaCache) Open(messageID string) (file *os.File, hash string, ok bool) {
+	cache.sync.Lock()
+	defer cache.sync.Unlock()
+
+	hash, ok = cache.index[messageID]
+	if !ok {
+		return
+	}
+
+	filename := cache.filename(hash)
+	file, err := os.Open(filename)
+	if err != nil {
+		delete(cache.index, messageID)
+		ok = false
+		return
+	}
+
+	// Atualiza a data de acesso, usada na remoção dos mais antigos
+	now := time.Now()
+	os.Chtimes(filename, now, now)
+	return
+}
+
+// Salva o conteúdo no cache e associa a mensagem
+func (cache *QPMediaCache) Put(messageID string, data []byte) (filename string, hash string, err error) {
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	filename = cache.filename(hash)
+
+	cache.sync.Lock()
+	defer cache.sync.Unlock()
+
+	if _, err = os.Stat(filename); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			return
+		}
+
+		// Escreve em arquivo temporário para nunca servir um arquivo pela metade
+		temp := filename + ".tmp"
+		if err = ioutil.WriteFile(temp, data, 0600); err != nil {
+			return
+		}
+		if err = os.Rename(temp, filename); err != nil {
+			return
+		}
+		cache.size += int64(len(data))
+	} else if err != nil {
+		return
+	}
+
+	cache.index[messageID] = hash
+
+	if cache.MaxSize > 0 && cache.size > cache.MaxSize {
+		cache.evict(hash)
+	}
+	return
+}
+
+type mediaCacheFile struct {
+	path    string
+	hash    string
+	size    int64
+	modTime time.Time
+}
+
+func (cache *QPMediaCache) files() (files []mediaCacheFile) {
+	filepath.Walk(cache.Path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, mediaCacheFile{path, info.Name(), info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	return
+}
+
+func (cache *QPMediaCache) usage() (size int64) {
+	for _, file := range cache.files() {
+		size += file.size
+	}
+	return
+}
+
+// Remove os arquivos acessados há mais tempo até caber no tamanho máximo
+// O arquivo recém incluído (keep) nunca é removido
+func (cache *QPMediaCache) evict(keep string) {
+	files := cache.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	removed := make(map[string]bool)
+	for _, file := range files {
+		if cache.size <= cache.MaxSize {
+			break
+		}
+
+		if file.hash == keep {
+			continue
+		}
+
+		if err := os.Remove(file.path); err != nil {
+			continue
+		}
+		cache.size -= file.size
+		removed[file.hash] = true
+	}
+
+	for messageID, hash := range cache.index {
+		if removed[hash] {
+			delete(cache.index, messageID)
+		}
+	}
+}
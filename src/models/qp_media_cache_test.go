@@ -0,0 +1,125 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMediaCache(t *testing.T, maxSize int64) *QPMediaCache {
+	path, err := ioutil.TempDir("", "quepasa-media-test")
+	if err != nil {
+		t.Fatalf("error creating cache dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(path) })
+
+	return &QPMediaCache{Path: path, MaxSize: maxSize, index: make(map[string]string), sync: &sync.Mutex{}}
+}
+
+// Lê e fecha o arquivo em cache da mensagem
+func readTestMediaCache(t *testing.T, cache *QPMediaCache, messageID string) (string, bool) {
+	file, _, ok := cache.Open(messageID)
+	if !ok {
+		return "", false
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", messageID, err)
+	}
+	return string(data), true
+}
+
+func TestMediaCacheDeduplicatesByContent(t *testing.T) {
+	cache := newTestMediaCache(t, 0)
+
+	_, hash, err := cache.Put("MSG1", []byte("conteúdo"))
+	if err != nil {
+		t.Fatalf("error putting: %s", err)
+	}
+
+	sum := sha256.Sum256([]byte("conteúdo"))
+	if hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the content hash, got %s", hash)
+	}
+
+	cache.Put("MSG2", []byte("conteúdo"))
+	if cache.size != int64(len("conteúdo")) {
+		t.Errorf("expected the content stored once, size %d", cache.size)
+	}
+
+	for _, messageID := range []string{"MSG1", "MSG2"} {
+		if data, ok := readTestMediaCache(t, cache, messageID); !ok || data != "conteúdo" {
+			t.Errorf("unexpected %s: %q, %v", messageID, data, ok)
+		}
+	}
+
+	if _, _, ok := cache.Open("MSG3"); ok {
+		t.Errorf("unexpected cached message")
+	}
+}
+
+func TestMediaCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newTestMediaCache(t, 10)
+
+	filename, _, _ := cache.Put("OLD", []byte("123456"))
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filename, past, past)
+
+	cache.Put("NEW", []byte("abcdef"))
+
+	if _, ok := readTestMediaCache(t, cache, "OLD"); ok {
+		t.Errorf("expected the least recently used file evicted")
+	}
+
+	if data, ok := readTestMediaCache(t, cache, "NEW"); !ok || data != "abcdef" {
+		t.Errorf("expected the new file kept, got %q, %v", data, ok)
+	}
+
+	if cache.size != 6 {
+		t.Errorf("unexpected size after eviction: %d", cache.size)
+	}
+}
+
+// Um download em andamento não é interrompido pela remoção do arquivo
+func TestMediaCacheOpenFileSurvivesEviction(t *testing.T) {
+	cache := newTestMediaCache(t, 10)
+	cache.Put("OLD", []byte("123456"))
+
+	file, _, ok := cache.Open("OLD")
+	if !ok {
+		t.Fatalf("expected the cached file")
+	}
+	defer file.Close()
+
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(file.Name(), past, past)
+	cache.Put("NEW", []byte("abcdef"))
+
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Fatalf("expected the file evicted, got %v", err)
+	}
+
+	if data, err := ioutil.ReadAll(file); err != nil || string(data) != "123456" {
+		t.Errorf("expected the open file still readable, got %q, %v", data, err)
+	}
+}
+
+func TestMediaCacheForgetsRemovedFiles(t *testing.T) {
+	cache := newTestMediaCache(t, 0)
+	filename, _, _ := cache.Put("MSG1", []byte("conteúdo"))
+	os.Remove(filename)
+
+	if _, _, ok := cache.Open("MSG1"); ok {
+		t.Errorf("expected a miss for a removed file")
+	}
+
+	if _, ok := cache.index["MSG1"]; ok {
+		t.Errorf("expected the removed file forgotten")
+	}
+}
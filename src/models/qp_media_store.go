@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Armazenamento permanente dos anexos recebidos (arquivamento)
+// Habilitado por bot, os anexos são baixados assim que a mensagem chega
+type IQPMediaStore interface {
+	// Salva o conteúdo e retorna a url estável para acesso posterior
+	Put(key string, mime string, data []byte) (url string, err error)
+	Get(key string) ([]byte, error)
+	Exists(key string) (bool, error)
+}
+
+var (
+	mediaStoreSync sync.Once
+	mediaStore     IQPMediaStore
+)
+
+// Instancia única do armazenamento, definida pela variável de ambiente MEDIASTORE
+// Retorna nulo caso nenhum armazenamento esteja configurado
+func GetMediaStore() IQPMediaStore {
+	mediaStoreSync.Do(func() {
+		kind, _ := getenvStr("MEDIASTORE")
+		switch kind {
+		case "":
+			return
+		case "filesystem":
+			path, err := getenvStr("MEDIASTOREPATH")
+			if err != nil {
+				path = "media"
+			}
+			publicUrl, _ := getenvStr("MEDIASTOREURL")
+			mediaStore = QPMediaStoreFileSystem{path, strings.TrimRight(publicUrl, "/")}
+		case "s3":
+			store := QPMediaStoreS3{
+				Endpoint:  os.Getenv("S3ENDPOINT"),
+				Region:    os.Getenv("S3REGION"),
+				Bucket:    os.Getenv("S3BUCKET"),
+				AccessKey: os.Getenv("S3ACCESSKEY"),
+				SecretKey: os.Getenv("S3SECRETKEY"),
+			}
+			store.UseSSL, _ = GetEnvBool("S3SSL", true)
+			if len(store.Region) == 0 {
+				store.Region = "us-east-1"
+			}
+			mediaStore = store
+		default:
+			Log.WithComponent("mediastore").Errorf("media store not supported: %s", kind)
+		}
+	})
+	return mediaStore
+}
+
+// Chave usada para guardar o anexo de uma mensagem
+// número do bot / id da mensagem + extensão do arquivo original
+func GetMediaStoreKey(bot QPBot, messageID string, attachment QPAttachment) string {
+	phone, _ := GetPhoneByID(bot.ID)
+	return fmt.Sprintf("%s/%s%s", phone, messageID, filepath.Ext(attachment.FileName))
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Armazena os anexos em uma pasta local
+type QPMediaStoreFileSystem struct {
+	Path string
+
+	// Url pública (opcional) que serve o conteúdo da pasta, ex: através do nginx
+	PublicUrl string
+}
+
+func (store QPMediaStoreFileSystem) filename(key string) string {
+	return filepath.Join(store.Path, filepath.FromSlash(key))
+}
+
+func (store QPMediaStoreFileSystem) Put(key string, mime string, data []byte) (url string, err error) {
+	filename := store.filename(key)
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return
+	}
+
+	if err = ioutil.WriteFile(filename, data, 0600); err != nil {
+		return
+	}
+
+	if len(store.PublicUrl) > 0 {
+		return store.PublicUrl + "/" + key, nil
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	return "file://" + filepath.ToSlash(abs), nil
+}
+
+func (store QPMediaStoreFileSystem) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(store.filename(key))
+}
+
+func (store QPMediaStoreFileSystem) Exists(key string) (bool, error) {
+	_, err := os.Stat(store.filename(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Armazena os anexos em um bucket compatível com S3 (AWS, MinIO, etc)
+// Usa endereçamento por caminho (endpoint/bucket/key), suportado também pelo MinIO local
+type QPMediaStoreS3 struct {
+	Endpoint  string // Ex: s3.amazonaws.com ou localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+func (store QPMediaStoreS3) url(key string) string {
+	scheme := "http"
+	if store.UseSSL {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, store.Endpoint, store.path(key))
+}
+
+func (store QPMediaStoreS3) path(key string) string {
+	return "/" + s3Encode(store.Bucket, false) + "/" + s3Encode(key, true)
+}
+
+func (store QPMediaStoreS3) Put(key string, mime string, data []byte) (url string, err error) {
+	url = store.url(key)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	if len(mime) > 0 {
+		req.Header.Set("Content-Type", mime)
+	}
+
+	resp, err := store.do(req, data)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+func (store QPMediaStoreS3) Get(key string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, store.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := store.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (store QPMediaStoreS3) Exists(key string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, store.url(key), nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := store.do(req, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// Assina e executa a requisição, retornando erro para qualquer status fora da faixa 2xx
+func (store QPMediaStoreS3) do(req *http.Request, payload []byte) (*http.Response, error) {
+	store.sign(req, payload, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, fmt.Errorf("s3 %s %s: %s :: %s", req.Method, req.URL.Path, resp.Status, string(body))
+	}
+	return resp, nil
+}
+
+// Assinatura AWS Signature Version 4
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (store QPMediaStoreS3) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var names []string
+	headers := make(map[string]string)
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "host" || lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + store.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+store.SecretKey), date)
+	key = hmacSHA256(key, store.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		store.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Codificação de url exigida pela assinatura, somente caracteres não reservados passam
+func s3Encode(value string, keepSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (keepSlash && b == '/') {
+			result.WriteByte(b)
+		} else {
+			result.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Métricas por bot, rotuladas pelo número, expostas no /metrics
+
+var botMessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_bot_sent_messages_total",
+	Help: "Sent messages by bot and type",
+}, []string{"bot", "type"})
+
+var botMessageSendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_bot_send_message_errors_total",
+	Help: "Message send errors by bot and type",
+}, []string{"bot", "type"})
+
+var botMessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_bot_received_messages_total",
+	Help: "Received messages by bot and type",
+}, []string{"bot", "type"})
+
+var botSendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "quepasa_bot_send_duration_seconds",
+	Help:    "Time to send a message to whatsapp",
+	Buckets: prometheus.DefBuckets,
+}, []string{"bot", "type"})
+
+var botConnectionState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "quepasa_bot_connection_state",
+	Help: "Current connection state, 1 for the active state",
+}, []string{"bot", "state"})
+
+var botBatteryPercentage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "quepasa_bot_battery_percentage",
+	Help: "Phone battery percentage",
+}, []string{"bot"})
+
+var botBatteryPlugged = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "quepasa_bot_battery_plugged",
+	Help: "Phone charging, 1 when plugged",
+}, []string{"bot"})
+
+var botWebHookDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "quepasa_bot_webhook_duration_seconds",
+	Help:    "Webhook delivery time by bot, kind (message, event, lifecycle) and response status code",
+	Buckets: prometheus.DefBuckets,
+}, []string{"bot", "kind", "code"})
+
+var botReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_bot_reconnects_total",
+	Help: "Reconnections by bot and cause",
+}, []string{"bot", "cause"})
+
+// Rótulo do bot, número sem o +
+func metricsBotLabel(bot QPBot) string {
+	return strings.TrimLeft(bot.GetNumber(), "+")
+}
+
+// Tipo da mensagem enviada, usado como rótulo
+func metricsMessageType(msg interface{}) string {
+	switch msg.(type) {
+	case whatsapp.TextMessage:
+		return "text"
+	case whatsapp.ImageMessage:
+		return "image"
+	case whatsapp.AudioMessage:
+		return "audio"
+	case whatsapp.VideoMessage:
+		return "video"
+	case whatsapp.DocumentMessage:
+		return "document"
+	default:
+		return "unknown"
+	}
+}
+
+func observeMessageSent(bot QPBot, msgType string, started time.Time, err error) {
+	label := metricsBotLabel(bot)
+	botSendDuration.WithLabelValues(label, msgType).Observe(time.Since(started).Seconds())
+	if err != nil {
+		botMessageSendErrors.WithLabelValues(label, msgType).Inc()
+	} else {
+		botMessagesSent.WithLabelValues(label, msgType).Inc()
+	}
+}
+
+func observeMessageReceived(bot QPBot, msgType string) {
+	botMessagesReceived.WithLabelValues(metricsBotLabel(bot), msgType).Inc()
+}
+
+func observeConnectionState(bot QPBot, transition QPConnectionStateTransition) {
+	label := metricsBotLabel(bot)
+	botConnectionState.WithLabelValues(label, transition.From.String()).Set(0)
+	botConnectionState.WithLabelValues(label, transition.To.String()).Set(1)
+}
+
+func observeBattery(bot QPBot, battery WhatsAppBateryStatus) {
+	label := metricsBotLabel(bot)
+	botBatteryPercentage.WithLabelValues(label).Set(float64(battery.Percentage))
+	if battery.Plugged {
+		botBatteryPlugged.WithLabelValues(label).Set(1)
+	} else {
+		botBatteryPlugged.WithLabelValues(label).Set(0)
+	}
+}
+
+func observeReconnect(bot QPBot, cause string) {
+	botReconnects.WithLabelValues(metricsBotLabel(bot), cause).Inc()
+}
+
+// Envia o json ao WebHook, registrando o tempo e o código da resposta
+func postWebHook(bot QPBot, kind string, url string, payload []byte) (*http.Response, error) {
+	started := time.Now()
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	botWebHookDuration.WithLabelValues(metricsBotLabel(bot), kind, code).Observe(time.Since(started).Seconds())
+	return resp, err
+}
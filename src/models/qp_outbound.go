@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"sync"
+)
+
+// Trabalhos de saída em andamento (webhooks e arquivamento), aguardados ao desligar
+var outbound sync.WaitGroup
+
+// Fechado ao desligar, novos trabalhos não são aceitos enquanto os anteriores são aguardados
+// Add simultâneo ao Wait do WaitGroup não é permitido
+var outboundClosed bool
+var outboundSync = &sync.Mutex{}
+
+// Executa de forma assíncrona, registrando para que o desligamento aguarde o término
+// Após o início da espera do desligamento o trabalho é descartado
+func RunOutbound(work func()) {
+	outboundSync.Lock()
+	if outboundClosed {
+		outboundSync.Unlock()
+		Log.WithComponent("service").Warnf("outbound work dropped, shutting down")
+		return
+	}
+	outbound.Add(1)
+	outboundSync.Unlock()
+
+	go func() {
+		defer outbound.Done()
+		work()
+	}()
+}
+
+// Aguarda os trabalhos de saída terminarem ou o prazo expirar
+func WaitOutbound(ctx context.Context) error {
+	outboundSync.Lock()
+	outboundClosed = true
+	outboundSync.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		outbound.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Reabre os trabalhos de saída, fechados pelo desligamento simulado no teste
+func reopenOutbound(t *testing.T) {
+	t.Cleanup(func() {
+		outboundSync.Lock()
+		outboundClosed = false
+		outboundSync.Unlock()
+	})
+}
+
+func TestWaitOutboundDropsLateWork(t *testing.T) {
+	reopenOutbound(t)
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	RunOutbound(func() {
+		<-release
+		close(finished)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitOutbound(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline while work is pending, got %v", err)
+	}
+
+	// Servidores ainda em execução após o prazo não registram novos trabalhos
+	ran := make(chan struct{})
+	RunOutbound(func() { close(ran) })
+
+	close(release)
+	<-finished
+	if err := WaitOutbound(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	select {
+	case <-ran:
+		t.Errorf("expected work after the shutdown started to be dropped")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
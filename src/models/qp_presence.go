@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Presença de um contato no formato QuePasa
+// Utilizada na API do QuePasa para troca com outros sistemas
+type QPPresence struct {
+	// Contato que teve a presença alterada
+	ID    string `json:"id"`
+	Phone string `json:"phone,omitempty"`
+
+	// available, unavailable, composing, recording, paused
+	Type string `json:"type"`
+
+	// Visto por último, somente quando o whatsapp informar
+	LastSeen int64 `json:"lastseen,omitempty"`
+
+	// Momento em que recebemos a atualização
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Tenta interpretar uma msg json do whatsapp como atualização de presença
+func ParsePresenceMessage(msgString string) (presence QPPresence, ok bool) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal([]byte(msgString), &parts); err != nil || len(parts) < 2 {
+		return
+	}
+
+	var kind string
+	if err := json.Unmarshal(parts[0], &kind); err != nil || kind != "Presence" {
+		return
+	}
+
+	var waPresence WhatsAppPresenceMessage
+	if err := json.Unmarshal(parts[1], &waPresence); err != nil || len(waPresence.ID) == 0 {
+		return
+	}
+
+	// O whatsapp usa @c.us para presenças e @s.whatsapp.net para mensagens
+	// Padronizamos para o mesmo formato usado no ReplyTo das mensagens
+	presence.ID = strings.Replace(waPresence.ID, "@c.us", "@s.whatsapp.net", 1)
+	presence.Phone = getPhone(presence.ID)
+	presence.Type = waPresence.Type
+	presence.Timestamp = time.Now().Unix()
+	if waPresence.Type == "unavailable" {
+		presence.LastSeen = waPresence.Timestamp
+	}
+
+	ok = true
+	return
+}
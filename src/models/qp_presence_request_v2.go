@@ -0,0 +1,7 @@
+package models
+
+// Requisição no formato QuePasa
+// Utilizada na API do QuePasa para assinar a presença de um contato
+type QPPresenceRequestV2 struct {
+	Recipient string `json:"recipient"`
+}
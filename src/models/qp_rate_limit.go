@@ -0,0 +1,172 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Grupos de rotas da API limitados separadamente para cada bot
+const (
+	RateLimitSend       = "send"
+	RateLimitReceive    = "receive"
+	RateLimitAttachment = "attachment"
+)
+
+// Limites padrões, em requisições por minuto, zero desabilita
+const (
+	defaultRateLimitSend       = 60
+	defaultRateLimitReceive    = 120
+	defaultRateLimitAttachment = 60
+	defaultRateLimitIP         = 600
+)
+
+// Baldes sem uso há mais tempo que isso estão cheios e podem ser descartados
+const rateLimitIdle = 10 * time.Minute
+
+var apiRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "quepasa_api_rate_limited_total",
+	Help: "API requests rejected by rate limits, by limit (send, receive, attachment, ip)",
+}, []string{"limit"})
+
+// Limitadores globais da API, por bot e grupo de rotas e por endereço de origem
+var (
+	BotRateLimiter = NewQPRateLimiter()
+	IPRateLimiter  = NewQPRateLimiter()
+)
+
+// Balde de fichas, capacidade igual ao limite por período e reposição contínua
+type qpTokenBucket struct {
+	limit  int
+	period time.Duration
+	tokens float64
+	last   time.Time
+}
+
+// Sem uso há mais tempo que rateLimitIdle e que o período o balde já estaria cheio
+func (bucket *qpTokenBucket) Idle(now time.Time) bool {
+	return now.Sub(bucket.last) > rateLimitIdle && now.Sub(bucket.last) > bucket.period
+}
+
+// Limitador de requisições por chave, usando baldes de fichas (token bucket)
+type QPRateLimiter struct {
+	qpKeyedStore
+}
+
+func NewQPRateLimiter() *QPRateLimiter {
+	return &QPRateLimiter{newQPKeyedStore()}
+}
+
+// Consome uma ficha da chave, limite em requisições por minuto
+// Caso não haja fichas retorna o tempo até a próxima reposição
+func (limiter *QPRateLimiter) Allow(key string, limit int) (bool, time.Duration) {
+	return limiter.AllowPer(key, limit, time.Minute)
+}
+
+// Consome uma ficha da chave, limite em requisições pelo período informado
+func (limiter *QPRateLimiter) AllowPer(key string, limit int, period time.Duration) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+
+	allowed, wait := true, time.Duration(0)
+	limiter.update(func(entries map[string]qpKeyedEntry, now time.Time) {
+		bucket, ok := entries[key].(*qpTokenBucket)
+		if !ok || bucket.limit != limit || bucket.period != period {
+			// Limite alterado, recomeça com o balde cheio
+			bucket = &qpTokenBucket{limit: limit, period: period, tokens: float64(limit), last: now}
+			entries[key] = bucket
+		}
+
+		rate := float64(limit) / period.Seconds()
+		bucket.tokens = math.Min(float64(limit), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+		bucket.last = now
+
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+			return
+		}
+
+		allowed, wait = false, time.Duration((1-bucket.tokens)/rate*float64(time.Second))
+	})
+	return allowed, wait
+}
+
+// Limite por minuto do grupo de rotas para o bot, o valor do bot tem prioridade sobre o global
+func (bot *QPBot) GetRateLimit(group string) int {
+	var limit int
+	switch group {
+	case RateLimitSend:
+		limit = bot.RateLimitSend
+	case RateLimitReceive:
+		limit = bot.RateLimitReceive
+	case RateLimitAttachment:
+		limit = bot.RateLimitAttachment
+	}
+
+	if limit != 0 {
+		return limit
+	}
+	return GetDefaultRateLimit(group)
+}
+
+// Limites globais por minuto (RATELIMITSEND, RATELIMITRECEIVE, RATELIMITATTACHMENT, RATELIMITIP)
+func GetDefaultRateLimit(group string) int {
+	switch group {
+	case RateLimitSend:
+		return getenvInt("RATELIMITSEND", defaultRateLimitSend)
+	case RateLimitReceive:
+		return getenvInt("RATELIMITRECEIVE", defaultRateLimitReceive)
+	case RateLimitAttachment:
+		return getenvInt("RATELIMITATTACHMENT", defaultRateLimitAttachment)
+	default:
+		return getenvInt("RATELIMITIP", defaultRateLimitIP)
+	}
+}
+
+// Consome uma ficha do bot no grupo de rotas
+func (bot *QPBot) AllowRequest(group string) (bool, time.Duration) {
+	allowed, wait := BotRateLimiter.Allow(bot.ID+"|"+group, bot.GetRateLimit(group))
+	if !allowed {
+		apiRateLimited.WithLabelValues(group).Inc()
+	}
+	return allowed, wait
+}
+
+// Consome uma ficha do endereço de origem, comum a todas as rotas da API
+func AllowAddress(address string) (bool, time.Duration) {
+	allowed, wait := IPRateLimiter.Allow(address, GetDefaultRateLimit("ip"))
+	if !allowed {
+		apiRateLimited.WithLabelValues("ip").Inc()
+	}
+	return allowed, wait
+}
+
+// Atualiza os limites do bot, zero utiliza o padrão global e negativo desabilita
+func (bot *QPBot) SetRateLimits(send int, receive int, attachment int) (err error) {
+	err = WhatsAppService.DB.Bot.RateLimits(bot.ID, send, receive, attachment)
+	if err == nil {
+		bot.RateLimitSend = send
+		bot.RateLimitReceive = receive
+		bot.RateLimitAttachment = attachment
+		bot.GetLogger().Infof("rate limits updated, send: %d, receive: %d, attachment: %d", send, receive, attachment)
+	}
+	return
+}
+
+// Erro das requisições recusadas pelo limite
+func RateLimitError(limit string, wait time.Duration) error {
+	return fmt.Errorf("rate limit exceeded (%s), retry in %d seconds", limit, RetryAfterSeconds(wait))
+}
+
+// Segundos inteiros para o header Retry-After, no mínimo um
+func RetryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
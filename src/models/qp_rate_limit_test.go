@@ -0,0 +1,83 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestRateLimiter() (*QPRateLimiter, *time.Time) {
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewQPRateLimiter()
+	limiter.Now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiterBucket(t *testing.T) {
+	limiter, now := newTestRateLimiter()
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("bot|send", 3); !allowed {
+			t.Fatalf("request %d should be allowed by the full bucket", i)
+		}
+	}
+
+	allowed, wait := limiter.Allow("bot|send", 3)
+	if allowed || wait != 20*time.Second {
+		t.Fatalf("expected to wait 20s for the next token, got %v, %s", allowed, wait)
+	}
+
+	// Outras chaves têm seus próprios baldes
+	if allowed, _ := limiter.Allow("other|send", 3); !allowed {
+		t.Errorf("expected an independent bucket for another key")
+	}
+
+	*now = now.Add(20 * time.Second)
+	if allowed, _ := limiter.Allow("bot|send", 3); !allowed {
+		t.Errorf("expected a token refilled after 20s")
+	}
+
+	if allowed, _ := limiter.Allow("bot|send", 3); allowed {
+		t.Errorf("expected the refilled token to be consumed")
+	}
+
+	// Um novo limite recomeça com o balde cheio
+	if allowed, _ := limiter.Allow("bot|send", 10); !allowed {
+		t.Errorf("expected a fresh bucket after changing the limit")
+	}
+
+	if allowed, _ := limiter.Allow("bot|send", 0); !allowed {
+		t.Errorf("a zero limit should disable the limiter")
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	limiter, now := newTestRateLimiter()
+	limiter.Allow("idle", 5)
+
+	*now = now.Add(rateLimitIdle + time.Minute)
+	limiter.Allow("active", 5)
+
+	if _, ok := limiter.entries["idle"]; ok {
+		t.Errorf("idle bucket not removed")
+	}
+}
+
+func TestBotRateLimitOverridesDefault(t *testing.T) {
+	bot := QPBot{RateLimitSend: 5, RateLimitReceive: -1}
+
+	if limit := bot.GetRateLimit(RateLimitSend); limit != 5 {
+		t.Errorf("expected the bot limit, got %d", limit)
+	}
+
+	if limit := bot.GetRateLimit(RateLimitReceive); limit != -1 {
+		t.Errorf("expected the limit disabled for the bot, got %d", limit)
+	}
+
+	if limit := bot.GetRateLimit(RateLimitAttachment); limit != defaultRateLimitAttachment {
+		t.Errorf("expected the default limit, got %d", limit)
+	}
+
+	if seconds := RetryAfterSeconds(1500 * time.Millisecond); seconds != 2 {
+		t.Errorf("expected retry after rounded up, got %d", seconds)
+	}
+}
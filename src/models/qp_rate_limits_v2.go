@@ -0,0 +1,8 @@
+package models
+
+// Limites de requisições por minuto do bot, zero utiliza o padrão global e negativo desabilita
+type QPRateLimitsV2 struct {
+	Send       int `json:"send"`
+	Receive    int `json:"receive"`
+	Attachment int `json:"attachment"`
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Política de reconexão compartilhada por todos os servidores
+// Configurada pelas variáveis de ambiente RECONNECTMINDELAY, RECONNECTMAXDELAY (segundos),
+// RECONNECTCONCURRENCY e RECONNECTMAXFAILURES
+type QPReconnectPolicy struct {
+	MinDelay    time.Duration // Espera após a primeira falha
+	MaxDelay    time.Duration // Limite da espera, por mais falhas que ocorram
+	MaxFailures int           // Falhas seguidas antes de suspender o bot, 0 desativa
+	slots       chan struct{} // Limita as reconexões simultâneas entre todos os bots
+}
+
+var reconnectPolicy *QPReconnectPolicy
+var reconnectPolicySync sync.Once
+
+func GetReconnectPolicy() *QPReconnectPolicy {
+	reconnectPolicySync.Do(func() {
+		concurrency := getenvInt("RECONNECTCONCURRENCY", 4)
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		reconnectPolicy = &QPReconnectPolicy{
+			MinDelay:    time.Duration(getenvInt("RECONNECTMINDELAY", 5)) * time.Second,
+			MaxDelay:    time.Duration(getenvInt("RECONNECTMAXDELAY", 300)) * time.Second,
+			MaxFailures: getenvInt("RECONNECTMAXFAILURES", 10),
+			slots:       make(chan struct{}, concurrency),
+		}
+
+		// Garantindo que cada instância sorteie intervalos diferentes
+		rand.Seed(time.Now().UnixNano())
+	})
+	return reconnectPolicy
+}
+
+// Tempo de espera antes da próxima tentativa, dobrando a cada falha
+// Metade do intervalo é aleatória para que os bots não reconectem todos ao mesmo tempo
+func (policy *QPReconnectPolicy) Delay(failures int) time.Duration {
+	delay := policy.MinDelay
+	for i := 1; i < failures && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// Aguarda uma vaga para reconectar
+func (policy *QPReconnectPolicy) Acquire() {
+	policy.slots <- struct{}{}
+}
+
+func (policy *QPReconnectPolicy) Release() {
+	<-policy.slots
+}
+
+// Disjuntor individual de cada bot, conta as falhas seguidas ao iniciar
+type QPCircuitBreaker struct {
+	failures int
+	sync     *sync.Mutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+func NewQPCircuitBreaker() *QPCircuitBreaker {
+	return &QPCircuitBreaker{sync: &sync.Mutex{}}
+}
+
+// Registra uma falha e retorna a quantidade de falhas seguidas
+func (breaker *QPCircuitBreaker) Failure() int {
+	breaker.sync.Lock()
+	defer breaker.sync.Unlock()
+	breaker.failures++
+	return breaker.failures
+}
+
+func (breaker *QPCircuitBreaker) Reset() {
+	breaker.sync.Lock()
+	breaker.failures = 0
+	breaker.sync.Unlock()
+}
+
+func (breaker *QPCircuitBreaker) Failures() int {
+	breaker.sync.Lock()
+	defer breaker.sync.Unlock()
+	return breaker.failures
+}
+
+// Laço de reconexão de um servidor, somente um em execução por vez
+// Novos pedidos de inicialização apenas acordam o laço que já executa
+type QPReconnectLoop struct {
+	running bool
+	wakeup  chan struct{} // Pedido pendente, acorda a espera entre as tentativas
+	sync    *sync.Mutex   // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+func NewQPReconnectLoop() *QPReconnectLoop {
+	return &QPReconnectLoop{wakeup: make(chan struct{}, 1), sync: &sync.Mutex{}}
+}
+
+// Assume o laço, retorna falso e acorda o existente caso já esteja em execução
+func (loop *QPReconnectLoop) Enter() bool {
+	loop.sync.Lock()
+	defer loop.sync.Unlock()
+
+	if loop.running {
+		select {
+		case loop.wakeup <- struct{}{}:
+		default:
+		}
+		return false
+	}
+
+	select {
+	case <-loop.wakeup:
+	default:
+	}
+	loop.running = true
+	return true
+}
+
+// Libera o laço, retorna falso caso tenha sido acordado e deva continuar
+func (loop *QPReconnectLoop) Leave() bool {
+	loop.sync.Lock()
+	defer loop.sync.Unlock()
+
+	select {
+	case <-loop.wakeup:
+		return false
+	default:
+	}
+	loop.running = false
+	return true
+}
+
+// Aguarda o intervalo, interrompido por um novo pedido de inicialização
+func (loop *QPReconnectLoop) Sleep(delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-loop.wakeup:
+	}
+}
+
+func (loop *QPReconnectLoop) Running() bool {
+	loop.sync.Lock()
+	defer loop.sync.Unlock()
+	return loop.running
+}
+
+func getenvInt(key string, fallback int) int {
+	if s, err := getenvStr(key); err == nil {
+		if parsed, err := strconv.Atoi(s); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
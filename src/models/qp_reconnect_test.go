@@ -0,0 +1,225 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconnectDelayBackoff(t *testing.T) {
+	policy := &QPReconnectPolicy{MinDelay: 4 * time.Second, MaxDelay: time.Minute}
+
+	// Dobra a cada falha até o limite, metade do intervalo é aleatória
+	expected := []time.Duration{4 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+	for failures, base := range expected {
+		for i := 0; i < 100; i++ {
+			delay := policy.Delay(failures)
+			if delay < base/2 || delay > base {
+				t.Fatalf("delay for %d failures out of [%s, %s]: %s", failures, base/2, base, delay)
+			}
+		}
+	}
+
+	if delay := policy.Delay(1000); delay > policy.MaxDelay {
+		t.Errorf("delay above the cap: %s", delay)
+	}
+}
+
+func TestReconnectDelayJitter(t *testing.T) {
+	policy := &QPReconnectPolicy{MinDelay: 4 * time.Second, MaxDelay: time.Minute}
+
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		delays[policy.Delay(3)] = true
+	}
+
+	if len(delays) < 2 {
+		t.Errorf("expected random delays, got %v", delays)
+	}
+
+	// Intervalos pequenos demais para sortear
+	policy = &QPReconnectPolicy{MinDelay: time.Nanosecond, MaxDelay: time.Nanosecond}
+	if delay := policy.Delay(1); delay != time.Nanosecond {
+		t.Errorf("unexpected delay without jitter: %s", delay)
+	}
+}
+
+// Política rápida para os testes, restaurada ao final
+func setTestReconnectPolicy(t *testing.T, maxFailures int) {
+	policy := GetReconnectPolicy()
+	previous := *policy
+	policy.MinDelay = time.Millisecond
+	policy.MaxDelay = 2 * time.Millisecond
+	policy.MaxFailures = maxFailures
+	t.Cleanup(func() {
+		policy.MinDelay = previous.MinDelay
+		policy.MaxDelay = previous.MaxDelay
+		policy.MaxFailures = previous.MaxFailures
+	})
+}
+
+func TestCircuitBreakerSuspendsAfterFailures(t *testing.T) {
+	setTestReconnectPolicy(t, 3)
+
+	con := NewQPFakeConnection(testSimulatedBotID)
+	con.RestoreError = errors.New("restore failed")
+	server := newWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true}, con)
+
+	server.Initialize()
+	if !server.State.Is(Suspended) || server.Breaker.Failures() != 3 {
+		t.Fatalf("expected suspended after 3 failures, got %s, %d", server.State.Get(), server.Breaker.Failures())
+	}
+
+	// Retomado manualmente, o disjuntor fecha e o servidor inicia
+	con.RestoreError = nil
+	server.Resume()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.State.Is(Ready) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !server.State.Is(Ready) || server.Breaker.Failures() != 0 {
+		t.Errorf("expected ready with the breaker closed, got %s, %d", server.State.Get(), server.Breaker.Failures())
+	}
+}
+
+func TestCircuitBreakerResetOnStart(t *testing.T) {
+	server := newWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true}, NewQPFakeConnection(testSimulatedBotID))
+	server.Breaker.Failure()
+	if failures := server.Breaker.Failure(); failures != 2 {
+		t.Fatalf("expected 2 consecutive failures, got %d", failures)
+	}
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if failures := server.Breaker.Failures(); failures != 0 {
+		t.Errorf("expected the breaker reset after a successful start, got %d", failures)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	setTestReconnectPolicy(t, 0)
+
+	con := NewQPFakeConnection(testSimulatedBotID)
+	con.RestoreError = errors.New("restore failed")
+	server := newWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true}, con)
+
+	done := make(chan struct{})
+	go func() {
+		server.Initialize()
+		close(done)
+	}()
+
+	// Sem limite de falhas continua tentando, até ser desligado
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Breaker.Failures() < 5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if server.State.Is(Suspended) {
+		t.Fatalf("suspended with the breaker disabled")
+	}
+
+	server.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("still reconnecting after shutdown")
+	}
+}
+
+func TestRestartWakesReconnectLoop(t *testing.T) {
+	setTestReconnectPolicy(t, 0)
+	policy := GetReconnectPolicy()
+	policy.MinDelay = time.Hour
+	policy.MaxDelay = time.Hour
+
+	con := NewQPFakeConnection(testSimulatedBotID)
+	con.RestoreError = errors.New("restore failed")
+	server := newWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true}, con)
+
+	done := make(chan error)
+	go func() { done <- server.Initialize() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Breaker.Failures() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Aguardando a próxima tentativa, um novo pedido não inicia outro laço
+	if err := server.Initialize(); err != nil {
+		t.Errorf("expected the second call to only wake the loop, got %s", err)
+	}
+
+	con.RestoreError = nil
+	server.Restart("admin_request")
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reconnect loop not woken by the restart")
+	}
+
+	if !server.State.Is(Ready) || server.Reconnect.Running() {
+		t.Errorf("expected ready with the loop finished, got %s, %v", server.State.Get(), server.Reconnect.Running())
+	}
+}
+
+func TestInitializeReturnsLastError(t *testing.T) {
+	setTestReconnectPolicy(t, 2)
+
+	con := NewQPFakeConnection(testSimulatedBotID)
+	con.RestoreError = errors.New("restore failed")
+	server := newWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true}, con)
+
+	if err := server.Initialize(); err == nil || !server.State.Is(Suspended) {
+		t.Errorf("expected the last error once suspended, got %v, %s", err, server.State.Get())
+	}
+}
+
+func TestShutdownDuringStartStopsReconnecting(t *testing.T) {
+	setTestReconnectPolicy(t, 0)
+
+	con := NewQPFakeConnection(testSimulatedBotID)
+	con.RestoreWait = make(chan struct{})
+	server := newWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true}, con)
+
+	done := make(chan struct{})
+	go func() {
+		server.Initialize()
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.State.Is(Starting) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Desligado enquanto restaura a sessão, aguarda o início terminar para derrubar a conexão
+	stopped := make(chan error)
+	go func() { stopped <- server.Shutdown() }()
+	for !server.State.Is(Halting) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(con.RestoreWait)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("still reconnecting after shutdown")
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !server.State.Is(Stopped) || server.Breaker.Failures() != 0 || con.IsConnected() {
+		t.Errorf("expected stopped without failures nor connection, got %s, %d, %v", server.State.Get(), server.Breaker.Failures(), con.IsConnected())
+	}
+}
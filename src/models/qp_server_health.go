@@ -0,0 +1,115 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// Informações de acompanhamento de um servidor, usadas pelas verificações de saúde
+type QPServerHealth struct {
+	startedAt     time.Time
+	lastMessageAt time.Time
+	lastError     string
+	lastErrorAt   time.Time
+	sync          *sync.RWMutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+func NewQPServerHealth() *QPServerHealth {
+	return &QPServerHealth{sync: &sync.RWMutex{}}
+}
+
+// Conexão pronta, reinicia a contagem do tempo em funcionamento
+func (health *QPServerHealth) Started() {
+	health.sync.Lock()
+	health.startedAt = time.Now()
+	health.sync.Unlock()
+}
+
+func (health *QPServerHealth) MessageReceived() {
+	health.sync.Lock()
+	health.lastMessageAt = time.Now()
+	health.sync.Unlock()
+}
+
+func (health *QPServerHealth) Error(err error) {
+	if err == nil {
+		return
+	}
+
+	health.sync.Lock()
+	health.lastError = err.Error()
+	health.lastErrorAt = time.Now()
+	health.sync.Unlock()
+}
+
+// Situação de um servidor, listada em /v2/status
+type QPServerStatus struct {
+	ID            string            `json:"id"`
+	Phone         string            `json:"phone"`
+	Verified      bool              `json:"verified"`
+	State         QPConnectionState `json:"state"`
+	StartedAt     *time.Time        `json:"startedat,omitempty"`
+	Uptime        int64             `json:"uptime"` // segundos desde que ficou pronto
+	LastMessageAt *time.Time        `json:"lastmessageat,omitempty"`
+	LastError     string            `json:"lasterror,omitempty"`
+	LastErrorAt   *time.Time        `json:"lasterrorat,omitempty"`
+}
+
+func (server *QPWhatsAppServer) GetServerStatus() (status QPServerStatus) {
+	bot := server.GetBot()
+	status.ID = bot.ID
+	status.Phone = bot.GetNumber()
+	status.Verified = bot.Verified
+	status.State = server.State.Get()
+
+	health := server.Health
+	health.sync.RLock()
+	defer health.sync.RUnlock()
+
+	if !health.startedAt.IsZero() {
+		startedAt := health.startedAt
+		status.StartedAt = &startedAt
+		if status.State == Ready || status.State == Unreachable {
+			status.Uptime = int64(time.Since(startedAt).Seconds())
+		}
+	}
+
+	if !health.lastMessageAt.IsZero() {
+		lastMessageAt := health.lastMessageAt
+		status.LastMessageAt = &lastMessageAt
+	}
+
+	if !health.lastErrorAt.IsZero() {
+		lastErrorAt := health.lastErrorAt
+		status.LastError = health.lastError
+		status.LastErrorAt = &lastErrorAt
+	}
+	return
+}
+
+// Situação de todos os servidores em andamento
+func (service *QPWhatsAppService) GetServersStatus() (servers []QPServerStatus) {
+	servers = []QPServerStatus{}
+	for _, server := range service.Servers.List() {
+		servers = append(servers, server.GetServerStatus())
+	}
+	return
+}
+
+// Fração dos bots verificados que estão prontos, 1 caso não haja nenhum
+func (service *QPWhatsAppService) GetReadyRatio() float64 {
+	verified, ready := 0, 0
+	for _, server := range service.Servers.List() {
+		if server.GetBot().Verified {
+			verified++
+			if server.State.Is(Ready) {
+				ready++
+			}
+		}
+	}
+
+	if verified == 0 {
+		return 1
+	}
+	return float64(ready) / float64(verified)
+}
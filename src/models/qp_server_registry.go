@@ -0,0 +1,68 @@
+package models
+
+import "sync"
+
+// Registro dos servidores em andamento, seguro para leituras e escritas simultâneas
+type QPServerRegistry struct {
+	servers map[string]*QPWhatsAppServer
+	sync    *sync.RWMutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
+}
+
+func NewQPServerRegistry() *QPServerRegistry {
+	return &QPServerRegistry{
+		servers: make(map[string]*QPWhatsAppServer),
+		sync:    &sync.RWMutex{},
+	}
+}
+
+func (registry *QPServerRegistry) Get(botID string) (server *QPWhatsAppServer, ok bool) {
+	registry.sync.RLock()
+	server, ok = registry.servers[botID]
+	registry.sync.RUnlock()
+	return
+}
+
+// Inclui o servidor caso ainda não exista um para o mesmo bot
+// Retorna o servidor registrado e se foi este o incluído
+func (registry *QPServerRegistry) Add(server *QPWhatsAppServer) (*QPWhatsAppServer, bool) {
+	registry.sync.Lock()
+	defer registry.sync.Unlock()
+
+	if existing, ok := registry.servers[server.GetBot().ID]; ok {
+		return existing, false
+	}
+
+	registry.servers[server.GetBot().ID] = server
+	return server, true
+}
+
+// Retira o servidor do registro, sem desligá-lo
+// Retorna falso caso não houvesse servidor para o bot
+func (registry *QPServerRegistry) Remove(botID string) (server *QPWhatsAppServer, ok bool) {
+	registry.sync.Lock()
+	defer registry.sync.Unlock()
+
+	server, ok = registry.servers[botID]
+	if ok {
+		delete(registry.servers, botID)
+	}
+	return
+}
+
+// Cópia da lista de servidores, pode ser percorrida sem travar o registro
+func (registry *QPServerRegistry) List() []*QPWhatsAppServer {
+	registry.sync.RLock()
+	defer registry.sync.RUnlock()
+
+	servers := make([]*QPWhatsAppServer, 0, len(registry.servers))
+	for _, server := range registry.servers {
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+func (registry *QPServerRegistry) Count() int {
+	registry.sync.RLock()
+	defer registry.sync.RUnlock()
+	return len(registry.servers)
+}
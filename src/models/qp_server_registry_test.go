@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newRegistryTestServer(botID string) *QPWhatsAppServer {
+	return &QPWhatsAppServer{Bot: QPBot{ID: botID}, State: NewQPConnectionStateMachine(), syncBot: &sync.RWMutex{}}
+}
+
+func TestServerRegistryAddIsIdempotent(t *testing.T) {
+	registry := NewQPServerRegistry()
+	first := newRegistryTestServer("5555555555551@c.us")
+	second := newRegistryTestServer("5555555555551@c.us")
+
+	if server, added := registry.Add(first); !added || server != first {
+		t.Fatalf("first add should register the server")
+	}
+
+	if server, added := registry.Add(second); added || server != first {
+		t.Fatalf("second add should keep the registered server")
+	}
+
+	if count := registry.Count(); count != 1 {
+		t.Fatalf("expected 1 server, got %d", count)
+	}
+}
+
+func TestServerRegistryRemoveIsIdempotent(t *testing.T) {
+	registry := NewQPServerRegistry()
+	server := newRegistryTestServer("5555555555551@c.us")
+	registry.Add(server)
+
+	if removed, ok := registry.Remove(server.Bot.ID); !ok || removed != server {
+		t.Fatalf("first remove should return the server")
+	}
+
+	if _, ok := registry.Remove(server.Bot.ID); ok {
+		t.Fatalf("second remove should not find a server")
+	}
+
+	if _, ok := registry.Get(server.Bot.ID); ok {
+		t.Fatalf("removed server still registered")
+	}
+}
+
+// Executar com -race
+func TestServerRegistryConcurrentAccess(t *testing.T) {
+	registry := NewQPServerRegistry()
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 50; i++ {
+		botID := fmt.Sprintf("55555555555%02d@c.us", i%10)
+		remove := i%3 == 0
+
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			registry.Add(newRegistryTestServer(botID))
+		}()
+		go func() {
+			defer wg.Done()
+			registry.Get(botID)
+		}()
+		go func() {
+			defer wg.Done()
+			for _, server := range registry.List() {
+				_ = server.Bot.ID
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if remove {
+				registry.Remove(botID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := registry.Count(); count > 10 {
+		t.Fatalf("expected at most one server per bot, got %d", count)
+	}
+}
+
+// Executar com -race
+func TestServerRegistryConcurrentAddRegistersOnce(t *testing.T) {
+	registry := NewQPServerRegistry()
+	wg := &sync.WaitGroup{}
+	added := make(chan *QPWhatsAppServer, 20)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if server, ok := registry.Add(newRegistryTestServer("5555555555551@c.us")); ok {
+				added <- server
+			}
+		}()
+	}
+	wg.Wait()
+	close(added)
+
+	count := 0
+	for server := range added {
+		count++
+		if registered, _ := registry.Get("5555555555551@c.us"); registered != server {
+			t.Fatalf("registered server differs from the added one")
+		}
+	}
+
+	if count != 1 {
+		t.Fatalf("expected a single successful add, got %d", count)
+	}
+}
@@ -0,0 +1,266 @@
+package models
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Prefixo que identifica uma sessão criptografada no banco de dados
+// Sessões sem este prefixo são gob puro, gravadas antes da criptografia existir
+var sessionMagic = []byte("QPSE1")
+
+// Chaves mestras (KEK) usadas para proteger as chaves de cada sessão gravada
+// Cada chave possui um ID, gravado junto com a sessão, permitindo a rotação
+type QPSessionKeyring struct {
+	Keys    map[string][]byte
+	Current string // ID da chave usada para novas gravações
+}
+
+var (
+	sessionKeyringSync sync.Once
+	sessionKeyring     *QPSessionKeyring
+)
+
+// Chaves carregadas de SESSIONKEYS e/ou SESSIONKEYFILE, no formato "id:base64" (uma por linha ou separadas por vírgula)
+// A chave ativa é SESSIONKEYID, ou a última informada
+func GetSessionKeyring() *QPSessionKeyring {
+	sessionKeyringSync.Do(func() {
+		keyring := &QPSessionKeyring{Keys: make(map[string][]byte)}
+
+		var definitions []string
+		if keys, err := getenvStr("SESSIONKEYS"); err == nil {
+			definitions = append(definitions, strings.Split(keys, ",")...)
+		}
+
+		if filename, err := getenvStr("SESSIONKEYFILE"); err == nil {
+			content, err := ioutil.ReadFile(filename)
+			if err != nil {
+				Log.WithComponent("crypto").WithError(err).Fatalf("error reading session key file")
+			}
+			definitions = append(definitions, strings.Split(string(content), "\n")...)
+		}
+
+		for _, definition := range definitions {
+			definition = strings.TrimSpace(definition)
+			if len(definition) == 0 || strings.HasPrefix(definition, "#") {
+				continue
+			}
+
+			if err := keyring.Add(definition); err != nil {
+				Log.WithComponent("crypto").WithError(err).Fatalf("invalid session key")
+			}
+		}
+
+		if current, err := getenvStr("SESSIONKEYID"); err == nil {
+			if _, ok := keyring.Keys[current]; !ok {
+				Log.WithComponent("crypto").Fatalf("session key not found: %s", current)
+			}
+			keyring.Current = current
+		}
+
+		sessionKeyring = keyring
+	})
+	return sessionKeyring
+}
+
+// Inclui uma chave no formato "id:base64", a última incluída passa a ser a ativa
+func (keyring *QPSessionKeyring) Add(definition string) error {
+	parts := strings.SplitN(definition, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[0]) > 255 {
+		return fmt.Errorf("expected id:base64")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+
+	if len(key) != 32 {
+		return fmt.Errorf("key %s must have 32 bytes, got %d", parts[0], len(key))
+	}
+
+	keyring.Keys[parts[0]] = key
+	keyring.Current = parts[0]
+	return nil
+}
+
+func (keyring *QPSessionKeyring) Enabled() bool {
+	return len(keyring.Current) > 0
+}
+
+// Gera uma nova chave aleatória em base64, para uso em SESSIONKEYS
+func GenerateSessionKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Criptografia envelope: uma chave aleatória por gravação (DEK) protege os dados
+// e a chave ativa do chaveiro (KEK) protege a DEK
+// Formato: magic | tamanho do id | id | nonce + DEK criptografada | nonce + dados criptografados
+// O wid é usado como dado autenticado, impedindo a troca de sessões entre bots
+func (keyring *QPSessionKeyring) Encrypt(wid string, plain []byte) ([]byte, error) {
+	if !keyring.Enabled() {
+		return plain, nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := sealGCM(keyring.Keys[keyring.Current], dek, []byte(keyring.Current))
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealGCM(dek, plain, []byte(wid))
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	buff.Write(sessionMagic)
+	buff.WriteByte(byte(len(keyring.Current)))
+	buff.WriteString(keyring.Current)
+	buff.Write(wrapped)
+	buff.Write(sealed)
+	return buff.Bytes(), nil
+}
+
+// Descriptografa uma sessão gravada com qualquer chave do chaveiro
+// Sessões antigas, sem criptografia, são retornadas como estão
+func (keyring *QPSessionKeyring) Decrypt(wid string, data []byte) ([]byte, error) {
+	keyID, ok := SessionKeyID(data)
+	if !ok {
+		return data, nil
+	}
+
+	kek, ok := keyring.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("session key not found: %s", keyID)
+	}
+
+	offset := len(sessionMagic) + 1 + len(keyID)
+	wrappedLength := 12 + 32 + 16 // nonce + DEK + tag
+	if len(data) < offset+wrappedLength {
+		return nil, fmt.Errorf("invalid encrypted session")
+	}
+
+	dek, err := openGCM(kek, data[offset:offset+wrappedLength], []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	return openGCM(dek, data[offset+wrappedLength:], []byte(wid))
+}
+
+// Dados sem criptografia lidos com uma chave configurada
+// Gravados antes da chave existir ou trocados diretamente no banco, são avisados e regravados
+func (keyring *QPSessionKeyring) Unprotected(data []byte) bool {
+	_, ok := SessionKeyID(data)
+	return keyring.Enabled() && !ok && len(data) > 0
+}
+
+// ID da chave usada para gravar a sessão, ok = false se a sessão não estiver criptografada
+func SessionKeyID(data []byte) (keyID string, ok bool) {
+	if !bytes.HasPrefix(data, sessionMagic) || len(data) < len(sessionMagic)+1 {
+		return
+	}
+
+	length := int(data[len(sessionMagic)])
+	start := len(sessionMagic) + 1
+	if len(data) < start+length {
+		return
+	}
+
+	return string(data[start : start+length]), true
+}
+
+func sealGCM(key []byte, plain []byte, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plain, additional), nil
+}
+
+func openGCM(key []byte, sealed []byte, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted data")
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, sealed[gcm.NonceSize():], additional)
+}
+
+// Regrava todas as sessões com a chave ativa
+// Usado após configurar a criptografia pela primeira vez ou após a rotação de chaves
+func ReEncryptSessions() (count int, err error) {
+	keyring := GetSessionKeyring()
+	if !keyring.Enabled() {
+		return 0, fmt.Errorf("no session key configured, set SESSIONKEYS or SESSIONKEYFILE")
+	}
+
+	stores, err := WhatsAppService.DB.Store.FindAll()
+	if err != nil {
+		return
+	}
+
+	for _, store := range stores {
+		if len(store.Data) == 0 {
+			continue
+		}
+
+		if keyID, ok := SessionKeyID(store.Data); ok && keyID == keyring.Current {
+			continue
+		}
+
+		plain, err := keyring.Decrypt(store.BotID, store.Data)
+		if err != nil {
+			return count, fmt.Errorf("session %s: %s", store.BotID, err)
+		}
+
+		data, err := keyring.Encrypt(store.BotID, plain)
+		if err != nil {
+			return count, fmt.Errorf("session %s: %s", store.BotID, err)
+		}
+
+		if _, err = WhatsAppService.DB.Store.Update(store.BotID, data); err != nil {
+			return count, fmt.Errorf("session %s: %s", store.BotID, err)
+		}
+		count++
+	}
+	return
+}
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+)
+
+// Sessões em memória, no lugar da tabela sessionstore
+type testSessionStore struct {
+	data map[string][]byte
+	sync *sync.Mutex
+}
+
+func (store *testSessionStore) FindAll() (stores []QPStore, err error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	for wid, data := range store.data {
+		stores = append(stores, QPStore{BotID: wid, Data: data})
+	}
+	return
+}
+
+func (store *testSessionStore) Create(wid string) (QPStore, error) {
+	store.sync.Lock()
+	store.data[wid] = nil
+	store.sync.Unlock()
+	return QPStore{BotID: wid}, nil
+}
+
+func (store *testSessionStore) Get(wid string) (QPStore, error) {
+	store.sync.Lock()
+	defer store.sync.Unlock()
+	data, ok := store.data[wid]
+	if !ok {
+		return QPStore{}, sql.ErrNoRows
+	}
+	return QPStore{BotID: wid, Data: data}, nil
+}
+
+func (store *testSessionStore) GetOrCreate(wid string) (QPStore, error) {
+	if existing, err := store.Get(wid); err == nil {
+		return existing, nil
+	}
+	return store.Create(wid)
+}
+
+func (store *testSessionStore) Update(wid string, data []byte) ([]byte, error) {
+	store.sync.Lock()
+	store.data[wid] = data
+	store.sync.Unlock()
+	return data, nil
+}
+
+func (store *testSessionStore) Delete(wid string) error {
+	store.sync.Lock()
+	delete(store.data, wid)
+	store.sync.Unlock()
+	return nil
+}
+
+func (store *testSessionStore) Exists(wid string) (bool, error) {
+	_, err := store.Get(wid)
+	return err == nil, nil
+}
+
+// Chaveiro global com as chaves informadas, restaurado ao final do teste
+func setTestSessionKeys(t *testing.T, definitions ...string) *QPSessionKeyring {
+	keyring := GetSessionKeyring()
+	keys, current := keyring.Keys, keyring.Current
+	t.Cleanup(func() { keyring.Keys, keyring.Current = keys, current })
+
+	keyring.Keys, keyring.Current = make(map[string][]byte), ""
+	for _, definition := range definitions {
+		if err := keyring.Add(definition); err != nil {
+			t.Fatalf("invalid key %s: %s", definition, err)
+		}
+	}
+	return keyring
+}
+
+// Banco de dados com somente as sessões, restaurado ao final do teste
+func setTestSessionStore(t *testing.T) *testSessionStore {
+	if WhatsAppService == nil {
+		WhatsAppService = &QPWhatsAppService{Servers: NewQPServerRegistry()}
+	}
+
+	db := WhatsAppService.DB
+	t.Cleanup(func() { WhatsAppService.DB = db })
+
+	store := &testSessionStore{make(map[string][]byte), &sync.Mutex{}}
+	WhatsAppService.DB = &QPDatabase{Store: store}
+	return store
+}
+
+func testSessionKey(id string, fill byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+func TestSessionEncryptRoundTrip(t *testing.T) {
+	keyring := setTestSessionKeys(t, testSessionKey("k1", 1))
+
+	plain := []byte("client and server tokens")
+	sealed, err := keyring.Encrypt(testBotID, plain)
+	if err != nil {
+		t.Fatalf("error encrypting: %s", err)
+	}
+
+	if keyID, ok := SessionKeyID(sealed); !ok || keyID != "k1" {
+		t.Errorf("unexpected key id: %s, %v", keyID, ok)
+	}
+
+	if bytes.Contains(sealed, plain) {
+		t.Errorf("session stored in plain text")
+	}
+
+	opened, err := keyring.Decrypt(testBotID, sealed)
+	if err != nil || !bytes.Equal(opened, plain) {
+		t.Fatalf("unexpected session: %q, %v", opened, err)
+	}
+
+	// Cada gravação usa sua própria chave e nonce
+	if again, _ := keyring.Encrypt(testBotID, plain); bytes.Equal(again, sealed) {
+		t.Errorf("expected a different ciphertext on each write")
+	}
+}
+
+func TestSessionDecryptRejectsWrongKeyOrBot(t *testing.T) {
+	keyring := setTestSessionKeys(t, testSessionKey("k1", 1))
+	sealed, _ := keyring.Encrypt(testBotID, []byte("session"))
+
+	// O wid autentica a sessão, não pode ser restaurada em outro bot
+	if _, err := keyring.Decrypt("5521977776666@c.us", sealed); err == nil {
+		t.Errorf("expected the session of another bot to be rejected")
+	}
+
+	// Mesmo id, outra chave
+	other := setTestSessionKeys(t, testSessionKey("k1", 2))
+	if _, err := other.Decrypt(testBotID, sealed); err == nil {
+		t.Errorf("expected a different key to be rejected")
+	}
+
+	// Chave ausente do chaveiro
+	missing := setTestSessionKeys(t, testSessionKey("k2", 1))
+	if _, err := missing.Decrypt(testBotID, sealed); err == nil || !strings.Contains(err.Error(), "k1") {
+		t.Errorf("expected the missing key to be reported, got %v", err)
+	}
+
+	// O id gravado também é autenticado, mesmo com os mesmos bytes a chave k2 não abre a sessão de k1
+	swapped := append([]byte{}, sealed...)
+	copy(swapped[len(sessionMagic)+1:], "k2")
+	if _, err := missing.Decrypt(testBotID, swapped); err == nil {
+		t.Errorf("expected a swapped key id to be rejected")
+	}
+}
+
+func TestSessionLegacyPlainText(t *testing.T) {
+	store := setTestSessionStore(t)
+	setTestSessionKeys(t)
+
+	session := whatsapp.Session{ClientId: "client", Wid: testBotID}
+	if err := WriteSession(testBotID, session); err != nil {
+		t.Fatalf("error writing session: %s", err)
+	}
+
+	if _, ok := SessionKeyID(store.data[testBotID]); ok {
+		t.Fatalf("expected a plain session without keys")
+	}
+
+	// Após configurar a chave, as sessões antigas continuam legíveis e são regravadas criptografadas
+	setTestSessionKeys(t, testSessionKey("k1", 1))
+	read, err := ReadSession(testBotID)
+	if err != nil || read.ClientId != "client" {
+		t.Fatalf("unexpected legacy session: %#v, %v", read, err)
+	}
+
+	if keyID, ok := SessionKeyID(store.data[testBotID]); !ok || keyID != "k1" {
+		t.Errorf("expected the legacy session encrypted on read, got %s", keyID)
+	}
+
+	if err := WriteSession(testBotID, read); err != nil {
+		t.Fatalf("error writing session: %s", err)
+	}
+
+	if keyID, ok := SessionKeyID(store.data[testBotID]); !ok || keyID != "k1" {
+		t.Errorf("expected the session encrypted on the next write, got %s", keyID)
+	}
+}
+
+func TestSessionReEncryptRotation(t *testing.T) {
+	store := setTestSessionStore(t)
+	keyring := setTestSessionKeys(t, testSessionKey("k1", 1))
+
+	WriteSession(testBotID, whatsapp.Session{ClientId: "encrypted"})
+	store.Update("5521977776666@c.us", nil) // vazia, ignorada
+	keyring.Keys, keyring.Current = map[string][]byte{}, ""
+	WriteSession("5521966665555@c.us", whatsapp.Session{ClientId: "legacy"})
+
+	// Nova chave ativa, a anterior mantida para leitura
+	keyring.Add(testSessionKey("k1", 1))
+	keyring.Add(testSessionKey("k2", 2))
+
+	count, err := ReEncryptSessions()
+	if err != nil || count != 2 {
+		t.Fatalf("expected two sessions re-encrypted, got %d, %v", count, err)
+	}
+
+	for wid, client := range map[string]string{testBotID: "encrypted", "5521966665555@c.us": "legacy"} {
+		if keyID, _ := SessionKeyID(store.data[wid]); keyID != "k2" {
+			t.Errorf("session %s not rotated: %s", wid, keyID)
+		}
+
+		if session, err := ReadSession(wid); err != nil || session.ClientId != client {
+			t.Errorf("unexpected session %s: %#v, %v", wid, session, err)
+		}
+	}
+
+	// A chave anterior pode ser removida, e uma nova execução não regrava nada
+	delete(keyring.Keys, "k1")
+	if count, err := ReEncryptSessions(); err != nil || count != 0 {
+		t.Errorf("expected nothing to re-encrypt, got %d, %v", count, err)
+	}
+}
+
+func TestSessionReEncryptRequiresKey(t *testing.T) {
+	setTestSessionStore(t)
+	setTestSessionKeys(t)
+
+	if _, err := ReEncryptSessions(); err == nil {
+		t.Errorf("expected an error without session keys")
+	}
+}
@@ -0,0 +1,317 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+)
+
+// Prefixo dos números gerados para os bots simulados, fora de qualquer plano de numeração real
+const simulatedNumberPrefix = "999"
+
+// Resumo de uma mensagem enviada por um bot simulado
+type QPSimulatedMessage struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Recipient string `json:"recipient"`
+	Text      string `json:"text,omitempty"`
+	FileName  string `json:"filename,omitempty"`
+	MIME      string `json:"mime,omitempty"`
+	Length    int64  `json:"length,omitempty"`
+	Ptt       bool   `json:"ptt,omitempty"`
+}
+
+// Cria um bot simulado, já verificado, para o usuário e inicia seu servidor
+// Retorna também o token do bot, que não pode ser recuperado depois
+func CreateSimulatedBot(userID string) (bot QPBot, token string, err error) {
+	botID, err := newSimulatedBotID()
+	if err != nil {
+		return
+	}
+
+	token, hash := GenerateBotToken()
+	bot, err = WhatsAppService.DB.Bot.Create(botID, userID, hash)
+	if err != nil {
+		return
+	}
+
+	if err = WhatsAppService.DB.Bot.Simulate(bot.ID, true); err != nil {
+		return
+	}
+
+	if err = bot.MarkVerified(true); err != nil {
+		return
+	}
+
+	bot, err = WhatsAppService.DB.Bot.FindByID(bot.ID)
+	if err != nil {
+		return
+	}
+
+	Log.WithComponent("simulator").WithField("bot", bot.ID).Infof("simulated bot created")
+	WhatsAppService.AppendNewServer(bot)
+	return
+}
+
+func newSimulatedBotID() (string, error) {
+	max := big.NewInt(100000000000)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%011d@c.us", simulatedNumberPrefix, n), nil
+}
+
+// Id no mesmo formato hexadecimal usado pelo whatsapp
+func newSimulatedMessageID() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	return "SIM" + strings.ToUpper(hex.EncodeToString(b))
+}
+
+// Inicia o bot simulado sobre a conexão em memória, sem sessão nem celular
+func (server *QPWhatsAppServer) startSimulated() (err error) {
+	con, ok := server.Connection.(*QPFakeConnection)
+	if !ok {
+		con = NewQPFakeConnection(server.GetBot().ID)
+		server.Connection = con
+	}
+
+	if _, err = con.RestoreWithSession(whatsapp.Session{Wid: server.GetBot().ID}); err != nil {
+		return
+	}
+
+	if err = server.State.Transition(Connected, "simulated session"); err != nil {
+		return
+	}
+
+	if err = server.State.Transition(Fetching, "simulated session"); err != nil {
+		return
+	}
+
+	server.Log.Infof("setting up simulated message handler")
+	asyncMessageHandler := &QPMessageHandler{&server.Bot, true, server, false}
+	server.Handlers = *asyncMessageHandler
+	con.AddHandler(asyncMessageHandler)
+	return
+}
+
+func (server *QPWhatsAppServer) getSimulatedConnection() (*QPFakeConnection, error) {
+	con, ok := server.Connection.(*QPFakeConnection)
+	if !server.GetBot().Simulated || !ok {
+		return nil, fmt.Errorf("bot is not simulated")
+	}
+	return con, nil
+}
+
+// Entrega uma mensagem ao bot simulado como se tivesse chegado do whatsapp
+// Percorre os mesmos handlers, cache e webhook das mensagens reais
+func (server *QPWhatsAppServer) Inject(request *QPInjectRequestV2) (err error) {
+	con, err := server.getSimulatedConnection()
+	if err != nil {
+		return
+	}
+
+	if !server.State.Is(Ready, Unreachable) {
+		return fmt.Errorf("server not ready, wait")
+	}
+
+	if len(request.ID) == 0 {
+		request.ID = newSimulatedMessageID()
+	}
+
+	if request.Timestamp == 0 {
+		request.Timestamp = uint64(time.Now().Unix())
+	}
+
+	switch request.Type {
+	case "battery":
+		con.Receive(whatsapp.BatteryMessage{Percentage: request.Percentage, Plugged: request.Plugged, Powersave: request.Powersave})
+		return
+	case "json":
+		if len(request.Json) == 0 {
+			return fmt.Errorf("json is required")
+		}
+		con.Receive(request.Json)
+		return
+	}
+
+	if !strings.HasSuffix(request.From, "@s.whatsapp.net") && !strings.HasSuffix(request.From, "@g.us") {
+		return fmt.Errorf("invalid sender %s", request.From)
+	}
+
+	if len(request.Name) > 0 {
+		contact := request.From
+		if len(request.Participant) > 0 {
+			contact = request.Participant
+		}
+		con.AddContact(whatsapp.Contact{Jid: contact, Name: request.Name})
+	}
+
+	message, err := request.toWhatsAppMessage()
+	if err != nil {
+		return
+	}
+
+	con.Receive(message)
+	return
+}
+
+func (request *QPInjectRequestV2) toWhatsAppMessage() (message interface{}, err error) {
+	fromMe := request.FromMe
+	source := &proto.WebMessageInfo{
+		Key: &proto.MessageKey{
+			RemoteJid: &request.From,
+			FromMe:    &fromMe,
+			Id:        &request.ID,
+		},
+		MessageTimestamp: &request.Timestamp,
+		Message:          &proto.Message{},
+	}
+
+	if len(request.Participant) > 0 {
+		source.Participant = &request.Participant
+	}
+
+	info := whatsapp.MessageInfo{
+		Id:        request.ID,
+		RemoteJid: request.From,
+		FromMe:    request.FromMe,
+		Timestamp: request.Timestamp,
+		Source:    source,
+	}
+
+	switch request.Type {
+	case "", "text":
+		if len(request.Text) == 0 {
+			return nil, fmt.Errorf("text is required")
+		}
+		source.Message.Conversation = &request.Text
+		return whatsapp.TextMessage{Info: info, Text: request.Text}, nil
+	case "location":
+		source.Message.LocationMessage = &proto.LocationMessage{DegreesLatitude: &request.Latitude, DegreesLongitude: &request.Longitude}
+		return whatsapp.LocationMessage{Info: info, DegreesLatitude: request.Latitude, DegreesLongitude: request.Longitude, Name: request.Text}, nil
+	case "contact":
+		source.Message.ContactMessage = &proto.ContactMessage{DisplayName: &request.Text, Vcard: &request.VCard}
+		return whatsapp.ContactMessage{Info: info, DisplayName: request.Text, Vcard: request.VCard}, nil
+	case "image", "audio", "document":
+		return request.toWhatsAppMediaMessage(info)
+	default:
+		return nil, fmt.Errorf("invalid message type %s", request.Type)
+	}
+}
+
+// Anexos simulados não existem no whatsapp, o conteúdo fica no cache local para o download
+func (request *QPInjectRequestV2) toWhatsAppMediaMessage(info whatsapp.MessageInfo) (message interface{}, err error) {
+	attachment := request.Attachment
+	if len(attachment.MIME) == 0 {
+		return nil, fmt.Errorf("attachment mime is required")
+	}
+
+	if len(attachment.Base64) > 0 {
+		data, err := base64.StdEncoding.DecodeString(attachment.Base64)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, _, err = GetMediaCache().Put(request.ID, data); err != nil {
+			return nil, err
+		}
+		attachment.Length = len(data)
+	}
+
+	url := attachment.Url
+	if len(url) == 0 {
+		url = "simulated://" + request.ID
+	}
+
+	mediaKey := make([]byte, 32)
+	rand.Read(mediaKey)
+	length := uint64(attachment.Length)
+	mime := attachment.MIME
+
+	switch request.Type {
+	case "image":
+		info.Source.Message.ImageMessage = &proto.ImageMessage{Url: &url, Mimetype: &mime, FileLength: &length, MediaKey: mediaKey, Caption: &request.Text}
+		return whatsapp.ImageMessage{Info: info, Caption: request.Text, Type: mime}, nil
+	case "audio":
+		info.Source.Message.AudioMessage = &proto.AudioMessage{Url: &url, Mimetype: &mime, FileLength: &length, MediaKey: mediaKey}
+		return whatsapp.AudioMessage{Info: info, Type: mime, Length: uint32(length)}, nil
+	default:
+		fileName := attachment.FileName
+		info.Source.Message.DocumentMessage = &proto.DocumentMessage{Url: &url, Mimetype: &mime, FileLength: &length, MediaKey: mediaKey, FileName: &fileName, Title: &request.Text}
+		return whatsapp.DocumentMessage{Info: info, Title: request.Text, Type: mime, FileName: fileName}, nil
+	}
+}
+
+// Mensagens enviadas pelo bot simulado, na ordem de envio
+func (server *QPWhatsAppServer) GetSimulatedSent() (messages []QPSimulatedMessage, err error) {
+	con, err := server.getSimulatedConnection()
+	if err != nil {
+		return
+	}
+
+	return simulatedSentMessages(con.SentWithIDs()), nil
+}
+
+// Mensagens enviadas pelo bot simulado, descartadas em seguida
+func (server *QPWhatsAppServer) TakeSimulatedSent() (messages []QPSimulatedMessage, err error) {
+	con, err := server.getSimulatedConnection()
+	if err != nil {
+		return
+	}
+
+	return simulatedSentMessages(con.TakeSent()), nil
+}
+
+// Descreve as mensagens enviadas pela conexão falsa
+func simulatedSentMessages(sentMessages []interface{}, ids []string) (messages []QPSimulatedMessage) {
+	messages = []QPSimulatedMessage{}
+	for i, sent := range sentMessages {
+		message := QPSimulatedMessage{ID: ids[i]}
+		switch msg := sent.(type) {
+		case whatsapp.TextMessage:
+			message.Type = "text"
+			message.Recipient = msg.Info.RemoteJid
+			message.Text = msg.Text
+		case whatsapp.ImageMessage:
+			message.Type = "image"
+			message.Recipient = msg.Info.RemoteJid
+			message.Text = msg.Caption
+			message.MIME = msg.Type
+			message.Length = simulatedContentLength(msg.Content)
+		case whatsapp.AudioMessage:
+			message.Type = "audio"
+			message.Recipient = msg.Info.RemoteJid
+			message.MIME = msg.Type
+			message.Ptt = msg.Ptt
+			message.Length = simulatedContentLength(msg.Content)
+		case whatsapp.DocumentMessage:
+			message.Type = "document"
+			message.Recipient = msg.Info.RemoteJid
+			message.Text = msg.Title
+			message.FileName = msg.FileName
+			message.MIME = msg.Type
+			message.Length = simulatedContentLength(msg.Content)
+		default:
+			message.Type = fmt.Sprintf("%T", sent)
+		}
+		messages = append(messages, message)
+	}
+	return
+}
+
+// Tamanho original do conteúdo, mesmo que já lido
+func simulatedContentLength(content interface{}) int64 {
+	if sized, ok := content.(interface{ Size() int64 }); ok {
+		return sized.Size()
+	}
+	return 0
+}
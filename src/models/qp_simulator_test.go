@@ -0,0 +1,135 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+)
+
+const testSimulatedBotID = "99912345678901@c.us"
+
+func newSimulatedTestServer(t *testing.T) *QPWhatsAppServer {
+	server := CreateWhatsAppServer(QPBot{ID: testSimulatedBotID, Simulated: true})
+	if err := server.Start(); err != nil {
+		t.Fatalf("error starting simulated server: %s", err)
+	}
+	return &server
+}
+
+func TestSimulatedServerStartsWithoutSession(t *testing.T) {
+	server := newSimulatedTestServer(t)
+
+	if state := server.State.Get(); state != Ready {
+		t.Fatalf("expected ready, got %s", state)
+	}
+
+	if _, ok := server.Connection.(*QPFakeConnection); !ok {
+		t.Errorf("simulated server should use the in memory connection")
+	}
+
+	if err := server.Shutdown(); err != nil || !server.State.Is(Stopped) {
+		t.Errorf("unexpected shutdown: %v, %s", err, server.State.Get())
+	}
+
+	if err := server.Start(); err != nil || !server.State.Is(Ready) {
+		t.Errorf("unexpected restart: %v, %s", err, server.State.Get())
+	}
+}
+
+func TestSimulatedServerInjectsMessages(t *testing.T) {
+	server := newSimulatedTestServer(t)
+
+	text := &QPInjectRequestV2{From: testRecipient, Name: "Fulano", Text: "olá"}
+	if err := server.Inject(text); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	message, ok := server.GetMessage(text.ID)
+	if !ok || message.Text != "olá" || message.ReplyTo.Title != "Fulano" {
+		t.Errorf("unexpected text message: %#v", message)
+	}
+
+	document := &QPInjectRequestV2{
+		Type: "document",
+		From: testRecipient,
+		Attachment: QPAttachment{
+			MIME:     "application/pdf",
+			FileName: "documento.pdf",
+			Base64:   base64.StdEncoding.EncodeToString([]byte("%PDF")),
+		},
+	}
+	if err := server.Inject(document); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	message, ok = server.GetMessage(document.ID)
+	if !ok || message.Attachment.FileName != "documento.pdf" || message.Attachment.Length != 4 {
+		t.Errorf("unexpected document message: %#v", message)
+	}
+
+	// O conteúdo simulado é servido pelo cache local
+	if _, file, _, err := server.DownloadAttachment(document.ID); err != nil {
+		t.Errorf("error downloading simulated attachment: %s", err)
+	} else {
+		file.Close()
+	}
+
+	if err := server.Inject(&QPInjectRequestV2{Type: "battery", Percentage: 42}); err != nil || server.Battery.Percentage != 42 {
+		t.Errorf("battery not injected: %v, %#v", err, server.Battery)
+	}
+}
+
+func TestSimulatedServerRejectsInvalidInjections(t *testing.T) {
+	server := newSimulatedTestServer(t)
+
+	invalid := []*QPInjectRequestV2{
+		{From: "5521988887777", Text: "olá"},
+		{From: testRecipient},
+		{Type: "sticker", From: testRecipient},
+		{Type: "image", From: testRecipient},
+		{Type: "json"},
+	}
+
+	for _, request := range invalid {
+		if err := server.Inject(request); err == nil {
+			t.Errorf("expected error for %#v", request)
+		}
+	}
+
+	real := AppendFakeServer(QPBot{ID: testBotID}, NewQPFakeConnection(testBotID))
+	defer WhatsAppService.Servers.Remove(testBotID)
+	if err := real.Inject(&QPInjectRequestV2{From: testRecipient, Text: "olá"}); err == nil {
+		t.Errorf("expected error injecting into a bot not simulated")
+	}
+}
+
+func TestSimulatedServerRecordsSentMessages(t *testing.T) {
+	server := newSimulatedTestServer(t)
+
+	textID, _ := server.SendMessage(whatsapp.TextMessage{Info: whatsapp.MessageInfo{RemoteJid: testRecipient}, Text: "oi"})
+	server.SendMessage(whatsapp.DocumentMessage{
+		Info:     whatsapp.MessageInfo{RemoteJid: testRecipient},
+		FileName: "documento.pdf",
+		Type:     "application/pdf",
+		Content:  bytes.NewReader([]byte("%PDF")),
+	})
+
+	sent, err := server.GetSimulatedSent()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 sent messages, got %d", len(sent))
+	}
+
+	if sent[0].ID != textID || sent[0].Type != "text" || sent[0].Text != "oi" || sent[0].Recipient != testRecipient {
+		t.Errorf("unexpected text summary: %#v", sent[0])
+	}
+
+	if sent[1].Type != "document" || sent[1].FileName != "documento.pdf" || sent[1].Length != 4 {
+		t.Errorf("unexpected document summary: %#v", sent[1])
+	}
+}
@@ -8,6 +8,7 @@ type QPStore struct {
 }
 
 type IQPStore interface {
+	FindAll() ([]QPStore, error)
 	Create(wid string) (QPStore, error)
 	Get(wid string) (QPStore, error)
 	GetOrCreate(wid string) (QPStore, error)
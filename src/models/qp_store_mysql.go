@@ -12,6 +12,12 @@ type QPStoreMysql struct {
 	db *sqlx.DB
 }
 
+func (source QPStoreMysql) FindAll() ([]QPStore, error) {
+	stores := []QPStore{}
+	err := source.db.Select(&stores, "SELECT * FROM sessionstore")
+	return stores, err
+}
+
 func (source QPStoreMysql) Exists(wid string) (bool, error) {
 	var count int
 	err := source.db.Get(&count, "SELECT count(*) FROM sessionstore WHERE bot_id = ?", wid)
@@ -12,6 +12,12 @@ type QPStorePostgres struct {
 	db *sqlx.DB
 }
 
+func (source QPStorePostgres) FindAll() ([]QPStore, error) {
+	stores := []QPStore{}
+	err := source.db.Select(&stores, "SELECT * FROM sessionstore")
+	return stores, err
+}
+
 func (source QPStorePostgres) Exists(wid string) (bool, error) {
 	var count int
 	err := source.db.Get(&count, "SELECT count(*) FROM sessionstore WHERE bot_id = $1", wid)
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Papel de um usuário em uma equipe, ou sobre um bot
+// viewer: vê o bot e seu estado, operator: também envia e lê mensagens,
+// admin: também gerencia o bot e os membros da equipe, owner: também remove e compartilha
+type QPRole string
+
+const (
+	RoleViewer   QPRole = "viewer"
+	RoleOperator QPRole = "operator"
+	RoleAdmin    QPRole = "admin"
+	RoleOwner    QPRole = "owner"
+)
+
+var Roles = []QPRole{RoleViewer, RoleOperator, RoleAdmin, RoleOwner}
+
+func (role QPRole) rank() int {
+	for i, item := range Roles {
+		if item == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// O papel tem as permissões do papel exigido ?
+func (role QPRole) Allows(required QPRole) bool {
+	return role.rank() > 0 && role.rank() >= required.rank()
+}
+
+// Usados pelos templates para exibir somente as ações permitidas
+func (role QPRole) CanOperate() bool { return role.Allows(RoleOperator) }
+func (role QPRole) CanManage() bool  { return role.Allows(RoleAdmin) }
+func (role QPRole) IsOwner() bool    { return role.Allows(RoleOwner) }
+
+func ParseRole(value string) (QPRole, error) {
+	role := QPRole(strings.ToLower(strings.TrimSpace(value)))
+	if role.rank() == 0 {
+		return role, fmt.Errorf("invalid role %s, valid roles: viewer, operator, admin, owner", value)
+	}
+	return role, nil
+}
+
+type QPTeam struct {
+	ID        string `db:"id" json:"id"`
+	Name      string `db:"name" json:"name"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+	UpdatedAt string `db:"updated_at" json:"updated_at"`
+
+	// Membros precisam do segundo fator (TOTP) para usar a interface web
+	Require2FA bool `db:"require_2fa" json:"require_2fa"`
+}
+
+// Equipe com o papel do usuário consultado
+type QPTeamMembership struct {
+	QPTeam
+	Role QPRole `db:"role" json:"role"`
+}
+
+// Membro da equipe, com o email do usuário
+type QPTeamMember struct {
+	TeamID    string `db:"team_id" json:"-"`
+	UserID    string `db:"user_id" json:"user_id"`
+	Email     string `db:"email" json:"email"`
+	Role      QPRole `db:"role" json:"role"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+// Bot compartilhado com uma equipe e o papel do usuário nesta equipe
+type QPTeamBotRole struct {
+	BotID string `db:"bot_id"`
+	Role  QPRole `db:"role"`
+}
+
+type IQPTeam interface {
+	Create(name string, ownerID string) (QPTeam, error)
+	FindByID(ID string) (QPTeam, error)
+	FindAllForUser(userID string) ([]QPTeamMembership, error)
+	Delete(ID string) error
+	Members(teamID string) ([]QPTeamMember, error)
+	SetMember(teamID string, userID string, role QPRole) error
+	RemoveMember(teamID string, userID string) error
+	Bots(teamID string) ([]string, error)
+	ShareBot(teamID string, botID string) error
+	UnshareBot(teamID string, botID string) error
+	FindBotRoles(userID string) ([]QPTeamBotRole, error)
+	RemoveBot(botID string) error
+	SetRequire2FA(teamID string, required bool) error
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrBotForbidden  = errors.New("your role does not allow this action on the bot")
+	ErrTeamForbidden = errors.New("your role does not allow this action on the team")
+	ErrTeamNotFound  = errors.New("team not found")
+)
+
+// Bot acessível ao usuário e o seu papel sobre ele
+type QPBotAccess struct {
+	QPBot
+	Role QPRole `json:"role"`
+}
+
+// Papel máximo concedido sobre os bots compartilhados, remover e compartilhar ficam com o dono do bot
+func sharedBotRole(teamRole QPRole) QPRole {
+	if teamRole.Allows(RoleAdmin) {
+		return RoleAdmin
+	}
+	return teamRole
+}
+
+// Papel do usuário sobre o bot, vazio caso não tenha acesso
+// O dono do bot é owner, os membros das equipes com quem foi compartilhado têm o papel da equipe
+func GetBotRole(userID string, bot QPBot) (role QPRole, err error) {
+	if bot.UserID == userID {
+		return RoleOwner, nil
+	}
+
+	roles, err := WhatsAppService.DB.Team.FindBotRoles(userID)
+	if err != nil {
+		return
+	}
+
+	for _, item := range roles {
+		if item.BotID == bot.ID && sharedBotRole(item.Role).rank() > role.rank() {
+			role = sharedBotRole(item.Role)
+		}
+	}
+	return
+}
+
+// Bot acessível ao usuário com, no mínimo, o papel exigido
+// Sem acesso algum o bot é tratado como inexistente
+func FindBotForUser(userID string, botID string, required QPRole) (access QPBotAccess, err error) {
+	bot, err := WhatsAppService.DB.Bot.FindByID(botID)
+	if err != nil {
+		return access, fmt.Errorf("bot '%s' not found", botID)
+	}
+
+	role, err := GetBotRole(userID, bot)
+	if err != nil {
+		return
+	}
+
+	if len(role) == 0 {
+		return access, fmt.Errorf("bot '%s' not found", botID)
+	}
+
+	access = QPBotAccess{bot, role}
+	if !role.Allows(required) {
+		return access, ErrBotForbidden
+	}
+	return
+}
+
+// Todos os bots que o usuário alcança, os próprios primeiro e depois os compartilhados
+func FindAllBotsForUser(userID string) (bots []QPBotAccess, err error) {
+	owned, err := WhatsAppService.DB.Bot.FindAllForUser(userID)
+	if err != nil {
+		return
+	}
+
+	bots = []QPBotAccess{}
+	for _, bot := range owned {
+		bots = append(bots, QPBotAccess{bot, RoleOwner})
+	}
+
+	roles, err := WhatsAppService.DB.Team.FindBotRoles(userID)
+	if err != nil {
+		return
+	}
+
+	shared := make(map[string]QPRole)
+	for _, item := range roles {
+		if role := sharedBotRole(item.Role); role.rank() > shared[item.BotID].rank() {
+			shared[item.BotID] = role
+		}
+	}
+
+	ids := []string{}
+	for botID := range shared {
+		ids = append(ids, botID)
+	}
+	sort.Strings(ids)
+
+	for _, botID := range ids {
+		bot, err := WhatsAppService.DB.Bot.FindByID(botID)
+		if err != nil || bot.UserID == userID {
+			continue
+		}
+		bots = append(bots, QPBotAccess{bot, shared[botID]})
+	}
+	return bots, nil
+}
+
+// Equipe com seus membros e bots, como exibida ao usuário
+type QPTeamDetails struct {
+	QPTeam
+	Role    QPRole         `json:"role"`
+	Members []QPTeamMember `json:"members"`
+	Bots    []string       `json:"bots"`
+}
+
+// Papel do usuário na equipe, ErrTeamNotFound caso não seja membro
+func GetTeamRole(userID string, teamID string) (role QPRole, err error) {
+	teams, err := WhatsAppService.DB.Team.FindAllForUser(userID)
+	if err != nil {
+		return
+	}
+
+	for _, team := range teams {
+		if team.ID == teamID {
+			return team.Role, nil
+		}
+	}
+	return role, ErrTeamNotFound
+}
+
+func requireTeamRole(userID string, teamID string, required QPRole) (QPRole, error) {
+	role, err := GetTeamRole(userID, teamID)
+	if err != nil {
+		return role, err
+	}
+
+	if !role.Allows(required) {
+		return role, ErrTeamForbidden
+	}
+	return role, nil
+}
+
+func CreateTeam(userID string, name string) (QPTeam, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return QPTeam{}, fmt.Errorf("team name is required")
+	}
+	return WhatsAppService.DB.Team.Create(name, userID)
+}
+
+// Equipe visível a qualquer membro
+func GetTeamDetails(userID string, teamID string) (details QPTeamDetails, err error) {
+	role, err := GetTeamRole(userID, teamID)
+	if err != nil {
+		return
+	}
+
+	team, err := WhatsAppService.DB.Team.FindByID(teamID)
+	if err != nil {
+		return
+	}
+
+	members, err := WhatsAppService.DB.Team.Members(teamID)
+	if err != nil {
+		return
+	}
+
+	bots, err := WhatsAppService.DB.Team.Bots(teamID)
+	if err != nil {
+		return
+	}
+
+	return QPTeamDetails{team, role, members, bots}, nil
+}
+
+// Somente os donos removem a equipe
+func DeleteTeam(userID string, teamID string) error {
+	if _, err := requireTeamRole(userID, teamID, RoleOwner); err != nil {
+		return err
+	}
+	return WhatsAppService.DB.Team.Delete(teamID)
+}
+
+// Inclui um usuário já cadastrado ou altera seu papel
+// Administradores gerenciam os demais papéis, somente os donos concedem ou alteram o papel de dono
+func SetTeamMember(userID string, teamID string, email string, role QPRole) (err error) {
+	actor, err := requireTeamRole(userID, teamID, RoleAdmin)
+	if err != nil {
+		return
+	}
+
+	member, err := WhatsAppService.DB.User.FindByEmail(strings.TrimSpace(email))
+	if err != nil {
+		return fmt.Errorf("user %s not found", email)
+	}
+
+	current, _ := GetTeamRole(member.ID, teamID)
+	if (role == RoleOwner || current == RoleOwner) && actor != RoleOwner {
+		return ErrTeamForbidden
+	}
+
+	if current == RoleOwner && role != RoleOwner {
+		if err = ensureAnotherOwner(teamID, member.ID); err != nil {
+			return
+		}
+	}
+
+	return WhatsAppService.DB.Team.SetMember(teamID, member.ID, role)
+}
+
+// Administradores removem os membros, somente os donos removem outros donos
+// Qualquer membro pode deixar a equipe
+func RemoveTeamMember(userID string, teamID string, memberID string) (err error) {
+	actor, err := GetTeamRole(userID, teamID)
+	if err != nil {
+		return
+	}
+
+	current, err := GetTeamRole(memberID, teamID)
+	if err != nil {
+		return fmt.Errorf("member not found")
+	}
+
+	if memberID != userID {
+		if !actor.Allows(RoleAdmin) || (current == RoleOwner && actor != RoleOwner) {
+			return ErrTeamForbidden
+		}
+	}
+
+	if current == RoleOwner {
+		if err = ensureAnotherOwner(teamID, memberID); err != nil {
+			return
+		}
+	}
+
+	return WhatsAppService.DB.Team.RemoveMember(teamID, memberID)
+}
+
+// A equipe não pode ficar sem dono
+func ensureAnotherOwner(teamID string, memberID string) error {
+	members, err := WhatsAppService.DB.Team.Members(teamID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.Role == RoleOwner && member.UserID != memberID {
+			return nil
+		}
+	}
+	return fmt.Errorf("the team must keep at least one owner")
+}
+
+// Compartilha um bot próprio com uma equipe que o usuário administra
+func ShareBotWithTeam(userID string, teamID string, botID string) (err error) {
+	if _, err = requireTeamRole(userID, teamID, RoleAdmin); err != nil {
+		return
+	}
+
+	if _, err = FindBotForUser(userID, botID, RoleOwner); err != nil {
+		return
+	}
+
+	return WhatsAppService.DB.Team.ShareBot(teamID, botID)
+}
+
+// Remove o compartilhamento, permitido aos administradores da equipe e ao dono do bot
+func UnshareBotFromTeam(userID string, teamID string, botID string) (err error) {
+	if _, err = requireTeamRole(userID, teamID, RoleAdmin); err != nil {
+		if _, ownerErr := FindBotForUser(userID, botID, RoleOwner); ownerErr != nil {
+			return
+		}
+	}
+
+	return WhatsAppService.DB.Team.UnshareBot(teamID, botID)
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type QPTeamMysql struct {
+	db *sqlx.DB
+}
+
+// Cria a equipe com o usuário informado como dono
+func (source QPTeamMysql) Create(name string, ownerID string) (team QPTeam, err error) {
+	teamID := uuid.New().String()
+	now := time.Now()
+
+	tx, err := source.db.Beginx()
+	if err != nil {
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO teams (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)", teamID, name, now, now); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO team_members (team_id, user_id, role, created_at) VALUES (?, ?, ?, ?)", teamID, ownerID, RoleOwner, now); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	return source.FindByID(teamID)
+}
+
+func (source QPTeamMysql) FindByID(ID string) (QPTeam, error) {
+	var team QPTeam
+	err := source.db.Get(&team, "SELECT * FROM teams WHERE id = ?", ID)
+	return team, err
+}
+
+func (source QPTeamMysql) FindAllForUser(userID string) ([]QPTeamMembership, error) {
+	teams := []QPTeamMembership{}
+	query := `SELECT teams.*, team_members.role FROM teams
+    JOIN team_members ON team_members.team_id = teams.id
+    WHERE team_members.user_id = ? ORDER BY teams.name`
+	err := source.db.Select(&teams, query, userID)
+	return teams, err
+}
+
+// Remove a equipe com seus membros e compartilhamentos
+func (source QPTeamMysql) Delete(ID string) (err error) {
+	tx, err := source.db.Beginx()
+	if err != nil {
+		return
+	}
+
+	for _, query := range []string{
+		"DELETE FROM team_bots WHERE team_id = ?",
+		"DELETE FROM team_members WHERE team_id = ?",
+		"DELETE FROM teams WHERE id = ?",
+	} {
+		if _, err = tx.Exec(query, ID); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+func (source QPTeamMysql) Members(teamID string) ([]QPTeamMember, error) {
+	members := []QPTeamMember{}
+	query := `SELECT team_members.team_id, team_members.user_id, users.email, team_members.role, team_members.created_at
+    FROM team_members JOIN users ON users.id = team_members.user_id
+    WHERE team_members.team_id = ? ORDER BY team_members.created_at`
+	err := source.db.Select(&members, query, teamID)
+	return members, err
+}
+
+// Inclui o membro ou altera seu papel
+func (source QPTeamMysql) SetMember(teamID string, userID string, role QPRole) (err error) {
+	tx, err := source.db.Beginx()
+	if err != nil {
+		return
+	}
+
+	if _, err = tx.Exec("DELETE FROM team_members WHERE team_id = ? AND user_id = ?", teamID, userID); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO team_members (team_id, user_id, role, created_at) VALUES (?, ?, ?, ?)", teamID, userID, role, time.Now()); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+func (source QPTeamMysql) RemoveMember(teamID string, userID string) error {
+	_, err := source.db.Exec("DELETE FROM team_members WHERE team_id = ? AND user_id = ?", teamID, userID)
+	return err
+}
+
+func (source QPTeamMysql) Bots(teamID string) ([]string, error) {
+	bots := []string{}
+	err := source.db.Select(&bots, "SELECT bot_id FROM team_bots WHERE team_id = ? ORDER BY bot_id", teamID)
+	return bots, err
+}
+
+func (source QPTeamMysql) ShareBot(teamID string, botID string) error {
+	var count int
+	err := source.db.Get(&count, "SELECT count(*) FROM team_bots WHERE team_id = ? AND bot_id = ?", teamID, botID)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = source.db.Exec("INSERT INTO team_bots (team_id, bot_id, created_at) VALUES (?, ?, ?)", teamID, botID, time.Now())
+	return err
+}
+
+func (source QPTeamMysql) UnshareBot(teamID string, botID string) error {
+	_, err := source.db.Exec("DELETE FROM team_bots WHERE team_id = ? AND bot_id = ?", teamID, botID)
+	return err
+}
+
+// Bots compartilhados com as equipes do usuário, um registro por equipe
+func (source QPTeamMysql) FindBotRoles(userID string) ([]QPTeamBotRole, error) {
+	roles := []QPTeamBotRole{}
+	query := `SELECT team_bots.bot_id, team_members.role FROM team_bots
+    JOIN team_members ON team_members.team_id = team_bots.team_id
+    WHERE team_members.user_id = ?`
+	err := source.db.Select(&roles, query, userID)
+	return roles, err
+}
+
+// Remove os compartilhamentos do bot, antes de apagá-lo
+func (source QPTeamMysql) RemoveBot(botID string) error {
+	_, err := source.db.Exec("DELETE FROM team_bots WHERE bot_id = ?", botID)
+	return err
+}
+
+func (source QPTeamMysql) SetRequire2FA(teamID string, required bool) error {
+	query := "UPDATE teams SET require_2fa = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, required, time.Now(), teamID)
+	return err
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type QPTeamPostgres struct {
+	db *sqlx.DB
+}
+
+// Cria a equipe com o usuário informado como dono
+func (source QPTeamPostgres) Create(name string, ownerID string) (team QPTeam, err error) {
+	teamID := uuid.New().String()
+	now := time.Now()
+
+	tx, err := source.db.Beginx()
+	if err != nil {
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO teams (id, name, created_at, updated_at) VALUES ($1, $2, $3, $4)", teamID, name, now, now); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO team_members (team_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)", teamID, ownerID, RoleOwner, now); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	return source.FindByID(teamID)
+}
+
+func (source QPTeamPostgres) FindByID(ID string) (QPTeam, error) {
+	var team QPTeam
+	err := source.db.Get(&team, "SELECT * FROM teams WHERE id = $1", ID)
+	return team, err
+}
+
+func (source QPTeamPostgres) FindAllForUser(userID string) ([]QPTeamMembership, error) {
+	teams := []QPTeamMembership{}
+	query := `SELECT teams.*, team_members.role FROM teams
+    JOIN team_members ON team_members.team_id = teams.id
+    WHERE team_members.user_id = $1 ORDER BY teams.name`
+	err := source.db.Select(&teams, query, userID)
+	return teams, err
+}
+
+// Remove a equipe com seus membros e compartilhamentos
+func (source QPTeamPostgres) Delete(ID string) (err error) {
+	tx, err := source.db.Beginx()
+	if err != nil {
+		return
+	}
+
+	for _, query := range []string{
+		"DELETE FROM team_bots WHERE team_id = $1",
+		"DELETE FROM team_members WHERE team_id = $1",
+		"DELETE FROM teams WHERE id = $1",
+	} {
+		if _, err = tx.Exec(query, ID); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+func (source QPTeamPostgres) Members(teamID string) ([]QPTeamMember, error) {
+	members := []QPTeamMember{}
+	query := `SELECT team_members.team_id, team_members.user_id, users.email, team_members.role, team_members.created_at
+    FROM team_members JOIN users ON users.id = team_members.user_id
+    WHERE team_members.team_id = $1 ORDER BY team_members.created_at`
+	err := source.db.Select(&members, query, teamID)
+	return members, err
+}
+
+// Inclui o membro ou altera seu papel
+func (source QPTeamPostgres) SetMember(teamID string, userID string, role QPRole) (err error) {
+	tx, err := source.db.Beginx()
+	if err != nil {
+		return
+	}
+
+	if _, err = tx.Exec("DELETE FROM team_members WHERE team_id = $1 AND user_id = $2", teamID, userID); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO team_members (team_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)", teamID, userID, role, time.Now()); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+func (source QPTeamPostgres) RemoveMember(teamID string, userID string) error {
+	_, err := source.db.Exec("DELETE FROM team_members WHERE team_id = $1 AND user_id = $2", teamID, userID)
+	return err
+}
+
+func (source QPTeamPostgres) Bots(teamID string) ([]string, error) {
+	bots := []string{}
+	err := source.db.Select(&bots, "SELECT bot_id FROM team_bots WHERE team_id = $1 ORDER BY bot_id", teamID)
+	return bots, err
+}
+
+func (source QPTeamPostgres) ShareBot(teamID string, botID string) error {
+	var count int
+	err := source.db.Get(&count, "SELECT count(*) FROM team_bots WHERE team_id = $1 AND bot_id = $2", teamID, botID)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = source.db.Exec("INSERT INTO team_bots (team_id, bot_id, created_at) VALUES ($1, $2, $3)", teamID, botID, time.Now())
+	return err
+}
+
+func (source QPTeamPostgres) UnshareBot(teamID string, botID string) error {
+	_, err := source.db.Exec("DELETE FROM team_bots WHERE team_id = $1 AND bot_id = $2", teamID, botID)
+	return err
+}
+
+// Bots compartilhados com as equipes do usuário, um registro por equipe
+func (source QPTeamPostgres) FindBotRoles(userID string) ([]QPTeamBotRole, error) {
+	roles := []QPTeamBotRole{}
+	query := `SELECT team_bots.bot_id, team_members.role FROM team_bots
+    JOIN team_members ON team_members.team_id = team_bots.team_id
+    WHERE team_members.user_id = $1`
+	err := source.db.Select(&roles, query, userID)
+	return roles, err
+}
+
+// Remove os compartilhamentos do bot, antes de apagá-lo
+func (source QPTeamPostgres) RemoveBot(botID string) error {
+	_, err := source.db.Exec("DELETE FROM team_bots WHERE bot_id = $1", botID)
+	return err
+}
+
+func (source QPTeamPostgres) SetRequire2FA(teamID string, required bool) error {
+	query := "UPDATE teams SET require_2fa = $1, updated_at = $2 WHERE id = $3"
+	_, err := source.db.Exec(query, required, time.Now(), teamID)
+	return err
+}
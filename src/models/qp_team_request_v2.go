@@ -0,0 +1,19 @@
+package models
+
+// Corpos das requisições de equipes da API de administração
+type QPTeamRequestV2 struct {
+	Name string `json:"name"`
+}
+
+type QPTeamMemberRequestV2 struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type QPTeamBotRequestV2 struct {
+	BotID string `json:"bot_id"`
+}
+
+type QPTeam2FARequestV2 struct {
+	Required bool `json:"required"`
+}
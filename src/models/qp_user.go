@@ -7,6 +7,29 @@ type QPUser struct {
 	Password  string `db:"password"`
 	CreatedAt string `db:"created_at"`
 	UpdatedAt string `db:"updated_at"`
+
+	// Recebe os eventos de conexão de todos os bots deste usuário
+	LifecycleWebHook string `db:"lifecyclewebhook"`
+
+	// Hash da chave de acesso à API de administração, vazio se nunca gerada
+	APIKey string `db:"apikey"`
+
+	// Usuário desabilitado não entra nem usa a API, seus bots continuam em funcionamento
+	Disabled bool `db:"disabled"`
+
+	// Administradores convidam, habilitam e desabilitam os demais usuários
+	Admin bool `db:"admin"`
+
+	// Hash do token de redefinição de senha (ou do convite) e sua validade em RFC3339 UTC
+	ResetToken   string `db:"reset_token"`
+	ResetExpires string `db:"reset_expires"`
+
+	// Segundo fator (TOTP), o segredo é gravado criptografado pelo chaveiro das sessões
+	// Enquanto não confirmado o segredo é somente uma tentativa de cadastro
+	TOTPSecret   string `db:"totp_secret"`
+	TOTPEnabled  bool   `db:"totp_enabled"`
+	TOTPRecovery string `db:"totp_recovery"`  // hashes dos códigos de recuperação, separados por vírgula
+	TOTPLastStep int64  `db:"totp_last_step"` // último intervalo aceito, impede reutilizar o mesmo código
 }
 
 type IQPUser interface {
@@ -16,4 +39,16 @@ type IQPUser interface {
 	Exists(email string) (bool, error)
 	Check(email string, password string) (QPUser, error)
 	Create(email string, password string) (QPUser, error)
+	SetLifecycleWebHook(ID string, url string) error
+	SetAPIKey(ID string, hash string) error
+	FindByAPIKey(hash string) (QPUser, error)
+	FindAll() ([]QPUser, error)
+	SetPassword(ID string, password string) error
+	SetDisabled(ID string, disabled bool) error
+	SetAdmin(ID string, admin bool) error
+	SetResetToken(ID string, hash string, expires string) error
+	FindByResetToken(hash string) (QPUser, error)
+	SetTOTP(ID string, secret string, enabled bool, recovery string) error
+	MarkTOTPStep(ID string, step int64) (bool, error)
+	ReplaceTOTPRecovery(ID string, previous string, recovery string) (bool, error)
 }
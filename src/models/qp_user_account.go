@@ -0,0 +1,295 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// Validade padrão dos links de redefinição de senha e dos convites
+const (
+	defaultPasswordResetExpiry = time.Hour
+	defaultInviteExpiry        = 72 * time.Hour
+)
+
+// Pedidos de redefinição de senha aceitos por hora, por email e por endereço de origem
+const (
+	defaultPasswordResetLimit   = 3
+	defaultPasswordResetLimitIP = 10
+)
+
+var (
+	ErrUserDisabled      = errors.New("user disabled")
+	ErrUserNotAdmin      = errors.New("only administrators can manage users")
+	ErrResetTokenInvalid = errors.New("invalid or expired link, request a new one")
+	ErrWebURLMissing     = errors.New("email links are not configured, contact an administrator")
+)
+
+// Limitador dos pedidos de redefinição de senha, para que não sirvam para lotar caixas de email
+var PasswordResetRateLimiter = NewQPRateLimiter()
+
+// Validade dos links de redefinição de senha (PASSWORDRESETEXPIRY, ex: 1h)
+func GetPasswordResetExpiry() time.Duration {
+	return getenvDuration("PASSWORDRESETEXPIRY", defaultPasswordResetExpiry)
+}
+
+// Validade dos convites (INVITEEXPIRY, ex: 72h)
+func GetInviteExpiry() time.Duration {
+	return getenvDuration("INVITEEXPIRY", defaultInviteExpiry)
+}
+
+func getenvDuration(key string, fallback time.Duration) time.Duration {
+	if s, err := getenvStr(key); err == nil {
+		if parsed, err := time.ParseDuration(s); err == nil && parsed > 0 {
+			return parsed
+		}
+		Log.WithComponent("users").Warnf("invalid %s %s, using %s", key, s, fallback)
+	}
+	return fallback
+}
+
+// Mesma exigência do cadastro inicial, pontuação mínima 1 do zxcvbn
+func CheckPasswordStrength(password string, inputs ...string) error {
+	if len(password) == 0 {
+		return fmt.Errorf("password is required")
+	}
+
+	res := zxcvbn.PasswordStrength(password, inputs)
+	if res.Score < 1 {
+		return fmt.Errorf("password is too weak, it could be cracked in %s", res.CrackTimeDisplay)
+	}
+	return nil
+}
+
+// Autentica o login, usuários desabilitados não entram
+func AuthenticateUser(email string, password string) (user QPUser, err error) {
+	user, err = WhatsAppService.DB.User.Check(email, password)
+	if err != nil {
+		return
+	}
+
+	if user.Disabled {
+		return user, ErrUserDisabled
+	}
+	return
+}
+
+// Troca a senha do usuário logado, confirmando a senha atual
+// As demais sessões do usuário são revogadas, somente a informada continua valendo
+func ChangePassword(user QPUser, current string, password string, keepSession string) (err error) {
+	if _, err = WhatsAppService.DB.User.Check(user.Email, current); err != nil {
+		return fmt.Errorf("current password is incorrect")
+	}
+
+	if err = CheckPasswordStrength(password, user.Email); err != nil {
+		return
+	}
+
+	if err = WhatsAppService.DB.User.SetPassword(user.ID, password); err != nil {
+		return
+	}
+
+	Log.WithComponent("users").Infof("password changed by %s", user.Email)
+	return RevokeUserSessions(user.ID, keepSession)
+}
+
+// Gera um token de uso único para o usuário, somente o hash é gravado
+func generateResetToken(userID string, expiry time.Duration) (token string, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	token = hex.EncodeToString(b)
+	expires := time.Now().UTC().Add(expiry).Format(time.RFC3339)
+	err = WhatsAppService.DB.User.SetResetToken(userID, HashAPIKey(token), expires)
+	return
+}
+
+// Consome um pedido de redefinição do endereço de origem e do email
+// (PASSWORDRESETLIMITIP, PASSWORDRESETLIMIT, por hora)
+func AllowPasswordReset(email string, address string) (bool, time.Duration) {
+	limit := getenvInt("PASSWORDRESETLIMITIP", defaultPasswordResetLimitIP)
+	if allowed, wait := PasswordResetRateLimiter.AllowPer(loginAddressKey(address), limit, time.Hour); !allowed {
+		return false, wait
+	}
+
+	limit = getenvInt("PASSWORDRESETLIMIT", defaultPasswordResetLimit)
+	return PasswordResetRateLimiter.AllowPer(loginAccountKey(email), limit, time.Hour)
+}
+
+// Erro dos pedidos de redefinição recusados pelo limite
+func PasswordResetLimitedError(wait time.Duration) error {
+	return fmt.Errorf("too many password reset requests, retry in %d seconds", RetryAfterSeconds(wait))
+}
+
+// Links enviados por email usam somente o endereço configurado, nunca o host da requisição
+func checkWebURL(baseURL string) error {
+	if len(baseURL) == 0 {
+		Log.WithComponent("users").Errorf("WEBURL is not set, refusing to email links")
+		return ErrWebURLMissing
+	}
+	return nil
+}
+
+// Envia o link de redefinição de senha, baseURL é o endereço público da interface web (WEBURL)
+// Emails desconhecidos ou desabilitados não retornam erro, para não revelar quais contas existem
+func RequestPasswordReset(email string, baseURL string) (err error) {
+	if err = checkWebURL(baseURL); err != nil {
+		return
+	}
+
+	logger := Log.WithComponent("users")
+	user, err := WhatsAppService.DB.User.FindByEmail(strings.TrimSpace(email))
+	if err != nil || user.Disabled {
+		logger.Warnf("password reset requested for an unknown or disabled user: %s", email)
+		return nil
+	}
+
+	expiry := GetPasswordResetExpiry()
+	token, err := generateResetToken(user.ID, expiry)
+	if err != nil {
+		return
+	}
+
+	body := fmt.Sprintf("A password reset was requested for your QuePasa account.\n\n"+
+		"Choose a new password at the link below, valid for %s:\n\n%s\n\n"+
+		"If you did not request it, ignore this message.", expiry, resetLink(baseURL, token))
+
+	if err = GetMailer().Send(user.Email, "QuePasa password reset", body); err != nil {
+		logger.WithError(err).Errorf("error sending password reset to %s", user.Email)
+		return fmt.Errorf("error sending the email, contact an administrator")
+	}
+	return
+}
+
+// Convida um novo usuário, que escolhe a sua senha pelo link enviado por email
+// Retorna o link, exibido ao administrador caso o email não possa ser enviado
+func InviteUser(inviter QPUser, email string, admin bool, baseURL string) (user QPUser, link string, err error) {
+	if !inviter.Admin {
+		return user, link, ErrUserNotAdmin
+	}
+
+	if err = checkWebURL(baseURL); err != nil {
+		return
+	}
+
+	email = strings.TrimSpace(email)
+	exists, err := WhatsAppService.DB.User.Exists(email)
+	if err != nil {
+		return
+	}
+
+	if exists {
+		return user, link, fmt.Errorf("user %s already exists", email)
+	}
+
+	// Senha aleatória, desconhecida até que o convite seja aceito
+	random := make([]byte, 24)
+	if _, err = rand.Read(random); err != nil {
+		return
+	}
+
+	user, err = WhatsAppService.DB.User.Create(email, hex.EncodeToString(random))
+	if err != nil {
+		return
+	}
+
+	if admin {
+		if err = WhatsAppService.DB.User.SetAdmin(user.ID, true); err != nil {
+			return
+		}
+		user.Admin = true
+	}
+
+	expiry := GetInviteExpiry()
+	token, err := generateResetToken(user.ID, expiry)
+	if err != nil {
+		return
+	}
+
+	link = resetLink(baseURL, token)
+	body := fmt.Sprintf("%s invited you to QuePasa.\n\n"+
+		"Choose your password at the link below, valid for %s:\n\n%s", inviter.Email, expiry, link)
+
+	logger := Log.WithComponent("users")
+	logger.Infof("user %s invited by %s", email, inviter.Email)
+	if err = GetMailer().Send(email, "QuePasa invitation", body); err != nil {
+		logger.WithError(err).Warnf("error sending invitation to %s", email)
+		return user, link, err
+	}
+	return user, link, nil
+}
+
+func resetLink(baseURL string, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/password/reset?token=" + token
+}
+
+// Usuário do link de redefinição, caso ainda válido
+func FindUserByResetToken(token string) (user QPUser, err error) {
+	if len(token) == 0 {
+		return user, ErrResetTokenInvalid
+	}
+
+	user, err = WhatsAppService.DB.User.FindByResetToken(HashAPIKey(token))
+	if err != nil || user.Disabled || user.ResetExpires <= time.Now().UTC().Format(time.RFC3339) {
+		return user, ErrResetTokenInvalid
+	}
+	return
+}
+
+// Define a nova senha pelo link de redefinição ou do convite, o link deixa de valer
+// Todas as sessões do usuário são revogadas
+func ResetPassword(token string, password string) (user QPUser, err error) {
+	user, err = FindUserByResetToken(token)
+	if err != nil {
+		return
+	}
+
+	if err = CheckPasswordStrength(password, user.Email); err != nil {
+		return
+	}
+
+	if err = WhatsAppService.DB.User.SetPassword(user.ID, password); err != nil {
+		return
+	}
+
+	Log.WithComponent("users").Infof("password reset by %s", user.Email)
+	err = RevokeUserSessions(user.ID, "")
+	return
+}
+
+// Habilita ou desabilita um usuário, administradores não desabilitam a si mesmos
+// Ao desabilitar, todas as sessões do usuário são revogadas
+func SetUserDisabled(actor QPUser, userID string, disabled bool) (err error) {
+	if !actor.Admin {
+		return ErrUserNotAdmin
+	}
+
+	if actor.ID == userID && disabled {
+		return fmt.Errorf("you can't disable yourself")
+	}
+
+	user, err := WhatsAppService.DB.User.FindByID(userID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+
+	if err = WhatsAppService.DB.User.SetDisabled(user.ID, disabled); err != nil {
+		return
+	}
+
+	if disabled {
+		if err = RevokeUserSessions(user.ID, ""); err != nil {
+			return
+		}
+	}
+
+	Log.WithComponent("users").Infof("user %s disabled: %v, by %s", user.Email, disabled, actor.Email)
+	return
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Header com a chave de acesso do usuário à API de administração
+const APIKeyHeader = "X-QUEPASA-APIKEY"
+
+// Prefixo das chaves geradas, facilita identificar vazamentos em logs e repositórios
+const apiKeyPrefix = "qpk_"
+
+type contextKey string
+
+// Usuário já autenticado pela chave de acesso, dispensa o JWT
+const userContextKey contextKey = "quepasa_user"
+
+// Somente o hash é gravado, a chave é exibida uma única vez ao ser gerada
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Gera uma nova chave de acesso para o usuário, invalidando a anterior
+func GenerateUserAPIKey(userID string) (key string, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	err = WhatsAppService.DB.User.SetAPIKey(userID, HashAPIKey(key))
+	return
+}
+
+// Usuário dono da chave de acesso informada
+func FindUserByAPIKey(key string) (user QPUser, err error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return user, fmt.Errorf("invalid api key")
+	}
+
+	user, err = WhatsAppService.DB.User.FindByAPIKey(HashAPIKey(key))
+	if err != nil {
+		return user, fmt.Errorf("invalid api key")
+	}
+
+	if user.Disabled {
+		return user, ErrUserDisabled
+	}
+	return
+}
+
+// Autentica a requisição pela chave de acesso no header, caso informada
+// Retorna a mesma requisição, com o usuário no contexto, para os próximos handlers
+func AuthenticateAPIKey(r *http.Request) (*http.Request, bool, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if len(key) == 0 {
+		return r, false, nil
+	}
+
+	user, err := FindUserByAPIKey(key)
+	if err != nil {
+		return r, true, err
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx), true, nil
+}
@@ -72,3 +72,100 @@ func (source QPUserMysql) Create(email string, password string) (QPUser, error)
 
 	return source.FindByID(userID)
 }
+
+func (source QPUserMysql) SetLifecycleWebHook(ID string, url string) error {
+	now := time.Now()
+	query := "UPDATE users SET lifecyclewebhook = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, url, now, ID)
+	return err
+}
+
+func (source QPUserMysql) SetAPIKey(ID string, hash string) error {
+	now := time.Now()
+	query := "UPDATE users SET apikey = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, hash, now, ID)
+	return err
+}
+
+func (source QPUserMysql) FindByAPIKey(hash string) (QPUser, error) {
+	var user QPUser
+	err := source.db.Get(&user, "SELECT * FROM users WHERE apikey = ?", hash)
+	return user, err
+}
+
+func (source QPUserMysql) FindAll() ([]QPUser, error) {
+	users := []QPUser{}
+	err := source.db.Select(&users, "SELECT * FROM users ORDER BY email")
+	return users, err
+}
+
+// Grava o hash da nova senha e invalida o token de redefinição pendente
+func (source QPUserMysql) SetPassword(ID string, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := "UPDATE users SET password = ?, reset_token = '', reset_expires = '', updated_at = ? WHERE id = ?"
+	_, err = source.db.Exec(query, string(hashed), now, ID)
+	return err
+}
+
+func (source QPUserMysql) SetDisabled(ID string, disabled bool) error {
+	now := time.Now()
+	query := "UPDATE users SET disabled = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, disabled, now, ID)
+	return err
+}
+
+func (source QPUserMysql) SetAdmin(ID string, admin bool) error {
+	now := time.Now()
+	query := "UPDATE users SET admin = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, admin, now, ID)
+	return err
+}
+
+func (source QPUserMysql) SetResetToken(ID string, hash string, expires string) error {
+	now := time.Now()
+	query := "UPDATE users SET reset_token = ?, reset_expires = ?, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, hash, expires, now, ID)
+	return err
+}
+
+func (source QPUserMysql) FindByResetToken(hash string) (QPUser, error) {
+	var user QPUser
+	err := source.db.Get(&user, "SELECT * FROM users WHERE reset_token = ? AND reset_token <> ''", hash)
+	return user, err
+}
+
+func (source QPUserMysql) SetTOTP(ID string, secret string, enabled bool, recovery string) error {
+	now := time.Now()
+	query := "UPDATE users SET totp_secret = ?, totp_enabled = ?, totp_recovery = ?, totp_last_step = 0, updated_at = ? WHERE id = ?"
+	_, err := source.db.Exec(query, secret, enabled, recovery, now, ID)
+	return err
+}
+
+// Aceita o intervalo somente se posterior ao último usado, false caso o código já tenha sido utilizado
+func (source QPUserMysql) MarkTOTPStep(ID string, step int64) (bool, error) {
+	query := "UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?"
+	result, err := source.db.Exec(query, step, ID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Troca os códigos de recuperação somente se não alterados desde a leitura, evita o uso duplo de um código
+func (source QPUserMysql) ReplaceTOTPRecovery(ID string, previous string, recovery string) (bool, error) {
+	query := "UPDATE users SET totp_recovery = ? WHERE id = ? AND totp_recovery = ?"
+	result, err := source.db.Exec(query, recovery, ID, previous)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
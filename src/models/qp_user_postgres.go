@@ -73,3 +73,100 @@ func (source QPUserPostgres) Create(email string, password string) (QPUser, erro
 
 	return source.FindByID(userID)
 }
+
+func (source QPUserPostgres) SetLifecycleWebHook(ID string, url string) error {
+	now := time.Now()
+	query := "UPDATE users SET lifecyclewebhook = $1, updated_at = $2 WHERE id = $3"
+	_, err := source.db.Exec(query, url, now, ID)
+	return err
+}
+
+func (source QPUserPostgres) SetAPIKey(ID string, hash string) error {
+	now := time.Now()
+	query := "UPDATE users SET apikey = $1, updated_at = $2 WHERE id = $3"
+	_, err := source.db.Exec(query, hash, now, ID)
+	return err
+}
+
+func (source QPUserPostgres) FindByAPIKey(hash string) (QPUser, error) {
+	var user QPUser
+	err := source.db.Get(&user, "SELECT * FROM users WHERE apikey = $1", hash)
+	return user, err
+}
+
+func (source QPUserPostgres) FindAll() ([]QPUser, error) {
+	users := []QPUser{}
+	err := source.db.Select(&users, "SELECT * FROM users ORDER BY email")
+	return users, err
+}
+
+// Grava o hash da nova senha e invalida o token de redefinição pendente
+func (source QPUserPostgres) SetPassword(ID string, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := "UPDATE users SET password = $1, reset_token = '', reset_expires = '', updated_at = $2 WHERE id = $3"
+	_, err = source.db.Exec(query, string(hashed), now, ID)
+	return err
+}
+
+func (source QPUserPostgres) SetDisabled(ID string, disabled bool) error {
+	now := time.Now()
+	query := "UPDATE users SET disabled = $1, updated_at = $2 WHERE id = $3"
+	_, err := source.db.Exec(query, disabled, now, ID)
+	return err
+}
+
+func (source QPUserPostgres) SetAdmin(ID string, admin bool) error {
+	now := time.Now()
+	query := "UPDATE users SET admin = $1, updated_at = $2 WHERE id = $3"
+	_, err := source.db.Exec(query, admin, now, ID)
+	return err
+}
+
+func (source QPUserPostgres) SetResetToken(ID string, hash string, expires string) error {
+	now := time.Now()
+	query := "UPDATE users SET reset_token = $1, reset_expires = $2, updated_at = $3 WHERE id = $4"
+	_, err := source.db.Exec(query, hash, expires, now, ID)
+	return err
+}
+
+func (source QPUserPostgres) FindByResetToken(hash string) (QPUser, error) {
+	var user QPUser
+	err := source.db.Get(&user, "SELECT * FROM users WHERE reset_token = $1 AND reset_token <> ''", hash)
+	return user, err
+}
+
+func (source QPUserPostgres) SetTOTP(ID string, secret string, enabled bool, recovery string) error {
+	now := time.Now()
+	query := "UPDATE users SET totp_secret = $1, totp_enabled = $2, totp_recovery = $3, totp_last_step = 0, updated_at = $4 WHERE id = $5"
+	_, err := source.db.Exec(query, secret, enabled, recovery, now, ID)
+	return err
+}
+
+// Aceita o intervalo somente se posterior ao último usado, false caso o código já tenha sido utilizado
+func (source QPUserPostgres) MarkTOTPStep(ID string, step int64) (bool, error) {
+	query := "UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $3"
+	result, err := source.db.Exec(query, step, ID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Troca os códigos de recuperação somente se não alterados desde a leitura, evita o uso duplo de um código
+func (source QPUserPostgres) ReplaceTOTPRecovery(ID string, previous string, recovery string) (bool, error) {
+	query := "UPDATE users SET totp_recovery = $1 WHERE id = $2 AND totp_recovery = $3"
+	result, err := source.db.Exec(query, recovery, ID, previous)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sessão web emitida no login, o id é o jti do JWT
+// Removida ao sair ou ao ser revogada, o JWT deixa de ser aceito mesmo antes de expirar
+type QPUserSession struct {
+	ID        string `db:"id" json:"id"`
+	UserID    string `db:"user_id" json:"-"`
+	Address   string `db:"address" json:"address"`
+	UserAgent string `db:"user_agent" json:"user_agent"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"` // RFC3339 UTC
+	LastSeen  string `db:"last_seen" json:"last_seen"`   // RFC3339 UTC, atualizado no máximo uma vez por minuto
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+type IQPUserSession interface {
+	Create(session QPUserSession) error
+	FindByID(ID string) (QPUserSession, error)
+	FindAllForUser(userID string) ([]QPUserSession, error)
+	Delete(userID string, ID string) error
+	DeleteForUser(userID string) error
+	Touch(ID string, lastSeen string) error
+	DeleteExpired(now string) error
+}
+
+// Validade padrão das sessões web
+const defaultSessionExpiry = 24 * time.Hour
+
+// Intervalo mínimo entre as atualizações do último acesso de uma sessão
+const sessionTouchInterval = time.Minute
+
+var ErrSessionInvalid = errors.New("session expired or revoked, please login again")
+
+// Validade das sessões web (SESSIONEXPIRY, ex: 24h)
+func GetSessionExpiry() time.Duration {
+	return getenvDuration("SESSIONEXPIRY", defaultSessionExpiry)
+}
+
+// Registra uma nova sessão para o usuário, o id gerado é usado como jti do JWT
+func CreateUserSession(user QPUser, address string, userAgent string) (session QPUserSession, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session = QPUserSession{
+		ID:        hex.EncodeToString(b),
+		UserID:    user.ID,
+		Address:   address,
+		UserAgent: userAgent,
+		ExpiresAt: now.Add(GetSessionExpiry()).Format(time.RFC3339),
+		LastSeen:  now.Format(time.RFC3339),
+	}
+
+	// Aproveita para descartar as sessões já expiradas de todos os usuários
+	if err := WhatsAppService.DB.UserSession.DeleteExpired(now.Format(time.RFC3339)); err != nil {
+		Log.WithComponent("users").WithError(err).Warnf("error removing expired sessions")
+	}
+
+	err = WhatsAppService.DB.UserSession.Create(session)
+	return
+}
+
+// Confirma que a sessão existe, pertence ao usuário e não expirou
+// Atualiza o último acesso no máximo uma vez por minuto
+func ValidateUserSession(userID string, ID string) (session QPUserSession, err error) {
+	if len(userID) == 0 || len(ID) == 0 {
+		return session, ErrSessionInvalid
+	}
+
+	session, err = WhatsAppService.DB.UserSession.FindByID(ID)
+	if err != nil || session.UserID != userID {
+		return session, ErrSessionInvalid
+	}
+
+	now := time.Now().UTC()
+	if session.ExpiresAt <= now.Format(time.RFC3339) {
+		return session, ErrSessionInvalid
+	}
+
+	if lastSeen, err := time.Parse(time.RFC3339, session.LastSeen); err != nil || now.Sub(lastSeen) >= sessionTouchInterval {
+		session.LastSeen = now.Format(time.RFC3339)
+		if err := WhatsAppService.DB.UserSession.Touch(session.ID, session.LastSeen); err != nil {
+			Log.WithComponent("users").WithError(err).Warnf("error updating session last seen")
+		}
+	}
+	return session, nil
+}
+
+// Sessões ativas do usuário, mais recentes primeiro
+func FindUserSessions(userID string) (sessions []QPUserSession, err error) {
+	all, err := WhatsAppService.DB.UserSession.FindAllForUser(userID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	sessions = []QPUserSession{}
+	for _, session := range all {
+		if session.ExpiresAt > now {
+			sessions = append(sessions, session)
+		}
+	}
+	return
+}
+
+// Revoga uma sessão do próprio usuário
+func RevokeUserSession(userID string, ID string) error {
+	return WhatsAppService.DB.UserSession.Delete(userID, ID)
+}
+
+// Revoga as sessões do usuário, exceto a informada, vazio revoga todas
+func RevokeUserSessions(userID string, except string) (err error) {
+	if len(except) == 0 {
+		return WhatsAppService.DB.UserSession.DeleteForUser(userID)
+	}
+
+	sessions, err := WhatsAppService.DB.UserSession.FindAllForUser(userID)
+	if err != nil {
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID != except {
+			if err = WhatsAppService.DB.UserSession.Delete(userID, session.ID); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Revoga todas as sessões de um usuário, somente administradores
+func RevokeAllUserSessions(actor QPUser, userID string) (err error) {
+	if !actor.Admin {
+		return ErrUserNotAdmin
+	}
+
+	user, err := WhatsAppService.DB.User.FindByID(userID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+
+	if err = RevokeUserSessions(user.ID, ""); err != nil {
+		return
+	}
+
+	Log.WithComponent("users").Infof("sessions of %s revoked by %s", user.Email, actor.Email)
+	return
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type QPUserSessionMysql struct {
+	db *sqlx.DB
+}
+
+func (source QPUserSessionMysql) Create(session QPUserSession) error {
+	query := `INSERT INTO user_sessions
+    (id, user_id, address, user_agent, expires_at, last_seen)
+    VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := source.db.Exec(query, session.ID, session.UserID, session.Address, session.UserAgent, session.ExpiresAt, session.LastSeen)
+	return err
+}
+
+func (source QPUserSessionMysql) FindByID(ID string) (QPUserSession, error) {
+	var session QPUserSession
+	err := source.db.Get(&session, "SELECT * FROM user_sessions WHERE id = ?", ID)
+	return session, err
+}
+
+func (source QPUserSessionMysql) FindAllForUser(userID string) ([]QPUserSession, error) {
+	sessions := []QPUserSession{}
+	err := source.db.Select(&sessions, "SELECT * FROM user_sessions WHERE user_id = ? ORDER BY created_at DESC", userID)
+	return sessions, err
+}
+
+func (source QPUserSessionMysql) Delete(userID string, ID string) error {
+	_, err := source.db.Exec("DELETE FROM user_sessions WHERE user_id = ? AND id = ?", userID, ID)
+	return err
+}
+
+func (source QPUserSessionMysql) DeleteForUser(userID string) error {
+	_, err := source.db.Exec("DELETE FROM user_sessions WHERE user_id = ?", userID)
+	return err
+}
+
+func (source QPUserSessionMysql) Touch(ID string, lastSeen string) error {
+	_, err := source.db.Exec("UPDATE user_sessions SET last_seen = ? WHERE id = ?", lastSeen, ID)
+	return err
+}
+
+// Remove as sessões expiradas, as datas em RFC3339 UTC são comparáveis como texto
+func (source QPUserSessionMysql) DeleteExpired(now string) error {
+	_, err := source.db.Exec("DELETE FROM user_sessions WHERE expires_at <= ?", now)
+	return err
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type QPUserSessionPostgres struct {
+	db *sqlx.DB
+}
+
+func (source QPUserSessionPostgres) Create(session QPUserSession) error {
+	query := `INSERT INTO user_sessions
+    (id, user_id, address, user_agent, expires_at, last_seen)
+    VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := source.db.Exec(query, session.ID, session.UserID, session.Address, session.UserAgent, session.ExpiresAt, session.LastSeen)
+	return err
+}
+
+func (source QPUserSessionPostgres) FindByID(ID string) (QPUserSession, error) {
+	var session QPUserSession
+	err := source.db.Get(&session, "SELECT * FROM user_sessions WHERE id = $1", ID)
+	return session, err
+}
+
+func (source QPUserSessionPostgres) FindAllForUser(userID string) ([]QPUserSession, error) {
+	sessions := []QPUserSession{}
+	err := source.db.Select(&sessions, "SELECT * FROM user_sessions WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	return sessions, err
+}
+
+func (source QPUserSessionPostgres) Delete(userID string, ID string) error {
+	_, err := source.db.Exec("DELETE FROM user_sessions WHERE user_id = $1 AND id = $2", userID, ID)
+	return err
+}
+
+func (source QPUserSessionPostgres) DeleteForUser(userID string) error {
+	_, err := source.db.Exec("DELETE FROM user_sessions WHERE user_id = $1", userID)
+	return err
+}
+
+func (source QPUserSessionPostgres) Touch(ID string, lastSeen string) error {
+	_, err := source.db.Exec("UPDATE user_sessions SET last_seen = $1 WHERE id = $2", lastSeen, ID)
+	return err
+}
+
+// Remove as sessões expiradas, as datas em RFC3339 UTC são comparáveis como texto
+func (source QPUserSessionPostgres) DeleteExpired(now string) error {
+	_, err := source.db.Exec("DELETE FROM user_sessions WHERE expires_at <= $1", now)
+	return err
+}
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Parâmetros do TOTP (RFC 6238), os padrões aceitos por todos os aplicativos autenticadores
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // intervalos aceitos antes e depois do atual, tolera relógios dessincronizados
+	totpRecoveryCodes = 10
+)
+
+var (
+	ErrTOTPInvalid     = errors.New("invalid two-factor code")
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication not enabled")
+)
+
+// Relógio do TOTP, substituído nos testes
+var totpNow = time.Now
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Tentativas do segundo fator por usuário, por minuto
+var TOTPRateLimiter = NewQPRateLimiter()
+
+const totpAttemptsPerMinute = 5
+
+// Código do intervalo informado, segredo em base32
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// Código válido no instante informado, segredo em base32
+func TOTPCode(secret string, at time.Time) (string, error) {
+	return totpCode(secret, at.Unix()/totpPeriod)
+}
+
+// Intervalo em que o código é válido, ok = false caso não corresponda a nenhum intervalo aceito
+func validateTOTP(secret string, code string) (step int64, ok bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return
+	}
+
+	current := totpNow().Unix() / totpPeriod
+	for step = current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Emissor exibido nos aplicativos autenticadores (TOTPISSUER)
+func GetTOTPIssuer() string {
+	if issuer, err := getenvStr("TOTPISSUER"); err == nil {
+		return issuer
+	}
+	return "QuePasa"
+}
+
+// Endereço otpauth:// lido pelos aplicativos autenticadores
+func TOTPURI(email string, secret string) string {
+	issuer := GetTOTPIssuer()
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(issuer), url.PathEscape(email), values.Encode())
+}
+
+// QR code do endereço otpauth://, PNG em base64
+func TOTPQRCode(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(png), nil
+}
+
+// O segredo é criptografado como as sessões, usando o id do usuário como dado autenticado
+func sealTOTPSecret(userID string, secret string) (string, error) {
+	sealed, err := GetSessionKeyring().Encrypt("totp:"+userID, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openTOTPSecret(user QPUser) (string, error) {
+	if len(user.TOTPSecret) == 0 {
+		return "", ErrTOTPNotEnrolled
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(user.TOTPSecret)
+	if err != nil {
+		return "", err
+	}
+
+	keyring := GetSessionKeyring()
+	if keyring.Unprotected(sealed) {
+		Log.WithComponent("crypto").WithField("user", user.ID).Warnf("unencrypted totp secret read with session encryption enabled")
+	}
+
+	secret, err := keyring.Decrypt("totp:"+user.ID, sealed)
+	return string(secret), err
+}
+
+// Inicia o cadastro do segundo fator com um novo segredo, ativado somente após a confirmação de um código
+// Retorna o segredo em base32, exibido ao usuário junto do QR code
+func BeginTOTPEnrollment(user QPUser) (secret string, err error) {
+	if user.TOTPEnabled {
+		return secret, fmt.Errorf("two-factor authentication already enabled")
+	}
+
+	key := make([]byte, 20)
+	if _, err = rand.Read(key); err != nil {
+		return
+	}
+
+	secret = totpEncoding.EncodeToString(key)
+	sealed, err := sealTOTPSecret(user.ID, secret)
+	if err != nil {
+		return
+	}
+
+	err = WhatsAppService.DB.User.SetTOTP(user.ID, sealed, false, "")
+	return
+}
+
+// Ativa o segundo fator com o primeiro código do aplicativo, retorna os códigos de recuperação
+func ConfirmTOTPEnrollment(user QPUser, code string) (codes []string, err error) {
+	secret, err := openTOTPSecret(user)
+	if err != nil {
+		return
+	}
+
+	step, ok := validateTOTP(secret, code)
+	if !ok {
+		return codes, ErrTOTPInvalid
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return
+	}
+
+	if err = WhatsAppService.DB.User.SetTOTP(user.ID, user.TOTPSecret, true, hashes); err != nil {
+		return
+	}
+
+	WhatsAppService.DB.User.MarkTOTPStep(user.ID, step)
+	Log.WithComponent("users").Infof("two-factor authentication enabled by %s", user.Email)
+	return
+}
+
+// Códigos de uso único para quando o aplicativo autenticador não estiver disponível
+func generateRecoveryCodes() (codes []string, hashes string, err error) {
+	list := []string{}
+	for i := 0; i < totpRecoveryCodes; i++ {
+		b := make([]byte, 5)
+		if _, err = rand.Read(b); err != nil {
+			return
+		}
+
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		list = append(list, HashAPIKey(code))
+	}
+	return codes, strings.Join(list, ","), nil
+}
+
+// Quantidade de códigos de recuperação ainda não utilizados
+func (user QPUser) RecoveryCodesLeft() int {
+	if len(user.TOTPRecovery) == 0 {
+		return 0
+	}
+	return len(strings.Split(user.TOTPRecovery, ","))
+}
+
+// Verifica o código do aplicativo ou um código de recuperação, que deixa de valer
+// Cada código do aplicativo é aceito uma única vez
+func VerifySecondFactor(user QPUser, code string) (err error) {
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+
+	if allowed, _ := TOTPRateLimiter.Allow(user.ID, totpAttemptsPerMinute); !allowed {
+		return fmt.Errorf("too many two-factor attempts, wait a minute")
+	}
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	if strings.Contains(code, "-") {
+		return useRecoveryCode(user, code)
+	}
+
+	secret, err := openTOTPSecret(user)
+	if err != nil {
+		return
+	}
+
+	step, ok := validateTOTP(secret, code)
+	if !ok {
+		return ErrTOTPInvalid
+	}
+
+	if ok, err = WhatsAppService.DB.User.MarkTOTPStep(user.ID, step); err != nil || !ok {
+		return ErrTOTPInvalid
+	}
+	return nil
+}
+
+func useRecoveryCode(user QPUser, code string) error {
+	hash := HashAPIKey(code)
+	remaining := []string{}
+	found := false
+	for _, item := range strings.Split(user.TOTPRecovery, ",") {
+		if len(item) > 0 && subtle.ConstantTimeCompare([]byte(item), []byte(hash)) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+
+	if !found {
+		return ErrTOTPInvalid
+	}
+
+	ok, err := WhatsAppService.DB.User.ReplaceTOTPRecovery(user.ID, user.TOTPRecovery, strings.Join(remaining, ","))
+	if err != nil || !ok {
+		return ErrTOTPInvalid
+	}
+
+	Log.WithComponent("users").Warnf("recovery code used by %s, %d left", user.Email, len(remaining))
+	return nil
+}
+
+// Novos códigos de recuperação, os anteriores deixam de valer
+func RegenerateRecoveryCodes(user QPUser, code string) (codes []string, err error) {
+	if strings.Contains(code, "-") {
+		return codes, fmt.Errorf("use a code from your authenticator app")
+	}
+
+	if err = VerifySecondFactor(user, code); err != nil {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return
+	}
+
+	_, err = WhatsAppService.DB.User.ReplaceTOTPRecovery(user.ID, user.TOTPRecovery, hashes)
+	return
+}
+
+// Desativa o segundo fator, não permitido enquanto exigido por alguma equipe
+func DisableTOTP(user QPUser, code string) (err error) {
+	if team, required := IsTOTPRequired(user.ID); required {
+		return fmt.Errorf("two-factor authentication is required by team %s", team)
+	}
+
+	if err = VerifySecondFactor(user, code); err != nil {
+		return
+	}
+
+	if err = WhatsAppService.DB.User.SetTOTP(user.ID, "", false, ""); err != nil {
+		return
+	}
+
+	Log.WithComponent("users").Infof("two-factor authentication disabled by %s", user.Email)
+	return
+}
+
+// Alguma equipe do usuário exige o segundo fator ? retorna o nome da equipe
+func IsTOTPRequired(userID string) (team string, required bool) {
+	teams, err := WhatsAppService.DB.Team.FindAllForUser(userID)
+	if err != nil {
+		Log.WithComponent("users").WithError(err).Errorf("error checking two-factor requirement")
+		return
+	}
+
+	for _, item := range teams {
+		if item.Require2FA {
+			return item.Name, true
+		}
+	}
+	return
+}
+
+// Usuário obrigado ao segundo fator que ainda não o cadastrou, somente o cadastro é permitido
+func RequiresTOTPEnrollment(user QPUser) bool {
+	if user.TOTPEnabled {
+		return false
+	}
+
+	_, required := IsTOTPRequired(user.ID)
+	return required
+}
+
+// Somente os donos alteram a exigência do segundo fator na equipe
+func SetTeamRequire2FA(userID string, teamID string, required bool) (err error) {
+	if _, err = requireTeamRole(userID, teamID, RoleOwner); err != nil {
+		return
+	}
+
+	if err = WhatsAppService.DB.Team.SetRequire2FA(teamID, required); err != nil {
+		return
+	}
+
+	Log.WithComponent("users").Infof("team %s two-factor requirement: %v", teamID, required)
+	return
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// Vetores da RFC 6238 (SHA1), truncados para 6 dígitos
+func TestTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, expected := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("error generating code: %s", err)
+		}
+		if code != expected {
+			t.Errorf("code at %d: expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	totpNow = func() time.Time { return now }
+	defer func() { totpNow = time.Now }()
+
+	previous, _ := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+	if step, ok := validateTOTP(secret, previous); !ok || step != now.Unix()/totpPeriod-1 {
+		t.Errorf("expected the previous code to be accepted, step %d", step)
+	}
+
+	old, _ := TOTPCode(secret, now.Add(-3*totpPeriod*time.Second))
+	if _, ok := validateTOTP(secret, old); ok {
+		t.Errorf("expected an old code to be rejected")
+	}
+
+	if _, ok := validateTOTP(secret, "12345"); ok {
+		t.Errorf("expected a short code to be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+)
+
+// Operações utilizadas sobre a conexão com o whatsapp
+// Permite substituir a conexão real por uma falsa nos testes
+type WhatsAppConnection interface {
+	Send(msg interface{}) (string, error)
+	RestoreWithSession(session whatsapp.Session) (whatsapp.Session, error)
+	Login(qrChan chan<- string) (whatsapp.Session, error)
+	AddHandler(handler whatsapp.Handler)
+	RemoveHandlers()
+	Disconnect() (whatsapp.Session, error)
+	LoadFullChatHistory(jid string, chunkSize int, pause time.Duration, handlers ...whatsapp.Handler)
+	SubscribePresence(jid string) (<-chan string, error)
+
+	// Contatos e conversas em cache
+	Store() *whatsapp.Store
+
+	// Informações do celular conectado, nulo antes de autenticar
+	Info() *whatsapp.Info
+}
+
+// Construtor das conexões do sistema, substituível nos testes
+var NewWhatsAppConnection = CreateConnection
+
+// Adaptador da conexão real da biblioteca do whatsapp
+type QPWhatsAppConnection struct {
+	Conn *whatsapp.Conn
+}
+
+func (con *QPWhatsAppConnection) Send(msg interface{}) (string, error) {
+	return con.Conn.Send(msg)
+}
+
+func (con *QPWhatsAppConnection) RestoreWithSession(session whatsapp.Session) (whatsapp.Session, error) {
+	return con.Conn.RestoreWithSession(session)
+}
+
+func (con *QPWhatsAppConnection) Login(qrChan chan<- string) (whatsapp.Session, error) {
+	return con.Conn.Login(qrChan)
+}
+
+func (con *QPWhatsAppConnection) AddHandler(handler whatsapp.Handler) {
+	con.Conn.AddHandler(handler)
+}
+
+func (con *QPWhatsAppConnection) RemoveHandlers() {
+	con.Conn.RemoveHandlers()
+}
+
+func (con *QPWhatsAppConnection) Disconnect() (whatsapp.Session, error) {
+	return con.Conn.Disconnect()
+}
+
+func (con *QPWhatsAppConnection) LoadFullChatHistory(jid string, chunkSize int, pause time.Duration, handlers ...whatsapp.Handler) {
+	con.Conn.LoadFullChatHistory(jid, chunkSize, pause, handlers...)
+}
+
+func (con *QPWhatsAppConnection) SubscribePresence(jid string) (<-chan string, error) {
+	return con.Conn.SubscribePresence(jid)
+}
+
+func (con *QPWhatsAppConnection) Store() *whatsapp.Store {
+	return con.Conn.Store
+}
+
+func (con *QPWhatsAppConnection) Info() *whatsapp.Info {
+	return con.Conn.Info
+}
@@ -0,0 +1,329 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+)
+
+// Conexão falsa, em memória, sem celular nem whatsapp, usada pelos testes e pelos bots simulados
+// Permite roteirizar mensagens recebidas, erros e histórico das conversas
+type QPFakeConnection struct {
+	// Retornados pelas chamadas correspondentes, quando definidos
+	RestoreError    error
+	LoginError      error
+	DisconnectError error
+
+	// Texto entregue ao canal do QRCode durante o Login
+	QRCode string
+
+	// Quando definido, a restauração aguarda o canal ser fechado
+	RestoreWait chan struct{}
+
+	sync          *sync.Mutex
+	handlers      []whatsapp.Handler
+	sent          []interface{}
+	sentIDs       []string
+	sendErrors    []error
+	subscriptions []string
+	history       map[string][]interface{}
+	session       whatsapp.Session
+	store         *whatsapp.Store
+	info          *whatsapp.Info
+	connected     bool
+	sequence      int
+}
+
+// Quantidade máxima de mensagens enviadas mantidas, as mais antigas são descartadas
+const fakeSentLength = 1000
+
+// Nova conexão falsa, já autenticada com o wid informado
+func NewQPFakeConnection(wid string) *QPFakeConnection {
+	return &QPFakeConnection{
+		QRCode:  "fake-qrcode",
+		sync:    &sync.Mutex{},
+		history: make(map[string][]interface{}),
+		session: whatsapp.Session{ClientToken: "fake-client-token", Wid: wid},
+		store: &whatsapp.Store{
+			Contacts: make(map[string]whatsapp.Contact),
+			Chats:    make(map[string]whatsapp.Chat),
+		},
+		info:      &whatsapp.Info{Wid: wid, Battery: 100, Platform: "fake", Connected: true},
+		connected: true,
+	}
+}
+
+// Programa um erro para o próximo envio, os erros são consumidos na ordem em que foram programados
+func (con *QPFakeConnection) ScriptSendError(err error) {
+	con.sync.Lock()
+	con.sendErrors = append(con.sendErrors, err)
+	con.sync.Unlock()
+}
+
+// Mensagens já enviadas com sucesso, na ordem de envio
+func (con *QPFakeConnection) Sent() []interface{} {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+	return append([]interface{}{}, con.sent...)
+}
+
+// Ids retornados para as mensagens enviadas, na mesma ordem de Sent
+func (con *QPFakeConnection) SentIDs() []string {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+	return append([]string{}, con.sentIDs...)
+}
+
+// Mensagens enviadas e os seus ids, lidos na mesma trava
+func (con *QPFakeConnection) SentWithIDs() (sent []interface{}, ids []string) {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+	return append([]interface{}{}, con.sent...), append([]string{}, con.sentIDs...)
+}
+
+// Retorna e descarta as mensagens enviadas, junto com os seus ids
+func (con *QPFakeConnection) TakeSent() (sent []interface{}, ids []string) {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+
+	sent, ids = con.sent, con.sentIDs
+	con.sent, con.sentIDs = nil, nil
+	return
+}
+
+// Contatos inscritos para atualizações de presença
+func (con *QPFakeConnection) Subscriptions() []string {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+	return append([]string{}, con.subscriptions...)
+}
+
+// Inclui um contato no cache, utilizado para os titulos
+func (con *QPFakeConnection) AddContact(contact whatsapp.Contact) {
+	con.sync.Lock()
+	con.store.Contacts[contact.Jid] = contact
+	con.sync.Unlock()
+}
+
+// Mensagens entregues pelo LoadFullChatHistory desta conversa
+func (con *QPFakeConnection) AddHistory(jid string, messages ...interface{}) {
+	con.sync.Lock()
+	con.history[jid] = append(con.history[jid], messages...)
+	con.sync.Unlock()
+}
+
+// Entrega uma mensagem recebida aos handlers registrados, de forma síncrona
+func (con *QPFakeConnection) Receive(message interface{}) {
+	dispatchFakeMessage(con.getHandlers(), message)
+}
+
+// Entrega um erro de conexão aos handlers registrados, de forma síncrona
+func (con *QPFakeConnection) Fail(err error) {
+	for _, handler := range con.getHandlers() {
+		handler.HandleError(err)
+	}
+}
+
+func (con *QPFakeConnection) IsConnected() bool {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+	return con.connected
+}
+
+func (con *QPFakeConnection) getHandlers() []whatsapp.Handler {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+	return append([]whatsapp.Handler{}, con.handlers...)
+}
+
+func (con *QPFakeConnection) Send(msg interface{}) (string, error) {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+
+	if len(con.sendErrors) > 0 {
+		err := con.sendErrors[0]
+		con.sendErrors = con.sendErrors[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !con.connected {
+		return "", whatsapp.ErrNotConnected
+	}
+
+	con.sequence++
+	messageID := fmt.Sprintf("FAKE%016d", con.sequence)
+	con.sent = append(con.sent, msg)
+	con.sentIDs = append(con.sentIDs, messageID)
+	if len(con.sent) > fakeSentLength {
+		con.sent = con.sent[len(con.sent)-fakeSentLength:]
+		con.sentIDs = con.sentIDs[len(con.sentIDs)-fakeSentLength:]
+	}
+	return messageID, nil
+}
+
+func (con *QPFakeConnection) RestoreWithSession(session whatsapp.Session) (whatsapp.Session, error) {
+	if con.RestoreWait != nil {
+		<-con.RestoreWait
+	}
+
+	if con.RestoreError != nil {
+		return session, con.RestoreError
+	}
+
+	con.sync.Lock()
+	con.session = session
+	con.connected = true
+	con.sync.Unlock()
+	return session, nil
+}
+
+func (con *QPFakeConnection) Login(qrChan chan<- string) (whatsapp.Session, error) {
+	qrChan <- con.QRCode
+	if con.LoginError != nil {
+		return whatsapp.Session{}, con.LoginError
+	}
+
+	con.sync.Lock()
+	con.connected = true
+	session := con.session
+	con.sync.Unlock()
+	return session, nil
+}
+
+func (con *QPFakeConnection) AddHandler(handler whatsapp.Handler) {
+	con.sync.Lock()
+	con.handlers = append(con.handlers, handler)
+	con.sync.Unlock()
+}
+
+func (con *QPFakeConnection) RemoveHandlers() {
+	con.sync.Lock()
+	con.handlers = nil
+	con.sync.Unlock()
+}
+
+func (con *QPFakeConnection) Disconnect() (whatsapp.Session, error) {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+
+	if !con.connected {
+		return con.session, whatsapp.ErrNotConnected
+	}
+
+	con.connected = false
+	return con.session, con.DisconnectError
+}
+
+func (con *QPFakeConnection) LoadFullChatHistory(jid string, chunkSize int, pause time.Duration, handlers ...whatsapp.Handler) {
+	if chunkSize <= 0 {
+		return
+	}
+
+	if handlers == nil {
+		handlers = con.getHandlers()
+	}
+
+	con.sync.Lock()
+	messages := append([]interface{}{}, con.history[jid]...)
+	con.sync.Unlock()
+
+	for _, message := range messages {
+		dispatchFakeMessage(handlers, message)
+	}
+}
+
+func (con *QPFakeConnection) SubscribePresence(jid string) (<-chan string, error) {
+	con.sync.Lock()
+	defer con.sync.Unlock()
+
+	if !con.connected {
+		return nil, whatsapp.ErrNotConnected
+	}
+
+	con.subscriptions = append(con.subscriptions, jid)
+	response := make(chan string, 1)
+	response <- `{"status":200}`
+	return response, nil
+}
+
+func (con *QPFakeConnection) Store() *whatsapp.Store {
+	return con.store
+}
+
+func (con *QPFakeConnection) Info() *whatsapp.Info {
+	return con.info
+}
+
+// Mesma distribuição por tipo realizada pela biblioteca do whatsapp
+func dispatchFakeMessage(handlers []whatsapp.Handler, message interface{}) {
+	for _, handler := range handlers {
+		switch msg := message.(type) {
+		case error:
+			handler.HandleError(msg)
+		case string:
+			if h, ok := handler.(whatsapp.JsonMessageHandler); ok {
+				h.HandleJsonMessage(msg)
+			}
+		case whatsapp.TextMessage:
+			if h, ok := handler.(whatsapp.TextMessageHandler); ok {
+				h.HandleTextMessage(msg)
+			}
+		case whatsapp.ImageMessage:
+			if h, ok := handler.(whatsapp.ImageMessageHandler); ok {
+				h.HandleImageMessage(msg)
+			}
+		case whatsapp.AudioMessage:
+			if h, ok := handler.(whatsapp.AudioMessageHandler); ok {
+				h.HandleAudioMessage(msg)
+			}
+		case whatsapp.DocumentMessage:
+			if h, ok := handler.(whatsapp.DocumentMessageHandler); ok {
+				h.HandleDocumentMessage(msg)
+			}
+		case whatsapp.LocationMessage:
+			if h, ok := handler.(whatsapp.LocationMessageHandler); ok {
+				h.HandleLocationMessage(msg)
+			}
+		case whatsapp.LiveLocationMessage:
+			if h, ok := handler.(whatsapp.LiveLocationMessageHandler); ok {
+				h.HandleLiveLocationMessage(msg)
+			}
+		case whatsapp.ContactMessage:
+			if h, ok := handler.(whatsapp.ContactMessageHandler); ok {
+				h.HandleContactMessage(msg)
+			}
+		case whatsapp.BatteryMessage:
+			if h, ok := handler.(whatsapp.BatteryMessageHandler); ok {
+				h.HandleBatteryMessage(msg)
+			}
+		case whatsapp.Contact:
+			if h, ok := handler.(whatsapp.NewContactHandler); ok {
+				h.HandleNewContact(msg)
+			}
+		}
+	}
+}
+
+// Registra no serviço um servidor pronto sobre a conexão falsa, sem banco de dados nem whatsapp
+// *Usado somente pelos testes
+func AppendFakeServer(bot QPBot, con *QPFakeConnection) *QPWhatsAppServer {
+	if WhatsAppService == nil {
+		WhatsAppService = &QPWhatsAppService{Servers: NewQPServerRegistry()}
+	}
+
+	server := newWhatsAppServer(bot, con)
+	server.Handlers = QPMessageHandler{&server.Bot, true, &server, false}
+	con.AddHandler(&server.Handlers)
+
+	for _, state := range []QPConnectionState{Starting, Connected, Fetching, Ready} {
+		server.State.Transition(state, "fake connection")
+	}
+
+	WhatsAppService.Servers.Remove(bot.ID)
+	WhatsAppService.Servers.Add(&server)
+	return &server
+}
@@ -2,11 +2,18 @@ package models
 
 import (
 	"encoding/base64"
+	"errors"
 	"strings"
 
 	wa "github.com/Rhymen/go-whatsapp"
 )
 
+// Erros do download de anexos, respondidos como não encontrado pela API
+var (
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrAttachmentNotFound = errors.New("message without attachment")
+)
+
 // Mensagem no formato QuePasa
 // Utilizada na API do QuePasa para troca com outros sistemas
 type QPAttachment struct {
@@ -16,6 +23,9 @@ type QPAttachment struct {
 	MIME        string `json:"mime,omitempty"`
 	Base64      string `json:"base64,omitempty"`
 	FileName    string `json:"filename,omitempty"`
+
+	// Url estável no armazenamento permanente, quando o arquivamento estiver habilitado
+	StorageUrl string `json:"storageurl,omitempty"`
 }
 
 // Traz o MediaType para download do whatsapp
@@ -42,3 +52,12 @@ func (m QPAttachment) WAMediaType() wa.MediaType {
 func (m QPAttachment) MediaKey() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(m.B64MediaKey)
 }
+
+// Baixa e descriptografa o conteúdo apartir do CDN do whatsapp
+func (m QPAttachment) Download() ([]byte, error) {
+	mediaKey, err := m.MediaKey()
+	if err != nil {
+		return nil, err
+	}
+	return wa.Download(m.Url, mediaKey, m.WAMediaType(), m.Length)
+}
@@ -2,9 +2,6 @@ package models
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
-	"strings"
 	"time"
 
 	whatsapp "github.com/Rhymen/go-whatsapp"
@@ -14,104 +11,87 @@ type QPMessageHandler struct {
 	Bot         *QPBot
 	Synchronous bool
 	Server      *QPWhatsAppServer
+
+	// Mensagens do histórico, carregadas ao conectar, não contam como recebidas
+	History bool
 }
 
 // Essencial
 // Unico item realmente necessario para o sistema do whatsapp funcionar
 // Trata qualquer erro que influêncie no recebimento de msgs
 func (h *QPMessageHandler) HandleError(publicError error) {
-	if e, ok := publicError.(*whatsapp.ErrConnectionFailed); ok {
-		// Erros comuns de desconexão por qualquer motivo aleatório
-		if strings.Contains(e.Err.Error(), "close 1006") {
-			// 1006 falha no websocket, informações inválidas, provavelmente baixa qualidade de internet no celular
-			log.Printf("(%s) Websocket corrupted (probably poor connection quality), should restart ...", h.Server.Bot.GetNumber())
-			go h.Server.Restart()
-		} else if strings.Contains(e.Err.Error(), "connection reset by peer") {
-			// Possível falha no keep alive, muito tempo sem tráfego
-			log.Printf("(%s) Websocket corrupted (probably inactive), should restart ...", h.Server.Bot.GetNumber())
-			go h.Server.Restart()
-		} else {
-			log.Printf("(%s) SUFF ERROR B :: %v", h.Server.Bot.GetNumber(), e.Err)
-		}
-		return
-	} else if strings.Contains(publicError.Error(), "code: 1000") {
-		// Desconexão forçado é algum evento iniciado pelo whatsapp
-		log.Printf("(%s) Desconexão forçada pelo whatsapp, code: 1000", h.Server.Bot.GetNumber())
-		// Se houve desconexão, reseta
-		go h.Server.Restart()
-		return
-	} else if strings.Contains(publicError.Error(), "close 1006") {
-		// Desconexão forçado é algum evento iniciado pelo whatsapp
-		log.Printf("(%s) Desconexão por falha no websocket, code: 1006, iremos reiniciar automaticamente", h.Server.Bot.GetNumber())
-		// Se houve desconexão, reseta
-		go h.Server.Restart()
-		return
-	} else if strings.Contains(publicError.Error(), "keepAlive failed") {
-		if *h.Server.Status == "ready" {
-			*h.Server.Status = "unreachable"
-		}
-
-		// Se houve desconexão, reseta
-		log.Printf("(%s) Keep alive failed, waiting ...", h.Server.Bot.GetNumber())
-		// go h.Server.Restart()
-		return
-	} else if strings.Contains(publicError.Error(), "server closed connection") {
-		// Se houve desconexão, reseta
-		log.Printf("(%s) Server closed connection, restarting ...", h.Server.Bot.GetNumber())
-		go h.Server.Restart()
-		return
-	} else if strings.Contains(publicError.Error(), "message type not implemented") {
+	h.Server.Health.Error(publicError)
+	kind := ClassifyConnectionError(publicError)
+	switch {
+	case kind.ShouldRestart():
+		// Erros comuns de desconexão por qualquer motivo aleatório, inclusive forçados pelo whatsapp
+		h.Server.Log.WithField("kind", kind).WithError(publicError).Warnf("connection lost, restarting")
+		go h.Server.Restart(string(kind))
+	case kind == ErrorKeepAliveFailed:
+		// Celular sem responder, aguardamos o retorno do tráfego
+		h.Server.State.TransitionFrom([]QPConnectionState{Ready}, Unreachable, publicError.Error())
+		h.Server.Log.Warnf("keep alive failed, waiting")
+	case kind == ErrorNotImplemented:
 		// Ignorando, nova implementação com Handlers não criados ainda
-		return
-	} else {
-		log.Printf("(%s) SUFF ERROR D :: %s", h.Server.Bot.GetNumber(), publicError)
+	default:
+		h.Server.Log.WithField("kind", kind).WithError(publicError).Errorf("unhandled connection error")
 	}
 }
 
 func (h *QPMessageHandler) HandleJsonMessage(msgString string) {
+	// Se voltou a ter tráfego, o celular está acessível novamente
+	h.Server.State.TransitionFrom([]QPConnectionState{Unreachable}, Ready, "traffic resumed")
+
+	// Atualizações de presença dos contatos assinados
+	if presence, ok := ParsePresenceMessage(msgString); ok {
+		h.Server.Log.Debugf("presence :: %s :: %s", presence.ID, presence.Type)
+		h.Server.AppendPresence(presence)
+		return
+	}
+
 	var waJsonMessage WhatsAppJsonMessage
 	err := json.Unmarshal([]byte(msgString), &waJsonMessage)
 	if err == nil {
 		if waJsonMessage.Cmd.Type == "disconnect" {
 			// Restarting because an order of whatsapp
-			log.Printf("(%s) Restart Order by: %s", h.Bot.GetNumber(), waJsonMessage.Cmd.Kind)
-			go h.Server.Restart()
+			h.Server.Log.WithField("kind", waJsonMessage.Cmd.Kind).Infof("disconnect ordered by whatsapp")
+			go h.Server.Restart("disconnect_order")
 		} else {
-			if h.Server.IsDevelopment() {
-				log.Printf("(%s)(DEV) JSON Unmarshal string :: %s", h.Server.Bot.GetNumber(), msgString)
-				log.Printf("(%s)(DEV) JSON Unmarshal :: %s", h.Server.Bot.GetNumber(), waJsonMessage)
-			}
+			h.Server.Log.Debugf("json unmarshal string :: %s", msgString)
+			h.Server.Log.Debugf("json unmarshal :: %v", waJsonMessage)
 		}
 	} else {
-		if h.Server.IsDevelopment() && ENV.DEBUGJsonMessages() {
-			log.Printf("(%s)(DEV) JSON :: %s", h.Server.Bot.GetNumber(), msgString)
+		if ENV.DEBUGJsonMessages() {
+			h.Server.Log.Debugf("json :: %s", msgString)
 		}
 	}
 }
 
 /// Atualizando informações sobre a bateria
 func (h *QPMessageHandler) HandleBatteryMessage(msg whatsapp.BatteryMessage) {
+	previous := *h.Server.Battery
 	h.Server.Battery.Timestamp = time.Now()
 	h.Server.Battery.Plugged = msg.Plugged
 	h.Server.Battery.Percentage = msg.Percentage
 	h.Server.Battery.Powersave = msg.Powersave
+
+	observeBattery(h.Server.GetBot(), *h.Server.Battery)
+	h.Server.checkBattery(previous, *h.Server.Battery)
 }
 
 func (h *QPMessageHandler) HandleNewContact(contact whatsapp.Contact) {
-	if h.Server.IsDevelopment() {
-		log.Printf("(%s)(DEV) NEWCONTACT :: %#v\n", h.Bot.GetNumber(), contact)
-	}
+	h.Server.Log.Debugf("new contact :: %#v", contact)
 }
 
 func (h *QPMessageHandler) HandleInfoMessage(msg whatsapp.MessageInfo) {
 	if h.Server.IsDevelopment() {
 		b, err := json.Marshal(msg)
 		if err != nil {
-			fmt.Println(err)
+			h.Server.Log.WithError(err).Debugf("error marshaling info message")
 			return
 		}
 
-		log.Printf("(%s)(DEV) INFO :: %#v\n", h.Bot.GetNumber(), string(b))
+		h.Server.Log.Debugf("info :: %s", string(b))
 	}
 }
 
@@ -124,7 +104,7 @@ func (h *QPMessageHandler) HandleImageMessage(msg whatsapp.ImageMessage) {
 	message.FillImageAttachment(msg, h.Server.Connection)
 	//  <--
 
-	h.Server.AppenMsgToCache(message)
+	h.received(message, "image")
 }
 
 func (h *QPMessageHandler) HandleLocationMessage(msg whatsapp.LocationMessage) {
@@ -135,7 +115,7 @@ func (h *QPMessageHandler) HandleLocationMessage(msg whatsapp.LocationMessage) {
 	message.Text = "Localização recebida ... "
 	//  <--
 
-	h.Server.AppenMsgToCache(message)
+	h.received(message, "location")
 }
 
 func (h *QPMessageHandler) HandleLiveLocationMessage(msg whatsapp.LiveLocationMessage) {
@@ -146,7 +126,7 @@ func (h *QPMessageHandler) HandleLiveLocationMessage(msg whatsapp.LiveLocationMe
 	message.Text = "Localização em tempo real recebida ... "
 	//  <--
 
-	h.Server.AppenMsgToCache(message)
+	h.received(message, "livelocation")
 }
 
 func (h *QPMessageHandler) HandleDocumentMessage(msg whatsapp.DocumentMessage) {
@@ -160,7 +140,7 @@ func (h *QPMessageHandler) HandleDocumentMessage(msg whatsapp.DocumentMessage) {
 	message.FillDocumentAttachment(msg, h.Server.Connection)
 	//  <--
 
-	h.Server.AppenMsgToCache(message)
+	h.received(message, "document")
 }
 
 func (h *QPMessageHandler) HandleContactMessage(msg whatsapp.ContactMessage) {
@@ -171,7 +151,7 @@ func (h *QPMessageHandler) HandleContactMessage(msg whatsapp.ContactMessage) {
 	message.Text = "Contato VCARD recebido ... "
 	//  <--
 
-	h.Server.AppenMsgToCache(message)
+	h.received(message, "contact")
 }
 
 func (h *QPMessageHandler) HandleAudioMessage(msg whatsapp.AudioMessage) {
@@ -183,7 +163,7 @@ func (h *QPMessageHandler) HandleAudioMessage(msg whatsapp.AudioMessage) {
 	message.FillAudioAttachment(msg, h.Server.Connection)
 	//  <--
 
-	h.Server.AppenMsgToCache(message)
+	h.received(message, "audio")
 }
 
 func (h *QPMessageHandler) HandleTextMessage(msg whatsapp.TextMessage) {
@@ -194,6 +174,15 @@ func (h *QPMessageHandler) HandleTextMessage(msg whatsapp.TextMessage) {
 	message.Text = msg.Text
 	//  <--
 
+	h.received(message, "text")
+}
+
+// Salva em cache, somente as mensagens recebidas em tempo real entram nas métricas e na saúde
+func (h *QPMessageHandler) received(message QPMessage, msgType string) {
+	if !h.History {
+		observeMessageReceived(h.Server.GetBot(), msgType)
+		h.Server.Health.MessageReceived()
+	}
 	h.Server.AppenMsgToCache(message)
 }
 
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	whatsapp "github.com/Rhymen/go-whatsapp"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	testBotID     = "5521999990000@c.us"
+	testRecipient = "5521988887777@s.whatsapp.net"
+)
+
+func newHandlerTestServer(t *testing.T) (*QPWhatsAppServer, *QPFakeConnection) {
+	con := NewQPFakeConnection(testBotID)
+	con.AddContact(whatsapp.Contact{Jid: testRecipient, Name: "Fulano"})
+	server := AppendFakeServer(QPBot{ID: testBotID, TokenHash: HashAPIKey("test-token")}, con)
+	t.Cleanup(func() { WhatsAppService.Servers.Remove(testBotID) })
+	return server, con
+}
+
+func TestHandlerCachesTextMessage(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	con.Receive(whatsapp.TextMessage{
+		Info: whatsapp.MessageInfo{Id: "MSG1", RemoteJid: testRecipient, Timestamp: 1600000000},
+		Text: "olá",
+	})
+
+	message, ok := server.GetMessage("MSG1")
+	if !ok {
+		t.Fatalf("text message not cached")
+	}
+
+	if message.Text != "olá" {
+		t.Errorf("unexpected text: %s", message.Text)
+	}
+
+	if message.ReplyTo.ID != testRecipient || message.ReplyTo.Phone != "+5521988887777" || message.ReplyTo.Title != "Fulano" {
+		t.Errorf("unexpected reply to: %#v", message.ReplyTo)
+	}
+
+	if message.Controller.ID != testBotID {
+		t.Errorf("unexpected controller: %#v", message.Controller)
+	}
+
+	if server.GetServerStatus().LastMessageAt == nil {
+		t.Errorf("message not registered on health")
+	}
+}
+
+func TestHandlerFillsImageAttachment(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	url := "https://mmg.whatsapp.net/image"
+	mime := "image/jpeg"
+	length := uint64(1024)
+	con.Receive(whatsapp.ImageMessage{
+		Info: whatsapp.MessageInfo{
+			Id:        "IMG1",
+			RemoteJid: testRecipient,
+			Source: &proto.WebMessageInfo{Message: &proto.Message{ImageMessage: &proto.ImageMessage{
+				Url:        &url,
+				Mimetype:   &mime,
+				FileLength: &length,
+				MediaKey:   []byte("key"),
+			}}},
+		},
+		Type: mime,
+	})
+
+	message, ok := server.GetMessage("IMG1")
+	if !ok {
+		t.Fatalf("image message not cached")
+	}
+
+	attachment := message.Attachment
+	if attachment.Url != url || attachment.MIME != mime || attachment.Length != 1024 || attachment.B64MediaKey != "a2V5" {
+		t.Errorf("unexpected attachment: %#v", attachment)
+	}
+}
+
+func TestHandlerUpdatesBatteryAndRaisesLowEvent(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+	events := server.Events.Subscribe()
+	defer server.Events.Unsubscribe(events)
+
+	con.Receive(whatsapp.BatteryMessage{Percentage: 10, Plugged: false})
+
+	if server.Battery.Percentage != 10 || server.Battery.Timestamp.IsZero() {
+		t.Fatalf("battery not updated: %#v", server.Battery)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != LifecycleBatteryLow {
+			t.Errorf("unexpected event: %s", event.Type)
+		}
+	default:
+		t.Errorf("battery low event not raised")
+	}
+}
+
+func TestBatteryLowDisabledPerBot(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+	server.UpdateBot(func(bot *QPBot) { bot.BatteryThreshold = -1 })
+	events := server.Events.Subscribe()
+	defer server.Events.Unsubscribe(events)
+
+	con.Receive(whatsapp.BatteryMessage{Percentage: 1, Plugged: false})
+
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event with the alert disabled: %s", event.Type)
+	default:
+	}
+
+	if bot := server.GetBot(); bot.GetBatteryThreshold() != -1 {
+		t.Errorf("expected the threshold disabled, got %d", bot.GetBatteryThreshold())
+	}
+}
+
+func TestHandlerTracksPresence(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	con.Receive(`["Presence", {"id": "5521988887777@c.us", "type": "available"}]`)
+
+	presences := server.GetPresences()
+	if len(presences) != 1 || presences[0].ID != testRecipient || presences[0].Type != "available" {
+		t.Errorf("unexpected presences: %#v", presences)
+	}
+}
+
+func TestHandlerKeepAliveFailureAndRecovery(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	con.Fail(errors.New("keepAlive failed"))
+	if state := server.State.Get(); state != Unreachable {
+		t.Fatalf("expected unreachable, got %s", state)
+	}
+
+	if server.GetServerStatus().LastError != "keepAlive failed" {
+		t.Errorf("error not registered on health")
+	}
+
+	// Qualquer tráfego indica que o celular voltou
+	con.Receive(`["Stream", "update"]`)
+	if state := server.State.Get(); state != Ready {
+		t.Errorf("expected ready, got %s", state)
+	}
+}
+
+func TestHandlerIgnoresNotImplementedErrors(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	con.Fail(whatsapp.ErrMessageTypeNotImplemented)
+	if state := server.State.Get(); state != Ready {
+		t.Errorf("expected ready, got %s", state)
+	}
+}
+
+func TestServerLoadsHistoryOnFetch(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+	con.AddHistory(testRecipient,
+		whatsapp.TextMessage{Info: whatsapp.MessageInfo{Id: "OLD1", RemoteJid: testRecipient}, Text: "um"},
+		whatsapp.TextMessage{Info: whatsapp.MessageInfo{Id: "OLD2", RemoteJid: testRecipient}, Text: "dois"},
+	)
+
+	err := server.fetchMessages(con, server.Bot, map[string]bool{testRecipient: true, "+5521988887777": true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	messages, _ := server.GetMessages(0)
+	if len(messages) != 2 {
+		t.Errorf("expected 2 messages from history, got %d", len(messages))
+	}
+}
+
+// Valor atual do contador de mensagens recebidas do bot de testes
+func receivedMessages(t *testing.T, msgType string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("error gathering metrics: %s", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "quepasa_bot_received_messages_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["bot"] == "5521999990000" && labels["type"] == msgType {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestHistoryNotCountedAsReceived(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+	con.AddHistory(testRecipient, whatsapp.TextMessage{Info: whatsapp.MessageInfo{Id: "OLD1", RemoteJid: testRecipient}, Text: "um"})
+
+	before := receivedMessages(t, "text")
+	if err := server.fetchMessages(con, server.GetBot(), map[string]bool{testRecipient: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, ok := server.GetMessage("OLD1"); !ok {
+		t.Fatalf("history message not cached")
+	}
+
+	if received := receivedMessages(t, "text"); received != before {
+		t.Errorf("history counted as received: %v, was %v", received, before)
+	}
+
+	if server.GetServerStatus().LastMessageAt != nil {
+		t.Errorf("history registered on health")
+	}
+
+	// Após o histórico o servidor registra o handler de longa duração
+	con.AddHandler(&server.Handlers)
+	con.Receive(whatsapp.TextMessage{Info: whatsapp.MessageInfo{Id: "NEW1", RemoteJid: testRecipient}, Text: "novo"})
+	if received := receivedMessages(t, "text"); received != before+1 {
+		t.Errorf("expected the live message counted, got %v, was %v", received, before)
+	}
+}
+
+func TestServerSendMessage(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	messageID, err := server.SendMessage(whatsapp.TextMessage{Info: whatsapp.MessageInfo{RemoteJid: testRecipient}, Text: "oi"})
+	if err != nil || len(messageID) == 0 {
+		t.Fatalf("unexpected send result: %s, %v", messageID, err)
+	}
+
+	scripted := errors.New("scripted failure")
+	con.ScriptSendError(scripted)
+	if _, err = server.SendMessage(whatsapp.TextMessage{Text: "falha"}); err != scripted {
+		t.Errorf("expected scripted error, got %v", err)
+	}
+
+	if sent := con.Sent(); len(sent) != 1 {
+		t.Errorf("expected 1 sent message, got %d", len(sent))
+	}
+
+	server.State.Transition(Unreachable, "test")
+	if _, err = server.SendMessage(whatsapp.TextMessage{Text: "parado"}); err == nil {
+		t.Errorf("expected error when not ready")
+	}
+}
+
+func TestFakeConnectionSentCapped(t *testing.T) {
+	con := NewQPFakeConnection(testBotID)
+	for i := 0; i < fakeSentLength+5; i++ {
+		con.Send(whatsapp.TextMessage{Text: fmt.Sprintf("mensagem %d", i)})
+	}
+
+	sent, ids := con.SentWithIDs()
+	if len(sent) != fakeSentLength || len(ids) != fakeSentLength {
+		t.Fatalf("expected %d sent messages, got %d, %d", fakeSentLength, len(sent), len(ids))
+	}
+
+	// As mais antigas são descartadas, mantendo os ids alinhados
+	if first := sent[0].(whatsapp.TextMessage); first.Text != "mensagem 5" || ids[0] != "FAKE0000000000000006" {
+		t.Errorf("unexpected oldest message: %s, %s", first.Text, ids[0])
+	}
+
+	if sent, ids := con.TakeSent(); len(sent) != fakeSentLength || len(ids) != fakeSentLength {
+		t.Errorf("unexpected taken messages: %d, %d", len(sent), len(ids))
+	}
+
+	if sent := con.Sent(); len(sent) != 0 {
+		t.Errorf("expected no messages after take, got %d", len(sent))
+	}
+}
+
+func TestServerShutdownDisconnects(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	server.Connection.RemoveHandlers()
+	if _, err := con.Disconnect(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if con.IsConnected() {
+		t.Errorf("connection still open")
+	}
+
+	if _, err := server.SendMessage(whatsapp.TextMessage{Text: "desconectado"}); ClassifyConnectionError(err) != ErrorNotConnected {
+		t.Errorf("expected not connected error, got %v", err)
+	}
+}
+
+// Alterações da interface enquanto as mensagens são encaminhadas, executado com -race
+func TestServerBotUpdatedWhileReceiving(t *testing.T) {
+	server, con := newHandlerTestServer(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			server.UpdateBot(func(bot *QPBot) {
+				bot.Archive = !bot.Archive
+				bot.Devel = !bot.Devel
+				bot.UnpluggedAlert = !bot.UnpluggedAlert
+			})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		con.Receive(whatsapp.TextMessage{
+			Info: whatsapp.MessageInfo{Id: fmt.Sprintf("MSG%d", i), RemoteJid: testRecipient, Timestamp: 1600000000},
+			Text: "olá",
+		})
+	}
+	<-done
+
+	if bot := server.GetBot(); bot.Archive || bot.Devel || bot.UnpluggedAlert {
+		t.Errorf("unexpected bot after an even number of updates: %#v", bot)
+	}
+}
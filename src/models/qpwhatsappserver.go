@@ -3,30 +3,38 @@ package models
 import (
 	"encoding/base64"
 	"fmt"
-	"log"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
-	wa "github.com/Rhymen/go-whatsapp"
 	"github.com/skip2/go-qrcode"
 )
 
 type QPWhatsAppServer struct {
 	Bot            QPBot
-	Connection     *wa.Conn
+	Connection     WhatsAppConnection
 	Handlers       QPMessageHandler
 	Recipients     map[string]bool
 	Messages       map[string]QPMessage
-	syncConnection *sync.Mutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
-	syncMessages   *sync.Mutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
-	Status         *string
+	syncConnection *sync.Mutex // Protege a Connection, trocada ao iniciar e derrubada ao desligar
+	syncMessages   *sync.Mutex // Protege as mensagens e presenças, alteradas pelos handlers
+	syncBot        *sync.RWMutex // Protege o Bot, alterado pela interface enquanto o servidor executa
+	State          *QPConnectionStateMachine
 	Battery        *WhatsAppBateryStatus
+	Presences      map[string]QPPresence
+	Events         *QPEventStream
+	Breaker        *QPCircuitBreaker
+	Reconnect      *QPReconnectLoop
+	Health         *QPServerHealth
+	Log            *QPLogger // Campos do bot e nível próprio, alterável em execução
+
+	lifecycleWebHook string // WebHook de ciclo de vida do dono, em cache para não consultar o banco a cada evento
 }
 
 // Envia o QRCode para o usuário e aguarda pela resposta
 func SignInWithQRCode(user QPUser, out chan<- []byte) (bot QPBot, err error) {
-	con, err := CreateConnection()
+	con, err := NewWhatsAppConnection()
 	if err != nil {
 		return
 	}
@@ -36,7 +44,7 @@ func SignInWithQRCode(user QPUser, out chan<- []byte) (bot QPBot, err error) {
 		var png []byte
 		png, err := qrcode.Encode(<-qr, qrcode.Medium, 256)
 		if err != nil {
-			log.Printf("(%s)(ERR) SUFF ERROR C :: %#v\n", bot.GetNumber(), err.Error())
+			Log.WithComponent("verify").WithError(err).Errorf("error encoding qrcode")
 		}
 		encodedPNG := base64.StdEncoding.EncodeToString(png)
 		out <- []byte(encodedPNG)
@@ -48,127 +56,242 @@ func SignInWithQRCode(user QPUser, out chan<- []byte) (bot QPBot, err error) {
 	}
 
 	// Se chegou até aqui é pq o QRCode foi validado e sincronizado
-	bot, err = WhatsAppService.DB.Bot.GetOrCreate(con.Info.Wid, user.ID)
+	// Bots novos ficam sem token até que o dono gere um
+	bot, err = WhatsAppService.DB.Bot.GetOrCreate(con.Info().Wid, user.ID, "")
 	if err != nil {
 		return
 	}
 
-	err = WriteSession(con.Info.Wid, session)
+	err = WriteSession(con.Info().Wid, session)
 	return
 }
 
 // Instanciando um novo servidor para controle de whatsapp
 func CreateWhatsAppServer(bot QPBot) QPWhatsAppServer {
 
+	// Bots simulados nunca conectam ao whatsapp
+	if bot.Simulated {
+		return newWhatsAppServer(bot, NewQPFakeConnection(bot.ID))
+	}
+
 	// Definindo conexão com whatsapp
-	connection, _ := CreateConnection()
+	connection, _ := NewWhatsAppConnection()
+	return newWhatsAppServer(bot, connection)
+}
 
+func newWhatsAppServer(bot QPBot, connection WhatsAppConnection) QPWhatsAppServer {
 	handlers := &QPMessageHandler{}
 	syncConnetion := &sync.Mutex{}
 	syncMessages := &sync.Mutex{}
+	syncBot := &sync.RWMutex{}
 	recipients := make(map[string]bool)
 	messages := make(map[string]QPMessage)
-	status := "created"
+	state := NewQPConnectionStateMachine()
 	batery := WhatsAppBateryStatus{}
-	return QPWhatsAppServer{bot, connection, *handlers, recipients, messages, syncConnetion, syncMessages, &status, &batery}
+	presences := make(map[string]QPPresence)
+	events := NewQPEventStream()
+	breaker := NewQPCircuitBreaker()
+	reconnect := NewQPReconnectLoop()
+	health := NewQPServerHealth()
+	logger := NewBotLogger(bot)
+	return QPWhatsAppServer{bot, connection, *handlers, recipients, messages, syncConnetion, syncMessages, syncBot, state, &batery, presences, events, breaker, reconnect, health, logger, ""}
+}
+
+// Cópia do bot em execução, lida com segurança pelas rotinas do servidor
+func (server *QPWhatsAppServer) GetBot() QPBot {
+	server.syncBot.RLock()
+	defer server.syncBot.RUnlock()
+	return server.Bot
 }
 
-// Inicializa um repetidor eterno que confere o estado da conexão e tenta novamente a cada 10 segundos
+// Altera o bot em execução, usado quando as configurações mudam pela interface ou pela API
+func (server *QPWhatsAppServer) UpdateBot(update func(bot *QPBot)) {
+	server.syncBot.Lock()
+	update(&server.Bot)
+	server.syncBot.Unlock()
+}
+
+// Inicializa um repetidor que confere o estado da conexão e tenta novamente com espera crescente
+// Somente tenta novamente em caso de falha, para quando desligado ou o whatsapp não aceita mais a sessão
+// Após muitas falhas seguidas o bot é suspenso e precisa ser iniciado manualmente
+// Somente um laço por servidor, chamado com outro em execução apenas o acorda
+// Retorna o erro da última tentativa
 func (server *QPWhatsAppServer) Initialize() (err error) {
-	log.Printf("(%s) Initializing WhatsApp Server ...", server.Bot.GetNumber())
+	if !server.Reconnect.Enter() {
+		server.Log.Debugf("reconnect loop already running, waking it up")
+		return
+	}
+
+	server.Log.Infof("initializing whatsapp server")
+	policy := GetReconnectPolicy()
 	for {
+		// Limitando as conexões simultâneas entre todos os bots
+		policy.Acquire()
 		err = server.Start()
-		if err == nil {
-			break
+		policy.Release()
+
+		if err == nil || !server.State.Is(Failed) {
+			if server.leaveReconnect() {
+				return
+			}
+			continue
+		}
+
+		failures := server.Breaker.Failure()
+		if policy.MaxFailures > 0 && failures >= policy.MaxFailures {
+			server.Suspend(fmt.Sprintf("%d consecutive failures, last: %s", failures, err))
+			if server.leaveReconnect() {
+				return
+			}
+			continue
 		}
 
-		// Aguardaremos 10 segundos e vamos tentar novamente
-		time.Sleep(10 * time.Second)
+		// Aguardaremos um tempo crescente e vamos tentar novamente
+		// Um reinício ou uma retomada interrompem a espera
+		delay := policy.Delay(failures)
+		server.Log.WithField("failures", failures).Warnf("trying again in %s", delay)
+		server.Reconnect.Sleep(delay)
+
+		// Desligado ou removido enquanto aguardava
+		if !server.State.Is(Failed, Disconnected) && server.leaveReconnect() {
+			return
+		}
 	}
-	return nil
 }
 
-// Inicializa um repetidor eterno que confere o estado da conexão e tenta novamente a cada 10 segundos
+// Encerra o laço de reconexão, exceto se um novo pedido chegou enquanto o servidor aguarda iniciar
+func (server *QPWhatsAppServer) leaveReconnect() bool {
+	for !server.Reconnect.Leave() {
+		if server.State.Is(Failed, Disconnected, Suspended) {
+			return false
+		}
+	}
+	return true
+}
+
+// Estaciona o bot após falhas repetidas, evitando tentativas infinitas
+func (server *QPWhatsAppServer) Suspend(reason string) {
+	if !server.State.TransitionFrom([]QPConnectionState{Failed}, Suspended, reason) {
+		return
+	}
+
+	server.Log.WithField("reason", reason).Errorf("whatsapp server suspended")
+}
+
+// Retoma um bot suspenso, zerando o contador de falhas
+func (server *QPWhatsAppServer) Resume() {
+	server.Breaker.Reset()
+	go server.Initialize()
+}
+
+// Desliga o servidor, sem reconexão automática
+// Um início em andamento é interrompido na próxima mudança de estado, e a conexão aberta por ele é derrubada aqui
 func (server *QPWhatsAppServer) Shutdown() (err error) {
-	//server.syncConnection.Lock() // Travando
+	server.State.Transition(Halting, "shutdown requested")
+	server.Log.Infof("shutting down whatsapp server")
 
-	*server.Status = "halting"
-	log.Printf("(%s) Shutting Down WhatsApp Server ...", server.Bot.GetNumber())
+	server.syncConnection.Lock()         // Travando
+	defer server.syncConnection.Unlock() // Destravando
 
 	server.Connection.RemoveHandlers()
 
-	_, err = server.Connection.Disconnect()
+	session, err := server.Connection.Disconnect()
 
 	// caso erro diferente de nulo e não seja pq já esta desconectado
-	if err != nil && !strings.Contains(err.Error(), "not connected") {
-		log.Printf("(%s)(ERR) Shutting WhatsApp Server : %s", server.Bot.GetNumber(), err.Error())
+	if err != nil && ClassifyConnectionError(err) != ErrorNotConnected {
+		server.Log.WithError(err).Errorf("error shutting down whatsapp server")
 	} else {
-		*server.Status = "stopped"
-	}
+		// Gravando as chaves mais recentes, renovadas durante a conexão
+		if err == nil && len(session.ClientToken) > 0 {
+			if err := WriteSession(server.GetBot().ID, session); err != nil {
+				server.Log.WithError(err).Errorf("error writing session")
+			}
+		}
 
-	//server.syncConnection.Unlock() // Destravando
+		err = nil
+		server.State.Transition(Stopped, "shutdown completed")
+	}
 	return
 }
 
 func (server *QPWhatsAppServer) Start() (err error) {
-	server.syncConnection.Lock() // Travando
+	server.syncConnection.Lock()         // Travando
+	defer server.syncConnection.Unlock() // Destravando
 
-	*server.Status = "starting"
-	log.Printf("(%s) Starting WhatsApp Server ...", server.Bot.GetNumber())
+	if err = server.State.Transition(Starting, "start requested"); err != nil {
+		return
+	}
+	server.Log.Infof("starting whatsapp server")
 
 	// Inicializando conexões e handlers
 	err = server.startHandlers()
 	if err != nil {
-		*server.Status = "fail"
-		switch err.(type) {
-		default:
-			if strings.Contains(err.Error(), "401") {
-				log.Printf("(%s) WhatsApp return a unauthorized state, please verify again", server.Bot.GetNumber())
-				err = server.Bot.MarkVerified(false)
-			} else if strings.Contains(err.Error(), "restore session connection timed out") {
-				log.Printf("(%s) WhatsApp returns after a timeout, trying again in 10 seconds, please wait ...", server.Bot.GetNumber())
-			} else {
-				log.Printf("(%s)(ERR) SUFF ERROR F :: Starting Handlers error ... %s :", server.Bot.GetNumber(), err)
+		// Desligado ou removido durante o início, não será tentado novamente
+		if server.State.Is(Halting, Stopped) {
+			server.Log.Infof("start interrupted by shutdown")
+			server.Connection.RemoveHandlers()
+			server.Connection.Disconnect()
+			return
+		}
+
+		server.Health.Error(err)
+		switch ClassifyConnectionError(err) {
+		case ErrorUnauthorized:
+			server.Log.Warnf("whatsapp returned unauthorized, scan the qrcode again")
+			server.State.Transition(Unverified, err.Error())
+			bot := server.GetBot()
+			if err := bot.MarkVerified(false); err != nil {
+				server.Log.WithError(err).Errorf("error marking as unverified")
 			}
-		case *ServiceUnreachableError:
-			log.Println(err)
-	   }		
+		case ErrorTimeout:
+			server.Log.Warnf("whatsapp timed out restoring the session")
+			server.State.Transition(Failed, err.Error())
+		case ErrorServiceUnreachable:
+			server.Log.WithError(err).Warnf("whatsapp service unreachable")
+			server.State.Transition(Failed, err.Error())
+		default:
+			server.Log.WithError(err).Errorf("error starting handlers")
+			server.State.Transition(Failed, err.Error())
+		}
 
 		// Importante para evitar que a conexão em falha continue aberta
 		server.Connection.RemoveHandlers()
-		server.Connection.Disconnect()	
-
-	} else {
-		*server.Status = "ready"
+		server.Connection.Disconnect()
+		return
 	}
 
-	server.syncConnection.Unlock() // Destravando
+	err = server.State.Transition(Ready, "handlers started")
+	if err == nil {
+		server.Breaker.Reset()
+		server.Health.Started()
+	}
 	return
 }
 
-func (server *QPWhatsAppServer) Restart() {
-	// Somente executa caso não esteja em estado de processo de conexão
-	// Evita chamadas simultâneas desnecessárias
-	if !strings.Contains(*server.Status, "starting") {
-		*server.Status = "restarting"
-		log.Printf("(%s) Restarting WhatsApp Server ...", server.Bot.GetNumber())
+// Reinicia a conexão, o motivo é registrado no histórico de estados e nas métricas
+func (server *QPWhatsAppServer) Restart(cause string) {
+	// Somente executa caso não esteja em estado de processo de conexão ou desligado
+	// A verificação atômica evita chamadas simultâneas desnecessárias
+	restartable := []QPConnectionState{Connected, Fetching, Ready, Unreachable, Failed, Disconnected, Critical}
+	if !server.State.TransitionFrom(restartable, Restarting, cause) {
+		return
+	}
+	observeReconnect(server.GetBot(), cause)
 
-		server.Connection.RemoveHandlers()
-		server.Connection.Disconnect()
-		*server.Status = "disconnected"
+	server.Log.WithField("cause", cause).Infof("restarting whatsapp server")
 
-		// Inicia novamente o servidor e os Handlers(alças)
-		err := server.Initialize()
-		if err != nil {
-			*server.Status = "critical"
-			log.Printf("(%s)(ERR) Critical error on WhatsApp Server: %s", server.Bot.GetNumber(), err.Error())
-		}
-	}
+	server.Connection.RemoveHandlers()
+	server.Connection.Disconnect()
+	server.State.Transition(Disconnected, "restarting")
+
+	// Inicia novamente o servidor e os Handlers(alças)
+	// Caso o laço de reconexão já esteja aguardando, ele é acordado em vez de iniciar outro
+	server.Initialize()
 }
 
 // Somente usar em caso de não ser permitida a reconxão automática
 func (server *QPWhatsAppServer) Disconnect(cause string) {
-	log.Printf("(%s) Disconnecting WhatsApp Server: %s", server.Bot.GetNumber(), cause)
+	server.Log.WithField("cause", cause).Infof("disconnecting whatsapp server")
 
 	server.syncConnection.Lock() // Travando
 	// ------
@@ -181,97 +304,259 @@ func (server *QPWhatsAppServer) Disconnect(cause string) {
 }
 
 // Salva em cache e inicia gatilhos assíncronos
+// Chamado pelos handlers, nunca aguarda a trava da conexão mantida durante o início e o desligamento
 func (server *QPWhatsAppServer) AppenMsgToCache(msg QPMessage) error {
-
-	server.syncConnection.Lock() // Sinal vermelho para atividades simultâneas
+	server.syncMessages.Lock() // Sinal vermelho para atividades simultâneas
 	// Apartir deste ponto só se executa um por vez
 
 	//server.Recipients[msg.ReplyTo.ID] = true
 	server.Messages[msg.ID] = msg
 
-	server.syncConnection.Unlock() // Sinal verde !
+	server.syncMessages.Unlock() // Sinal verde !
 
-	// Executando WebHook de forma assincrona
-	go server.Bot.PostToWebHook(msg)
+	// Arquivando anexos (se habilitado) e executando WebHook de forma assincrona
+	RunOutbound(func() {
+		bot := server.GetBot()
+		if bot.Archive && len(msg.Attachment.Url) > 0 {
+			if err := server.ArchiveAttachment(&msg); err != nil {
+				server.Log.WithField("message_id", msg.ID).WithError(err).Errorf("error archiving attachment")
+			}
+		}
+
+		// A sincronização do webhook altera somente a cópia, repassada ao servidor
+		webhook := bot.WebHook
+		bot.PostToWebHook(msg)
+		if bot.WebHook != webhook {
+			server.UpdateBot(func(running *QPBot) { running.WebHook = bot.WebHook })
+		}
+	})
 
 	return nil
 }
 
+// Baixa o anexo imediatamente e salva no armazenamento permanente
+// A url estável é incluída na mensagem em cache e na mensagem passada em parametro
+func (server *QPWhatsAppServer) ArchiveAttachment(msg *QPMessage) (err error) {
+	store := GetMediaStore()
+	if store == nil {
+		return fmt.Errorf("media store not configured")
+	}
+
+	data, err := msg.Attachment.Download()
+	if err != nil {
+		return
+	}
+
+	// Aproveita o download para o cache local
+	GetMediaCache().Put(msg.ID, data)
+
+	key := GetMediaStoreKey(server.GetBot(), msg.ID, msg.Attachment)
+	mime := strings.TrimSpace(strings.Split(msg.Attachment.MIME, ";")[0])
+	url, err := store.Put(key, mime, data)
+	if err != nil {
+		return
+	}
+
+	msg.Attachment.StorageUrl = url
+
+	server.syncMessages.Lock()
+	if cached, ok := server.Messages[msg.ID]; ok {
+		cached.Attachment.StorageUrl = url
+		server.Messages[msg.ID] = cached
+	}
+	server.syncMessages.Unlock()
+	return
+}
+
+// Busca uma mensagem em cache pelo id
+func (server *QPWhatsAppServer) GetMessage(messageID string) (message QPMessage, ok bool) {
+	server.syncMessages.Lock() // Sinal vermelho para atividades simultâneas
+	message, ok = server.Messages[messageID]
+	server.syncMessages.Unlock() // Sinal verde !
+	return
+}
+
+// Retorna o anexo de uma mensagem em cache, fazendo o download do whatsapp somente se necessário
+// O arquivo retornado já está aberto e deve ser fechado por quem chamou
+func (server *QPWhatsAppServer) DownloadAttachment(messageID string) (attachment QPAttachment, file *os.File, hash string, err error) {
+	message, ok := server.GetMessage(messageID)
+	if !ok {
+		err = ErrMessageNotFound
+		return
+	}
+
+	attachment = message.Attachment
+	if len(attachment.Url) == 0 {
+		err = ErrAttachmentNotFound
+		return
+	}
+
+	cache := GetMediaCache()
+	file, hash, ok = cache.Open(messageID)
+	if ok {
+		return
+	}
+
+	data, err := attachment.Download()
+	if err != nil {
+		return
+	}
+
+	if _, _, err = cache.Put(messageID, data); err != nil {
+		return
+	}
+
+	// Recém gravado e o mais novo do cache, não deveria ter sido removido
+	file, hash, ok = cache.Open(messageID)
+	if !ok {
+		err = fmt.Errorf("attachment evicted from the media cache: %s", messageID)
+	}
+	return
+}
+
+// Guarda a última presença conhecida do contato e avisa os interessados
+func (server *QPWhatsAppServer) AppendPresence(presence QPPresence) {
+	server.syncMessages.Lock()
+	server.Presences[presence.ID] = presence
+	server.syncMessages.Unlock()
+
+	event := server.NewEvent("presence")
+	event.Timestamp = presence.Timestamp
+	event.Presence = &presence
+	server.RaiseEvent(event)
+}
+
+// Novo evento originado por este servidor
+func (server *QPWhatsAppServer) NewEvent(eventType string) (event QPEvent) {
+	event.Type = eventType
+	event.Timestamp = time.Now().Unix()
+	bot := server.GetBot()
+	event.Controller.ID = bot.ID
+	event.Controller.Phone = bot.GetNumber()
+	return
+}
+
+// Avisa os inscritos no stream e o WebHook
+func (server *QPWhatsAppServer) RaiseEvent(event QPEvent) {
+	server.Events.Publish(event)
+
+	// Executando WebHook de forma assincrona
+	bot := server.GetBot()
+	RunOutbound(func() { bot.PostEventToWebHook(event) })
+}
+
+func (server *QPWhatsAppServer) GetPresences() (presences []QPPresence) {
+	server.syncMessages.Lock()
+	for _, item := range server.Presences {
+		presences = append(presences, item)
+	}
+	server.syncMessages.Unlock()
+	return
+}
+
+// Solicita ao whatsapp que nos envie as atualizações de presença deste contato
+func (server *QPWhatsAppServer) SubscribePresence(jid string) (err error) {
+	if !server.State.Is(Ready) {
+		return fmt.Errorf("server not ready, wait")
+	}
+
+	_, err = server.Connection.SubscribePresence(jid)
+	return
+}
+
 func (server *QPWhatsAppServer) GetMessages(timestamp uint64) (messages []QPMessage, err error) {
-	server.syncConnection.Lock() // Sinal vermelho para atividades simultâneas
+	server.syncMessages.Lock() // Sinal vermelho para atividades simultâneas
 	for _, item := range server.Messages {
 		if item.Timestamp >= timestamp {
 			messages = append(messages, item)
 		}
 	}
-	server.syncConnection.Unlock() // Sinal verde !
+	server.syncMessages.Unlock() // Sinal verde !
 	return
 }
 
+// Chamado somente por Start, com a trava da conexão
 func (server *QPWhatsAppServer) startHandlers() (err error) {
-	con, err := CreateConnection()
+	bot := server.GetBot()
+	if bot.Simulated {
+		return server.startSimulated()
+	}
+
+	con, err := NewWhatsAppConnection()
 	if err != nil {		
 		if strings.Contains(err.Error(), "bad handshake") {
 			return &ServiceUnreachableError { 
-				Server: server.Bot.GetNumber(),
+				Server: bot.GetNumber(),
 				Message: "bad handshake",
 			}			
 		} else {
-			log.Printf("(%s)(ERR) SUFF ERROR H :: Starting Handlers error ... %s :", server.Bot.GetNumber(), err)
+			server.Log.WithError(err).Errorf("error creating connection")
 		}
 		return 
 	}
 
-	// Definindo conexão
+	// Definindo conexão, protegida pela trava mantida por Start
 	server.Connection = con
 
 	// Definindo handlers para mensagens assincronas
-	startupHandler := &QPMessageHandler{&server.Bot, true, server}
+	// Durante a restauração o whatsapp entrega as últimas mensagens das conversas
+	startupHandler := &QPMessageHandler{&server.Bot, true, server, true}
 	con.AddHandler(startupHandler)
 
 	// Consultando banco de dados e buscando dados de alguma seção salva
-	session, err := ReadSession(server.Bot.ID)
+	session, err := ReadSession(server.GetBot().ID)
 	if err != nil {
-		log.Printf("(%s)(ERR) Error on reading session :: %s", server.Bot.GetNumber(), err)
+		server.Log.WithError(err).Errorf("error reading session")
 		return
 	}
 
 	// Agora sim, restaura a conexão com o whatsapp apartir de uma seção salva
 	session, err = con.RestoreWithSession(session)
 	if err != nil {
-		log.Printf("(%s)(ERR) Error on restore session :: %s", server.Bot.GetNumber(), err)
+		server.Log.WithError(err).Errorf("error restoring session")
 		return
 	}
 
+	// Bateria informada ao conectar, até que o celular envie a primeira atualização
+	if info := con.Info(); info != nil && server.Battery.Timestamp.IsZero() {
+		server.Battery.Percentage = info.Battery
+		server.Battery.Plugged = info.Plugged
+		server.Battery.Timestamp = time.Now()
+	}
+
 	// Atualizando informação sobre o estado da conexão e do servidor
-	*server.Status = "connected"
+	if err = server.State.Transition(Connected, "session restored"); err != nil {
+		return
+	}
 
 	// Aguarda 3 segundos
 	<-time.After(3 * time.Second)
 
 	// Atualiza o banco de dados com os novos dados
-	if err = WriteSession(server.Bot.ID, session); err != nil {
-		log.Printf("(%s)(ERR) Erro on writing session :: %s", server.Bot.GetNumber(), err)
+	if err = WriteSession(server.GetBot().ID, session); err != nil {
+		server.Log.WithError(err).Errorf("error writing session")
 		return
 	}
 
 	con.RemoveHandlers()
 
-	*server.Status = "fetching"
-	log.Printf("(%s) Fetching initial messages", server.Bot.GetNumber())
-	err = server.fetchMessages(con, server.Bot, server.Recipients)
+	if err = server.State.Transition(Fetching, "session saved"); err != nil {
+		return
+	}
+	server.Log.Infof("fetching initial messages")
+	err = server.fetchMessages(con, server.GetBot(), server.Recipients)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("(%s) Setting up long-running message handler", server.Bot.GetNumber())
-	asyncMessageHandler := &QPMessageHandler{&server.Bot, true, server}
+	server.Log.Infof("setting up long-running message handler")
+	asyncMessageHandler := &QPMessageHandler{&server.Bot, true, server, false}
 	server.Handlers = *asyncMessageHandler
 	con.AddHandler(asyncMessageHandler)
 	return
 }
 
-func (server *QPWhatsAppServer) fetchMessages(con *wa.Conn, bot QPBot, recipients map[string]bool) (err error) {
+func (server *QPWhatsAppServer) fetchMessages(con WhatsAppConnection, bot QPBot, recipients map[string]bool) (err error) {
 	for userID := range recipients {
 		if string(userID[0]) == "+" {
 			continue
@@ -289,8 +574,8 @@ func (server *QPWhatsAppServer) fetchMessages(con *wa.Conn, bot QPBot, recipient
 // Carrega as msg do histórico
 // Chamado antes de ativar os handlers
 // Após carregar, salva no cache automaticamente
-func (server *QPWhatsAppServer) loadMessages(con *wa.Conn, bot QPBot, userID string, count int) (err error) {
-	handler := &QPMessageHandler{&server.Bot, true, server}
+func (server *QPWhatsAppServer) loadMessages(con WhatsAppConnection, bot QPBot, userID string, count int) (err error) {
+	handler := &QPMessageHandler{&server.Bot, true, server, true}
 	if con != nil {
 		con.LoadFullChatHistory(userID, count, time.Millisecond*300, handler)
 		con.RemoveHandlers()
@@ -298,7 +583,7 @@ func (server *QPWhatsAppServer) loadMessages(con *wa.Conn, bot QPBot, userID str
 	return
 }
 
-func SendWhatsAppMessage(con *wa.Conn, msg interface{}) (msgid string, err error) {
+func SendWhatsAppMessage(con WhatsAppConnection, msg interface{}) (msgid string, err error) {
 	msgid, err = con.Send(msg)
 	return
 }
@@ -306,23 +591,23 @@ func SendWhatsAppMessage(con *wa.Conn, msg interface{}) (msgid string, err error
 // importante para não derrubar as conexões (ainda não funcionando)
 func (server *QPWhatsAppServer) SendMessage(msg interface{}) (string, error) {
 
-	if *server.Status != "ready" {
+	if !server.State.Is(Ready) {
 		return "", fmt.Errorf("server not ready, wait")
 	}
 
+	started := time.Now()
 	messageID, err := SendWhatsAppMessage(server.Connection, msg)
+	observeMessageSent(server.GetBot(), metricsMessageType(msg), started, err)
 
 	return messageID, err
 }
 
+// Registrando detalhes de depuração para este bot ?
 func (server *QPWhatsAppServer) IsDevelopment() bool {
-	if ENV.IsDevelopment() {
-		return server.Bot.Devel
-	}
-	return false
+	return server.Log.IsEnabled(LogDebug)
 }
 
 // Retorna o titulo em cache (se houver) do id passado em parametro
 func (server *QPWhatsAppServer) GetTitle(Wid string) string {
-	return getTitle(server.Connection.Store, Wid)
+	return getTitle(server.Connection.Store(), Wid)
 }
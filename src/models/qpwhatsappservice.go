@@ -1,54 +1,81 @@
 package models
 
 import (
-	"log"
+	"context"
 	"sync"
 )
 
 // Serviço que controla os servidores / bots individuais do whatsapp
 type QPWhatsAppService struct {
-	Servers map[string]*QPWhatsAppServer
+	Servers *QPServerRegistry
 	DB      *QPDatabase
-	Sync    *sync.Mutex // Objeto de sinaleiro para evitar chamadas simultâneas a este objeto
 }
 
 var WhatsAppService *QPWhatsAppService
 
 func QPWhatsAppStart() {
-	log.Println("Starting WhatsApp Service ....")
+	Log.WithComponent("service").Infof("starting whatsapp service")
 
-	servers := make(map[string]*QPWhatsAppServer)
-	sync := &sync.Mutex{}
-	db := *GetDatabase()
-	WhatsAppService = &QPWhatsAppService{servers, &db, sync}
+	QPWhatsAppPrepare()
+
+	// tokens dos bots gravados em texto por versões anteriores
+	if err := HashLegacyBotTokens(); err != nil {
+		Log.WithComponent("service").WithError(err).Errorf("error hashing legacy bot tokens")
+	}
 
 	// iniciando servidores e cada bot individualmente
 	err := WhatsAppService.initService()
 	if err != nil {
-		log.Printf("Problema ao instanciar bots .... %s", err)
+		Log.WithComponent("service").WithError(err).Errorf("error starting bots")
 	}
 }
 
+// Instancia o serviço e o acesso ao banco de dados, sem iniciar os bots
+// *Usado também pelos comandos de linha
+func QPWhatsAppPrepare() {
+	servers := NewQPServerRegistry()
+	db := *GetDatabase()
+	WhatsAppService = &QPWhatsAppService{servers, &db}
+}
+
 // Inclui um novo servidor em um serviço já em andamento
 // *Usado quando se passa pela verificação do QRCode
 // *Usado quando se inicializa o sistema
+// Caso já exista um servidor para o bot, nada é feito
 func (service *QPWhatsAppService) AppendNewServer(bot QPBot) {
-	// Trava simultaneos
-	service.Sync.Lock()
+	if _, ok := service.Servers.Get(bot.ID); ok {
+		return
+	}
 
-	// Cria um novo servidor
+	// Cria um novo servidor, fora da trava pois já inicia a conexão
 	server := CreateWhatsAppServer(bot)
 
-	// Adiciona na lista de servidores
-	service.Servers[bot.ID] = &server
+	// Eventos de ciclo de vida a cada mudança de estado
+	server.loadLifecycleWebHook()
+	server.State.OnTransition(server.onStateTransition)
 
-	// Destrava simultaneos
-	service.Sync.Unlock()
+	// Adiciona na lista de servidores, outra chamada simultânea pode ter chegado antes
+	if _, added := service.Servers.Add(&server); !added {
+		if server.Connection != nil {
+			server.Connection.Disconnect()
+		}
+		return
+	}
 
 	// Inicializa o servidor
 	go server.Initialize()
 }
 
+// Retira o servidor do bot e o desliga
+// *Usado quando o bot é excluído
+func (service *QPWhatsAppService) RemoveServer(botID string) error {
+	server, ok := service.Servers.Remove(botID)
+	if !ok {
+		return nil
+	}
+	return server.Shutdown()
+}
+
 // Função privada que irá iniciar todos os servidores apartir do banco de dados
 func (service *QPWhatsAppService) initService() error {
 	bots, err := service.DB.Bot.FindAll()
@@ -66,7 +93,33 @@ func (service *QPWhatsAppService) initService() error {
 	return nil
 }
 
+// Desliga todos os servidores, gravando suas sessões, até o prazo expirar
+func (service *QPWhatsAppService) Shutdown(ctx context.Context) error {
+	servers := service.Servers.List()
+
+	wg := &sync.WaitGroup{}
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *QPWhatsAppServer) {
+			defer wg.Done()
+			server.Shutdown()
+		}(server)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func GetServer(botID string) (server *QPWhatsAppServer, ok bool) {
-	server, ok = WhatsAppService.Servers[botID]
-	return
+	return WhatsAppService.Servers.Get(botID)
 }
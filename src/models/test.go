@@ -5,7 +5,6 @@ import (
 	"encoding/base64"
 	"encoding/gob"
 	"fmt"
-	"log"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,13 +23,28 @@ func ReadSession(wid string) (whatsapp.Session, error) {
 		return session, err
 	}
 
-	r := bytes.NewReader(store.Data)
+	keyring := GetSessionKeyring()
+	data, err := keyring.Decrypt(wid, store.Data)
+	if err != nil {
+		return session, err
+	}
+
+	r := bytes.NewReader(data)
 	decoder := gob.NewDecoder(r)
 	err = decoder.Decode(&session)
 	if err != nil {
 		return session, err
 	}
 
+	// Sessão sem criptografia com a chave configurada, regravada criptografada
+	if keyring.Unprotected(store.Data) {
+		logger := Log.WithComponent("crypto").WithField("bot", wid)
+		logger.Warnf("unencrypted session read with session encryption enabled, re-encrypting it")
+		if err := WriteSession(wid, session); err != nil {
+			logger.WithError(err).Errorf("error re-encrypting session")
+		}
+	}
+
 	return session, nil
 }
 
@@ -46,7 +60,13 @@ func WriteSession(wid string, session whatsapp.Session) error {
 		return err
 	}
 
-	_, err = WhatsAppService.DB.Store.Update(wid, buff.Bytes())
+	// Criptografa antes de gravar, caso exista alguma chave configurada
+	data, err := GetSessionKeyring().Encrypt(wid, buff.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = WhatsAppService.DB.Store.Update(wid, data)
 	if err != nil {
 		return err
 	}
@@ -55,16 +75,19 @@ func WriteSession(wid string, session whatsapp.Session) error {
 }
 
 // Cria uma instancia básica de conexão com whatsapp
-func CreateConnection() (*whatsapp.Conn, error) {
+func CreateConnection() (WhatsAppConnection, error) {
 	con, err := whatsapp.NewConn(30 * time.Second)
 	if err != nil {
-		return con, err
+		if con == nil {
+			return nil, err
+		}
+		return &QPWhatsAppConnection{con}, err
 	}
 
 	con.SetClientName("QuePasa for Link", "QuePasa", "0.6")
 	con.SetClientVersion(2, 2121, 6)
 
-	return con, err
+	return &QPWhatsAppConnection{con}, err
 }
 
 func SendMessageFromBOT(botID string, recipient string, text string, attachment QPAttachment) (messageID string, err error) {
@@ -95,11 +118,8 @@ func SendMessageFromBOT(botID string, recipient string, text string, attachment
 		RemoteJid: recipient,
 	}
 
-	if server.IsDevelopment() {
-		log.Printf("(%s)(DEV) Sending msg from bot :: %s :: %s", server.Bot.GetNumber(), recipient, text)
-	}
+	server.Log.Debugf("sending message :: %s :: %s", recipient, text)
 
-	// log.Printf("sending message from bot: %s :: to recipient: %s", botID, recipient)
 	if attachment.Length > 0 {
 		var data []byte
 		data, err = base64.StdEncoding.DecodeString(attachment.Base64)
@@ -161,7 +181,7 @@ func SendMessageFromBOT(botID string, recipient string, text string, attachment
 	}
 
 	if err != nil {
-		log.Printf("(%s) recipient: %s :: error sending message, attachment: %s :: %s", server.Bot.GetNumber(), recipient, attachment.MIME, attachment.FileName)
+		server.Log.WithField("recipient", recipient).WithError(err).Errorf("error sending message, attachment: %s :: %s", attachment.MIME, attachment.FileName)
 	}
 
 	return
@@ -174,7 +194,7 @@ func RetrieveMessages(botID string, timestamp string) (messages []QPMessage, err
 		searchTimestamp = 1000000
 	}
 
-	server, ok := WhatsAppService.Servers[botID]
+	server, ok := GetServer(botID)
 	if !ok {
 		err = fmt.Errorf("handlers not read yet, please wait")
 		return
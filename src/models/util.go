@@ -9,9 +9,13 @@ import (
 	"github.com/go-chi/jwtauth"
 )
 
-// GetUser gets the user_id from the JWT and finds the
-// corresponding user in the database
+// GetUser gets the user authenticated by an API key or the user_id from the JWT
+// and finds the corresponding user in the database
 func GetUser(r *http.Request) (QPUser, error) {
+	if user, ok := r.Context().Value(userContextKey).(QPUser); ok {
+		return user, nil
+	}
+
 	var user QPUser
 	_, claims, err := jwtauth.FromContext(r.Context())
 	if err != nil {
@@ -23,7 +27,11 @@ func GetUser(r *http.Request) (QPUser, error) {
 		return user, errors.New("User ID missing")
 	}
 
-	return WhatsAppService.DB.User.FindByID(userID)
+	user, err = WhatsAppService.DB.User.FindByID(userID)
+	if err == nil && user.Disabled {
+		return user, ErrUserDisabled
+	}
+	return user, err
 }
 
 // CleanPhoneNumber removes all non-numeric characters from a string
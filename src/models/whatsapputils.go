@@ -3,7 +3,6 @@ package models
 import (
 	"encoding/base64"
 	"fmt"
-	"log"
 
 	"github.com/Rhymen/go-whatsapp"
 )
@@ -21,18 +20,15 @@ func (message *QPMessage) FillHeader(Info whatsapp.MessageInfo, server *QPWhatsA
 
 	con := server.Connection
 	if con == nil {
-		err = fmt.Errorf("(%s)(DEV) Null connection on filling headers", server.Bot.GetNumber())
-		if server.IsDevelopment() {
-			log.Print(err)
-		}
+		err = fmt.Errorf("null connection on filling headers")
+		server.Log.Debugf("%s", err)
 		return
 	}
 
-	if con.Info == nil {
-		err = fmt.Errorf("(%s)(DEV) Null connection information on filling headers", server.Bot.GetNumber())
-		if server.IsDevelopment() {
-			log.Print(err)
-		}
+	info := con.Info()
+	if info == nil {
+		err = fmt.Errorf("null connection information on filling headers")
+		server.Log.Debugf("%s", err)
 		return
 	}
 
@@ -40,26 +36,26 @@ func (message *QPMessage) FillHeader(Info whatsapp.MessageInfo, server *QPWhatsA
 	message.FromMe = Info.FromMe
 
 	// Controlador, whatsapp gerenciador
-	message.Controller.ID = con.Info.Wid
-	message.Controller.Phone = getPhone(con.Info.Wid)
-	message.Controller.Title = getTitle(con.Store, con.Info.Wid)
+	message.Controller.ID = info.Wid
+	message.Controller.Phone = getPhone(info.Wid)
+	message.Controller.Title = getTitle(con.Store(), info.Wid)
 
 	// Endereço correto para onde deve ser devolvida a msg
 	message.ReplyTo.ID = Info.RemoteJid
 	message.ReplyTo.Phone = getPhone(Info.RemoteJid)
-	message.ReplyTo.Title = getTitle(con.Store, Info.RemoteJid)
+	message.ReplyTo.Title = getTitle(con.Store(), Info.RemoteJid)
 
 	// Pessoa que enviou a msg dentro de um grupo
-	if Info.Source.Participant != nil {
+	if Info.Source != nil && Info.Source.Participant != nil {
 		message.Participant.ID = *Info.Source.Participant
 		message.Participant.Phone = getPhone(*Info.Source.Participant)
-		message.Participant.Title = getTitle(con.Store, *Info.Source.Participant)
+		message.Participant.Title = getTitle(con.Store(), *Info.Source.Participant)
 	}
 
 	return
 }
 
-func (message *QPMessage) FillAudioAttachment(msg whatsapp.AudioMessage, con *whatsapp.Conn) {
+func (message *QPMessage) FillAudioAttachment(msg whatsapp.AudioMessage, con WhatsAppConnection) {
 	getKey := msg.Info.Source.Message.AudioMessage.MediaKey
 	getUrl := *msg.Info.Source.Message.AudioMessage.Url
 	getLength := *msg.Info.Source.Message.AudioMessage.FileLength
@@ -73,7 +69,7 @@ func (message *QPMessage) FillAudioAttachment(msg whatsapp.AudioMessage, con *wh
 	}
 }
 
-func (message *QPMessage) FillDocumentAttachment(msg whatsapp.DocumentMessage, con *whatsapp.Conn) {
+func (message *QPMessage) FillDocumentAttachment(msg whatsapp.DocumentMessage, con WhatsAppConnection) {
 	innerMSG := msg.Info.Source.Message.DocumentMessage
 	//filename := &innerMSG.FileName
 	message.Attachment = QPAttachment{
@@ -89,10 +85,10 @@ func (message *QPMessage) FillDocumentAttachment(msg whatsapp.DocumentMessage, c
 	}
 }
 
-func (message *QPMessage) FillImageAttachment(msg whatsapp.ImageMessage, con *whatsapp.Conn) {
+func (message *QPMessage) FillImageAttachment(msg whatsapp.ImageMessage, con WhatsAppConnection) {
 	if msg.Info.Source.Message.ImageMessage.Url == nil {
 		// Aconteceu na primeira vez, quando cadastrei o número de whatsapp errado
-		log.Println("erro on filling image attachement, url not avail")
+		Log.WithComponent("whatsapp").Warnf("error filling image attachment, url not available")
 		return
 	}
 